@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"math/big"
 	"monkey/token"
 	"strings"
 )
@@ -76,9 +77,22 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// UseStatement imports the macros of another file during macro expansion.
+type UseStatement struct {
+	Token token.Token // the token.USE token
+	Path  *StringLiteral
+}
+
+func (us *UseStatement) statementNode()       {}
+func (us *UseStatement) TokenLiteral() string { return us.Token.Literal }
+func (us *UseStatement) String() string {
+	return us.TokenLiteral() + " " + fmt.Sprintf("%q", us.Path.Value) + ";"
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Token
 }
 
 func (bs *BlockStatement) statementNode()       {}
@@ -113,6 +127,16 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+// A BigIntegerLiteral is an integer literal too large for an int64.
+type BigIntegerLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+func (bl *BigIntegerLiteral) expressionNode()      {}
+func (bl *BigIntegerLiteral) TokenLiteral() string { return bl.Token.Literal }
+func (bl *BigIntegerLiteral) String() string       { return bl.Token.Literal }
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -148,6 +172,29 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+type FunctionStatement struct {
+	Token    token.Token
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (fs *FunctionStatement) statementNode()       {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionStatement) String() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range fs.Function.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString(fs.TokenLiteral() + " ")
+	out.WriteString(fs.Name.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fs.Function.Body.String())
+	return out.String()
+}
+
 type MacroLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
@@ -170,6 +217,42 @@ func (fl *MacroLiteral) String() string {
 	return out.String()
 }
 
+// A BytesLiteral is a byte string, b"..." in the source.
+type BytesLiteral struct {
+	Token token.Token
+	Value []byte
+}
+
+func (bl *BytesLiteral) expressionNode()      {}
+func (bl *BytesLiteral) TokenLiteral() string { return bl.Token.Literal }
+func (bl *BytesLiteral) String() string       { return QuoteBytes(bl.Value) }
+
+// QuoteBytes returns the literal for the byte string b. Printable ASCII
+// characters are written as they are, all other bytes are escaped.
+func QuoteBytes(b []byte) string {
+	var out strings.Builder
+	out.WriteString(`b"`)
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c == '\n':
+			out.WriteString(`\n`)
+		case c == '\r':
+			out.WriteString(`\r`)
+		case c == '\t':
+			out.WriteString(`\t`)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&out, `\x%02x`, c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -178,6 +261,7 @@ type Boolean struct {
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	Rbracket token.Token
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
@@ -194,14 +278,35 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+type SetLiteral struct {
+	Token    token.Token // the '#{' token
+	Elements []Expression
+	Rbrace   token.Token
+}
+
+func (sl *SetLiteral) expressionNode()      {}
+func (sl *SetLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *SetLiteral) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range sl.Elements {
+		elements = append(elements, el.String())
+	}
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
 type HashPair struct {
 	Key   Expression
 	Value Expression
 }
 
 type HashLiteral struct {
-	Token token.Token
-	Data  []HashPair
+	Token  token.Token
+	Data   []HashPair
+	Rbrace token.Token
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -349,6 +454,23 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+// Hoisted returns the program's statements with all function statements
+// moved to the front, so they can be called before their declaration.
+func (p *Program) Hoisted() []Statement {
+	hoisted := make([]Statement, 0, len(p.Statements))
+	for _, s := range p.Statements {
+		if _, ok := s.(*FunctionStatement); ok {
+			hoisted = append(hoisted, s)
+		}
+	}
+	for _, s := range p.Statements {
+		if _, ok := s.(*FunctionStatement); !ok {
+			hoisted = append(hoisted, s)
+		}
+	}
+	return hoisted
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -358,3 +480,11 @@ func (p *Program) String() string {
 
 	return out.String()
 }
+
+// Kind returns the name of the type of node, like "CallExpression".
+func Kind(node Node) string {
+	if isNil(node) {
+		return ""
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
@@ -0,0 +1,621 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"monkey/token"
+	"strconv"
+)
+
+// The JSON form of a node is an object with a "kind" (the Go type name of
+// the node), a "pos" holding the line and column of its token, and one
+// member per field. Missing children are encoded as null. Tokens are not
+// part of the schema, they're rebuilt from the kind and fields on import.
+
+// MarshalJSON encodes the program and all of its children.
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return json.Marshal(toJSON(p))
+}
+
+// UnmarshalJSON replaces the program with the one encoded in data.
+func (p *Program) UnmarshalJSON(data []byte) error {
+	node, err := FromJSON(data)
+	if err != nil {
+		return err
+	}
+
+	prog, ok := node.(*Program)
+	if !ok {
+		return fmt.Errorf("expected kind Program, got %T", node)
+	}
+
+	*p = *prog
+	return nil
+}
+
+// ToJSON encodes any node using the same schema as Program.MarshalJSON.
+func ToJSON(node Node) ([]byte, error) {
+	return json.Marshal(toJSON(node))
+}
+
+// FromJSON decodes a single node of any kind.
+func FromJSON(data []byte) (Node, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, nil
+	}
+	return decodeNode(obj)
+}
+
+type jsonField struct {
+	name  string
+	value interface{}
+}
+
+// jsonObject keeps its fields in insertion order, so "kind" comes first.
+type jsonObject []jsonField
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, f := range o {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		key, _ := json.Marshal(f.name)
+		out.Write(key)
+		out.WriteString(":")
+		val, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(val)
+	}
+	out.WriteString("}")
+	return out.Bytes(), nil
+}
+
+type jsonPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func nodeJSON(kind string, tok token.Token, fields ...jsonField) jsonObject {
+	obj := jsonObject{
+		{"kind", kind},
+		{"pos", jsonPos{Line: tok.Line, Column: tok.Column}},
+	}
+	return append(obj, fields...)
+}
+
+func toJSON(node Node) interface{} {
+	if isNil(node) {
+		return nil
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		return jsonObject{
+			{"kind", "Program"},
+			{"statements", statementsJSON(node.Statements)},
+		}
+
+	case *BlockStatement:
+		return nodeJSON("BlockStatement", node.Token,
+			jsonField{"statements", statementsJSON(node.Statements)})
+
+	case *ExpressionStatement:
+		return nodeJSON("ExpressionStatement", node.Token,
+			jsonField{"expression", toJSON(node.Expression)})
+
+	case *ReturnStatement:
+		return nodeJSON("ReturnStatement", node.Token,
+			jsonField{"value", toJSON(node.ReturnValue)})
+
+	case *UseStatement:
+		return nodeJSON("UseStatement", node.Token,
+			jsonField{"path", toJSON(node.Path)})
+
+	case *LetStatement:
+		return nodeJSON("LetStatement", node.Token,
+			jsonField{"name", toJSON(node.Name)},
+			jsonField{"value", toJSON(node.Value)})
+
+	case *FunctionStatement:
+		return nodeJSON("FunctionStatement", node.Token,
+			jsonField{"name", toJSON(node.Name)},
+			jsonField{"function", toJSON(node.Function)})
+
+	case *Identifier:
+		return nodeJSON("Identifier", node.Token, jsonField{"value", node.Value})
+
+	case *IntegerLiteral:
+		return nodeJSON("IntegerLiteral", node.Token, jsonField{"value", node.Value})
+
+	case *BigIntegerLiteral:
+		return nodeJSON("BigIntegerLiteral", node.Token, jsonField{"value", node.Value})
+
+	case *StringLiteral:
+		return nodeJSON("StringLiteral", node.Token, jsonField{"value", node.Value})
+
+	case *BytesLiteral:
+		return nodeJSON("BytesLiteral", node.Token, jsonField{"value", node.Value})
+
+	case *Boolean:
+		return nodeJSON("Boolean", node.Token, jsonField{"value", node.Value})
+
+	case *PrefixExpression:
+		return nodeJSON("PrefixExpression", node.Token,
+			jsonField{"operator", node.Operator},
+			jsonField{"right", toJSON(node.Right)})
+
+	case *InfixExpression:
+		return nodeJSON("InfixExpression", node.Token,
+			jsonField{"left", toJSON(node.Left)},
+			jsonField{"operator", node.Operator},
+			jsonField{"right", toJSON(node.Right)})
+
+	case *IfExpression:
+		return nodeJSON("IfExpression", node.Token,
+			jsonField{"condition", toJSON(node.Condition)},
+			jsonField{"consequence", toJSON(node.Consequence)},
+			jsonField{"alternative", toJSON(node.Alternative)})
+
+	case *FunctionLiteral:
+		return nodeJSON("FunctionLiteral", node.Token,
+			jsonField{"name", node.Name},
+			jsonField{"parameters", identifiersJSON(node.Parameters)},
+			jsonField{"body", toJSON(node.Body)})
+
+	case *MacroLiteral:
+		return nodeJSON("MacroLiteral", node.Token,
+			jsonField{"parameters", identifiersJSON(node.Parameters)},
+			jsonField{"body", toJSON(node.Body)})
+
+	case *CallExpression:
+		return nodeJSON("CallExpression", node.Token,
+			jsonField{"function", toJSON(node.Function)},
+			jsonField{"arguments", expressionsJSON(node.Arguments)})
+
+	case *ArrayLiteral:
+		return nodeJSON("ArrayLiteral", node.Token,
+			jsonField{"elements", expressionsJSON(node.Elements)})
+
+	case *SetLiteral:
+		return nodeJSON("SetLiteral", node.Token,
+			jsonField{"elements", expressionsJSON(node.Elements)})
+
+	case *IndexExpression:
+		return nodeJSON("IndexExpression", node.Token,
+			jsonField{"left", toJSON(node.Left)},
+			jsonField{"index", toJSON(node.Index)})
+
+	case *HashLiteral:
+		pairs := []interface{}{}
+		for _, p := range node.Data {
+			pairs = append(pairs, jsonObject{
+				{"key", toJSON(p.Key)},
+				{"value", toJSON(p.Value)},
+			})
+		}
+		return nodeJSON("HashLiteral", node.Token, jsonField{"pairs", pairs})
+
+	default:
+		return nil
+	}
+}
+
+func statementsJSON(stmts []Statement) []interface{} {
+	out := []interface{}{}
+	for _, s := range stmts {
+		out = append(out, toJSON(s))
+	}
+	return out
+}
+
+func expressionsJSON(exps []Expression) []interface{} {
+	out := []interface{}{}
+	for _, e := range exps {
+		out = append(out, toJSON(e))
+	}
+	return out
+}
+
+func identifiersJSON(idents []*Identifier) []interface{} {
+	out := []interface{}{}
+	for _, i := range idents {
+		out = append(out, toJSON(i))
+	}
+	return out
+}
+
+// jsonDecoder reads the fields of a single encoded node. The first error
+// encountered sticks, so callers can check it once at the end.
+type jsonDecoder struct {
+	kind string
+	obj  map[string]json.RawMessage
+	err  error
+}
+
+func (d *jsonDecoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%s: %s", d.kind, fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *jsonDecoder) value(field string, target interface{}) {
+	raw, ok := d.obj[field]
+	if !ok {
+		d.fail("missing field %q", field)
+		return
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		d.fail("field %q: %s", field, err)
+	}
+}
+
+func (d *jsonDecoder) str(field string) string {
+	var s string
+	d.value(field, &s)
+	return s
+}
+
+func (d *jsonDecoder) token(t token.TokenType, literal string) token.Token {
+	tok := token.Token{Type: t, Literal: literal}
+	if raw, ok := d.obj["pos"]; ok {
+		var pos *jsonPos
+		if err := json.Unmarshal(raw, &pos); err != nil {
+			d.fail("field \"pos\": %s", err)
+		} else if pos != nil {
+			tok.Line, tok.Column = pos.Line, pos.Column
+		}
+	}
+	return tok
+}
+
+func (d *jsonDecoder) node(field string) Node {
+	raw, ok := d.obj[field]
+	if !ok {
+		d.fail("missing field %q", field)
+		return nil
+	}
+	node, err := decodeRaw(raw)
+	if err != nil {
+		d.fail("field %q: %s", field, err)
+	}
+	return node
+}
+
+func (d *jsonDecoder) nodes(field string) []Node {
+	var raws []json.RawMessage
+	d.value(field, &raws)
+
+	nodes := []Node{}
+	for i, raw := range raws {
+		node, err := decodeRaw(raw)
+		if err != nil {
+			d.fail("field %q[%d]: %s", field, i, err)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (d *jsonDecoder) expression(field string) Expression {
+	node := d.node(field)
+	if node == nil {
+		return nil
+	}
+	exp, ok := node.(Expression)
+	if !ok {
+		d.fail("field %q is not an expression, got %T", field, node)
+	}
+	return exp
+}
+
+func (d *jsonDecoder) identifier(field string) *Identifier {
+	node := d.node(field)
+	if node == nil {
+		return nil
+	}
+	ident, ok := node.(*Identifier)
+	if !ok {
+		d.fail("field %q is not an Identifier, got %T", field, node)
+	}
+	return ident
+}
+
+func (d *jsonDecoder) stringLiteral(field string) *StringLiteral {
+	node := d.node(field)
+	if node == nil {
+		return nil
+	}
+	str, ok := node.(*StringLiteral)
+	if !ok {
+		d.fail("field %q is not a StringLiteral, got %T", field, node)
+	}
+	return str
+}
+
+func (d *jsonDecoder) block(field string) *BlockStatement {
+	node := d.node(field)
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail("field %q is not a BlockStatement, got %T", field, node)
+	}
+	return block
+}
+
+func (d *jsonDecoder) statements(field string) []Statement {
+	stmts := []Statement{}
+	for i, n := range d.nodes(field) {
+		stmt, ok := n.(Statement)
+		if !ok {
+			d.fail("field %q[%d] is not a statement, got %T", field, i, n)
+			continue
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+func (d *jsonDecoder) expressions(field string) []Expression {
+	exps := []Expression{}
+	for i, n := range d.nodes(field) {
+		exp, ok := n.(Expression)
+		if !ok {
+			d.fail("field %q[%d] is not an expression, got %T", field, i, n)
+			continue
+		}
+		exps = append(exps, exp)
+	}
+	return exps
+}
+
+func (d *jsonDecoder) identifiers(field string) []*Identifier {
+	idents := []*Identifier{}
+	for i, n := range d.nodes(field) {
+		ident, ok := n.(*Identifier)
+		if !ok {
+			d.fail("field %q[%d] is not an Identifier, got %T", field, i, n)
+			continue
+		}
+		idents = append(idents, ident)
+	}
+	return idents
+}
+
+func decodeRaw(raw json.RawMessage) (Node, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, nil
+	}
+	return decodeNode(obj)
+}
+
+var operatorTokens = map[string]token.TokenType{
+	"+":  token.PLUS,
+	"-":  token.MINUS,
+	"!":  token.BANG,
+	"*":  token.ASTERISK,
+	"/":  token.SLASH,
+	"<":  token.LT,
+	">":  token.GT,
+	"==": token.EQ,
+	"!=": token.NOT_EQ,
+	"in": token.IN,
+	"is": token.IS,
+}
+
+func decodeNode(obj map[string]json.RawMessage) (Node, error) {
+	d := &jsonDecoder{obj: obj}
+	d.kind = d.str("kind")
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	var node Node
+
+	switch d.kind {
+	case "Program":
+		node = &Program{Statements: d.statements("statements")}
+
+	case "BlockStatement":
+		node = &BlockStatement{
+			Token:      d.token(token.LBRACE, "{"),
+			Statements: d.statements("statements"),
+		}
+
+	case "ExpressionStatement":
+		exp := d.expression("expression")
+		tok := d.token(token.ILLEGAL, "")
+		if exp != nil {
+			tok.Literal = exp.TokenLiteral()
+		}
+		node = &ExpressionStatement{Token: tok, Expression: exp}
+
+	case "ReturnStatement":
+		node = &ReturnStatement{
+			Token:       d.token(token.RETURN, "return"),
+			ReturnValue: d.expression("value"),
+		}
+
+	case "UseStatement":
+		node = &UseStatement{
+			Token: d.token(token.USE, "use"),
+			Path:  d.stringLiteral("path"),
+		}
+
+	case "LetStatement":
+		let := &LetStatement{
+			Token: d.token(token.LET, "let"),
+			Name:  d.identifier("name"),
+			Value: d.expression("value"),
+		}
+		if fn, ok := let.Value.(*FunctionLiteral); ok && let.Name != nil {
+			fn.Name = let.Name.Value
+		}
+		node = let
+
+	case "FunctionStatement":
+		stmt := &FunctionStatement{
+			Token: d.token(token.FUNCTION, "fn"),
+			Name:  d.identifier("name"),
+		}
+		fn, ok := d.node("function").(*FunctionLiteral)
+		if !ok {
+			d.fail("field \"function\" is not a FunctionLiteral")
+		} else if stmt.Name != nil {
+			fn.Name = stmt.Name.Value
+		}
+		stmt.Function = fn
+		node = stmt
+
+	case "Identifier":
+		value := d.str("value")
+		node = &Identifier{Token: d.token(token.IDENT, value), Value: value}
+
+	case "IntegerLiteral":
+		var value int64
+		d.value("value", &value)
+		node = &IntegerLiteral{
+			Token: d.token(token.INT, strconv.FormatInt(value, 10)),
+			Value: value,
+		}
+
+	case "BigIntegerLiteral":
+		value := new(big.Int)
+		d.value("value", value)
+		node = &BigIntegerLiteral{
+			Token: d.token(token.INT, value.String()),
+			Value: value,
+		}
+
+	case "StringLiteral":
+		value := d.str("value")
+		node = &StringLiteral{Token: d.token(token.STRING, value), Value: value}
+
+	case "BytesLiteral":
+		var value []byte
+		d.value("value", &value)
+		node = &BytesLiteral{Token: d.token(token.BYTES, string(value)), Value: value}
+
+	case "Boolean":
+		var value bool
+		d.value("value", &value)
+		if value {
+			node = &Boolean{Token: d.token(token.TRUE, "true"), Value: true}
+		} else {
+			node = &Boolean{Token: d.token(token.FALSE, "false"), Value: false}
+		}
+
+	case "PrefixExpression", "InfixExpression":
+		operator := d.str("operator")
+		tokType, ok := operatorTokens[operator]
+		if !ok && d.err == nil {
+			d.fail("unknown operator %q", operator)
+		}
+		if d.kind == "PrefixExpression" {
+			node = &PrefixExpression{
+				Token:    d.token(tokType, operator),
+				Operator: operator,
+				Right:    d.expression("right"),
+			}
+		} else {
+			node = &InfixExpression{
+				Token:    d.token(tokType, operator),
+				Left:     d.expression("left"),
+				Operator: operator,
+				Right:    d.expression("right"),
+			}
+		}
+
+	case "IfExpression":
+		node = &IfExpression{
+			Token:       d.token(token.IF, "if"),
+			Condition:   d.expression("condition"),
+			Consequence: d.block("consequence"),
+			Alternative: d.block("alternative"),
+		}
+
+	case "FunctionLiteral":
+		fn := &FunctionLiteral{
+			Token:      d.token(token.FUNCTION, "fn"),
+			Parameters: d.identifiers("parameters"),
+			Body:       d.block("body"),
+		}
+		if _, ok := obj["name"]; ok {
+			fn.Name = d.str("name")
+		}
+		node = fn
+
+	case "MacroLiteral":
+		node = &MacroLiteral{
+			Token:      d.token(token.MACRO, "macro"),
+			Parameters: d.identifiers("parameters"),
+			Body:       d.block("body"),
+		}
+
+	case "CallExpression":
+		node = &CallExpression{
+			Token:     d.token(token.LPAREN, "("),
+			Function:  d.expression("function"),
+			Arguments: d.expressions("arguments"),
+		}
+
+	case "ArrayLiteral":
+		node = &ArrayLiteral{
+			Token:    d.token(token.LBRACKET, "["),
+			Elements: d.expressions("elements"),
+		}
+
+	case "SetLiteral":
+		node = &SetLiteral{
+			Token:    d.token(token.SET_LBRACE, "#{"),
+			Elements: d.expressions("elements"),
+		}
+
+	case "IndexExpression":
+		node = &IndexExpression{
+			Token: d.token(token.LBRACKET, "["),
+			Left:  d.expression("left"),
+			Index: d.expression("index"),
+		}
+
+	case "HashLiteral":
+		var raws []map[string]json.RawMessage
+		d.value("pairs", &raws)
+		hash := &HashLiteral{Token: d.token(token.LBRACE, "{"), Data: []HashPair{}}
+		for _, raw := range raws {
+			pair := &jsonDecoder{kind: "HashPair", obj: raw}
+			hash.Data = append(hash.Data, HashPair{
+				Key:   pair.expression("key"),
+				Value: pair.expression("value"),
+			})
+			if pair.err != nil {
+				d.fail("%s", pair.err)
+			}
+		}
+		node = hash
+
+	default:
+		return nil, fmt.Errorf("unknown node kind %q", d.kind)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return node, nil
+}
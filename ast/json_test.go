@@ -0,0 +1,159 @@
+package ast
+
+import (
+	"encoding/json"
+	"math/big"
+	"monkey/token"
+	"testing"
+)
+
+func TestProgramMarshalJSON(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5},
+					Value: "x",
+				},
+				Value: &PrefixExpression{
+					Token:    token.Token{Type: token.MINUS, Literal: "-", Line: 1, Column: 9},
+					Operator: "-",
+					Right: &IntegerLiteral{
+						Token: token.Token{Type: token.INT, Literal: "5", Line: 1, Column: 10},
+						Value: 5,
+					},
+				},
+			},
+		},
+	}
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+
+	expected := `{"kind":"Program","statements":[` +
+		`{"kind":"LetStatement","pos":{"line":1,"column":1},` +
+		`"name":{"kind":"Identifier","pos":{"line":1,"column":5},"value":"x"},` +
+		`"value":{"kind":"PrefixExpression","pos":{"line":1,"column":9},"operator":"-",` +
+		`"right":{"kind":"IntegerLiteral","pos":{"line":1,"column":10},"value":5}}}]}`
+
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nwant=%s\ngot =%s", expected, data)
+	}
+
+	var decoded Program
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+
+	if decoded.String() != program.String() {
+		t.Errorf("round trip changed program. want=%q, got=%q", program.String(), decoded.String())
+	}
+
+	let := decoded.Statements[0].(*LetStatement)
+	if let.Token != program.Statements[0].(*LetStatement).Token {
+		t.Errorf("token not restored, got=%+v", let.Token)
+	}
+	if tok := let.Value.(*PrefixExpression).Token; tok.Type != token.MINUS || tok.Line != 1 || tok.Column != 9 {
+		t.Errorf("operator token not restored, got=%+v", tok)
+	}
+}
+
+func TestBigIntegerJSON(t *testing.T) {
+	value, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	node := &BigIntegerLiteral{Token: token.Token{Type: token.INT, Literal: value.String()}, Value: value}
+
+	data, err := ToJSON(node)
+	if err != nil {
+		t.Fatalf("ToJSON failed: %s", err)
+	}
+	expected := `{"kind":"BigIntegerLiteral","pos":{"line":0,"column":0},"value":-123456789012345678901234567890}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nwant=%s\ngot =%s", expected, data)
+	}
+
+	decoded, err := FromJSON(data)
+	if err != nil {
+		t.Fatalf("FromJSON failed: %s", err)
+	}
+	lit, ok := decoded.(*BigIntegerLiteral)
+	if !ok {
+		t.Fatalf("decoded node is not *BigIntegerLiteral. got=%T", decoded)
+	}
+	if lit.Value.Cmp(value) != 0 || lit.String() != value.String() {
+		t.Errorf("wrong value. want=%s, got=%s (%s)", value, lit.Value, lit.String())
+	}
+}
+
+func TestBytesJSON(t *testing.T) {
+	node := &BytesLiteral{Token: token.Token{Type: token.BYTES, Literal: "\x00\xff"}, Value: []byte{0, 255}}
+
+	data, err := ToJSON(node)
+	if err != nil {
+		t.Fatalf("ToJSON failed: %s", err)
+	}
+	decoded, err := FromJSON(data)
+	if err != nil {
+		t.Fatalf("FromJSON failed: %s", err)
+	}
+	if decoded.String() != `b"\x00\xff"` {
+		t.Errorf("round trip changed bytes. got=%s", decoded.String())
+	}
+}
+
+func TestSetJSON(t *testing.T) {
+	node := &InfixExpression{
+		Token:    token.Token{Type: token.IN, Literal: "in"},
+		Operator: "in",
+		Left:     &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"},
+		Right: &SetLiteral{
+			Token:    token.Token{Type: token.SET_LBRACE, Literal: "#{"},
+			Elements: []Expression{&Identifier{Token: token.Token{Type: token.IDENT, Literal: "y"}, Value: "y"}},
+		},
+	}
+
+	data, err := ToJSON(node)
+	if err != nil {
+		t.Fatalf("ToJSON failed: %s", err)
+	}
+	decoded, err := FromJSON(data)
+	if err != nil {
+		t.Fatalf("FromJSON failed: %s", err)
+	}
+	if decoded.String() != "(x in #{y})" {
+		t.Errorf("round trip changed set. got=%s", decoded.String())
+	}
+	infix := decoded.(*InfixExpression)
+	if infix.Token.Type != token.IN || infix.Right.(*SetLiteral).Token.Type != token.SET_LBRACE {
+		t.Errorf("tokens not restored, got=%+v and %+v", infix.Token, infix.Right.(*SetLiteral).Token)
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Nope"}`, `unknown node kind "Nope"`},
+		{`{"value":1}`, `: missing field "kind"`},
+		{`{"kind":"ExpressionStatement"}`, `ExpressionStatement: missing field "expression"`},
+		{`{"kind":"PrefixExpression","operator":"%","right":null}`, `PrefixExpression: unknown operator "%"`},
+		{`{"kind":"Program","statements":[{"kind":"Identifier","value":"x"}]}`,
+			`Program: field "statements"[0] is not a statement, got *ast.Identifier`},
+		{`{"kind":"UseStatement","path":{"kind":"Identifier","value":"x"}}`,
+			`UseStatement: field "path" is not a StringLiteral, got *ast.Identifier`},
+	}
+
+	for _, tt := range tests {
+		_, err := FromJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected error for %s", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
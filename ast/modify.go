@@ -1,18 +1,41 @@
 package ast
 
-import "reflect"
+import "math/big"
 
 type ModifierFunc func(Node) Node
 
+// Modify calls modifier for every node in the tree, children first, and
+// replaces each node with the result. The tree is changed in place. An
+// expression statement whose expression is replaced by a statement is
+// replaced by that statement.
 func Modify(node Node, modifier ModifierFunc) Node {
+	return modify(node, modifier, false)
+}
+
+// Transform works like Modify, but leaves node untouched and returns a new
+// tree. The modifier only ever sees the copies.
+func Transform(node Node, modifier ModifierFunc) Node {
+	return modify(node, modifier, true)
+}
+
+// Clone returns a deep copy of node, sharing nothing with the original.
+func Clone(node Node) Node {
+	return Transform(node, func(n Node) Node { return n })
+}
+
+func modify(node Node, modifier ModifierFunc, copying bool) Node {
 	mod := func(node Node) Node {
-		return Modify(node, modifier)
+		return modify(node, modifier, copying)
 	}
 
-	if rv := reflect.ValueOf(node); !rv.IsValid() || rv.IsNil() {
+	if isNil(node) {
 		return node
 	}
 
+	if copying {
+		node = shallowCopy(node)
+	}
+
 	switch node := node.(type) {
 	case *Program:
 		for i, stmt := range node.Statements {
@@ -25,13 +48,44 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		}
 
 	case *ExpressionStatement:
-		node.Expression, _ = mod(node.Expression).(Expression)
+		switch exp := mod(node.Expression).(type) {
+		case Expression:
+			node.Expression = exp
+		case Statement:
+			return exp
+		default:
+			node.Expression = nil
+		}
 
 	case *ReturnStatement:
 		node.ReturnValue, _ = mod(node.ReturnValue).(Expression)
 
+	case *UseStatement:
+		if path, ok := mod(node.Path).(*StringLiteral); ok {
+			node.Path = path
+		}
+
 	case *LetStatement:
+		oldName := ""
+		if node.Name != nil {
+			oldName = node.Name.Value
+		}
+		if name, ok := mod(node.Name).(*Identifier); ok {
+			node.Name = name
+		}
 		node.Value, _ = mod(node.Value).(Expression)
+		if fn, ok := node.Value.(*FunctionLiteral); ok && node.Name != nil && fn.Name == oldName {
+			fn.Name = node.Name.Value
+		}
+
+	case *FunctionStatement:
+		if name, ok := mod(node.Name).(*Identifier); ok {
+			node.Name = name
+		}
+		node.Function, _ = mod(node.Function).(*FunctionLiteral)
+		if node.Function != nil && node.Name != nil {
+			node.Function.Name = node.Name.Value
+		}
 
 	case *InfixExpression:
 		node.Left, _ = mod(node.Left).(Expression)
@@ -49,24 +103,135 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		node.Consequence, _ = mod(node.Consequence).(*BlockStatement)
 		node.Alternative, _ = mod(node.Alternative).(*BlockStatement)
 
+	case *CallExpression:
+		node.Function, _ = mod(node.Function).(Expression)
+		for i, arg := range node.Arguments {
+			node.Arguments[i], _ = mod(arg).(Expression)
+		}
+
 	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i] = mod(param).(*Identifier)
+		}
 		node.Body, _ = mod(node.Body).(*BlockStatement)
+
+	case *MacroLiteral:
 		for i, param := range node.Parameters {
 			node.Parameters[i] = mod(param).(*Identifier)
 		}
+		node.Body, _ = mod(node.Body).(*BlockStatement)
 
 	case *ArrayLiteral:
 		for i, exp := range node.Elements {
 			node.Elements[i] = mod(exp).(Expression)
 		}
 
+	case *SetLiteral:
+		for i, exp := range node.Elements {
+			node.Elements[i] = mod(exp).(Expression)
+		}
+
 	case *HashLiteral:
-		for _, pair := range node.Data {
-			pair.Key = mod(pair.Key).(Expression)
-			pair.Value = mod(pair.Value).(Expression)
+		for i, pair := range node.Data {
+			node.Data[i].Key = mod(pair.Key).(Expression)
+			node.Data[i].Value = mod(pair.Value).(Expression)
 		}
 
 	}
 
 	return modifier(node)
 }
+
+// shallowCopy copies node and the slices it holds, but not its children.
+func shallowCopy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		cp := *node
+		cp.Statements = copySlice(node.Statements)
+		return &cp
+	case *BlockStatement:
+		cp := *node
+		cp.Statements = copySlice(node.Statements)
+		return &cp
+	case *ExpressionStatement:
+		cp := *node
+		return &cp
+	case *ReturnStatement:
+		cp := *node
+		return &cp
+	case *UseStatement:
+		cp := *node
+		return &cp
+	case *LetStatement:
+		cp := *node
+		return &cp
+	case *FunctionStatement:
+		cp := *node
+		return &cp
+	case *Identifier:
+		cp := *node
+		return &cp
+	case *IntegerLiteral:
+		cp := *node
+		return &cp
+	case *BigIntegerLiteral:
+		cp := *node
+		cp.Value = new(big.Int).Set(node.Value)
+		return &cp
+	case *StringLiteral:
+		cp := *node
+		return &cp
+	case *BytesLiteral:
+		cp := *node
+		cp.Value = append([]byte{}, node.Value...)
+		return &cp
+	case *Boolean:
+		cp := *node
+		return &cp
+	case *InfixExpression:
+		cp := *node
+		return &cp
+	case *PrefixExpression:
+		cp := *node
+		return &cp
+	case *IndexExpression:
+		cp := *node
+		return &cp
+	case *IfExpression:
+		cp := *node
+		return &cp
+	case *CallExpression:
+		cp := *node
+		cp.Arguments = copySlice(node.Arguments)
+		return &cp
+	case *FunctionLiteral:
+		cp := *node
+		cp.Parameters = copySlice(node.Parameters)
+		return &cp
+	case *MacroLiteral:
+		cp := *node
+		cp.Parameters = copySlice(node.Parameters)
+		return &cp
+	case *ArrayLiteral:
+		cp := *node
+		cp.Elements = copySlice(node.Elements)
+		return &cp
+	case *SetLiteral:
+		cp := *node
+		cp.Elements = copySlice(node.Elements)
+		return &cp
+	case *HashLiteral:
+		cp := *node
+		cp.Data = copySlice(node.Data)
+		return &cp
+	default:
+		return node
+	}
+}
+
+func copySlice[T any](s []T) []T {
+	if s == nil {
+		return nil
+	}
+	return append(make([]T, 0, len(s)), s...)
+}
@@ -117,6 +117,28 @@ func TestModify(t *testing.T) {
 			&ArrayLiteral{Elements: []Expression{one(), one()}},
 			&ArrayLiteral{Elements: []Expression{two(), two()}},
 		},
+		{
+			&CallExpression{Function: one(), Arguments: []Expression{one(), one()}},
+			&CallExpression{Function: two(), Arguments: []Expression{two(), two()}},
+		},
+		{
+			&MacroLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&MacroLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -148,3 +170,127 @@ func TestModify(t *testing.T) {
 		}
 	}
 }
+
+func TestModifyRenamesFunctionLiterals(t *testing.T) {
+	rename := func(node Node) Node {
+		ident, ok := node.(*Identifier)
+		if !ok || ident.Value != "f" {
+			return node
+		}
+		return &Identifier{Value: "g"}
+	}
+
+	let := &LetStatement{
+		Name:  &Identifier{Value: "f"},
+		Value: &FunctionLiteral{Name: "f", Body: &BlockStatement{}},
+	}
+	Modify(let, rename)
+
+	if let.Name.Value != "g" {
+		t.Errorf("let name not modified, got=%q", let.Name.Value)
+	}
+	if fn := let.Value.(*FunctionLiteral); fn.Name != "g" {
+		t.Errorf("function literal name not updated, got=%q", fn.Name)
+	}
+
+	stmt := &FunctionStatement{
+		Name:     &Identifier{Value: "f"},
+		Function: &FunctionLiteral{Name: "f", Body: &BlockStatement{}},
+	}
+	Modify(stmt, rename)
+
+	if stmt.Name.Value != "g" || stmt.Function.Name != "g" {
+		t.Errorf("function statement not renamed, got=%q/%q", stmt.Name.Value, stmt.Function.Name)
+	}
+}
+
+func TestModifyReplacesStatements(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: &Identifier{Value: "x"}},
+		},
+	}
+	let := &LetStatement{Name: &Identifier{Value: "y"}, Value: &IntegerLiteral{Value: 1}}
+
+	Modify(program, func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok && ident.Value == "x" {
+			return let
+		}
+		return node
+	})
+
+	if program.Statements[0] != Statement(let) {
+		t.Errorf("statement not replaced, got=%T (%+v)", program.Statements[0], program.Statements[0])
+	}
+}
+
+func TestTransform(t *testing.T) {
+	input := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Expression: &InfixExpression{
+					Left:     &IntegerLiteral{Value: 1},
+					Operator: "+",
+					Right:    &CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{&IntegerLiteral{Value: 1}}},
+				},
+			},
+		},
+	}
+	original := input.String()
+
+	turnOneIntoTwo := func(node Node) Node {
+		if intLit, ok := node.(*IntegerLiteral); ok && intLit.Value == 1 {
+			intLit.Value = 2
+			intLit.Token.Literal = "2"
+		}
+		return node
+	}
+
+	transformed := Transform(input, turnOneIntoTwo)
+
+	if input.String() != original {
+		t.Errorf("input was modified, got=%q, want=%q", input.String(), original)
+	}
+	if transformed.String() != "(2 + f(2))" {
+		t.Errorf("transformed wrong, got=%q", transformed.String())
+	}
+	if transformed == Node(input) {
+		t.Errorf("Transform returned the input program")
+	}
+}
+
+func TestClone(t *testing.T) {
+	original := &LetStatement{
+		Name: &Identifier{Value: "f"},
+		Value: &FunctionLiteral{
+			Name:       "f",
+			Parameters: []*Identifier{{Value: "x"}},
+			Body: &BlockStatement{
+				Statements: []Statement{
+					&ExpressionStatement{Expression: &HashLiteral{
+						Data: []HashPair{{Key: &StringLiteral{Value: "k"}, Value: &Identifier{Value: "x"}}},
+					}},
+				},
+			},
+		},
+	}
+
+	clone := Clone(original).(*LetStatement)
+
+	if !reflect.DeepEqual(clone, original) {
+		t.Fatalf("clone differs. got=%#v, want=%#v", clone, original)
+	}
+
+	fn := clone.Value.(*FunctionLiteral)
+	fn.Parameters[0].Value = "y"
+	fn.Body.Statements[0].(*ExpressionStatement).Expression.(*HashLiteral).Data[0].Value = &Identifier{Value: "y"}
+
+	origFn := original.Value.(*FunctionLiteral)
+	if origFn.Parameters[0].Value != "x" {
+		t.Errorf("changing the clone changed a parameter of the original")
+	}
+	hash := origFn.Body.Statements[0].(*ExpressionStatement).Expression.(*HashLiteral)
+	if hash.Data[0].Value.(*Identifier).Value != "x" {
+		t.Errorf("changing the clone changed a hash value of the original")
+	}
+}
@@ -0,0 +1,233 @@
+package ast
+
+// A Visitor is called for every node Walk encounters. Enter is called before
+// the children of a node are visited, Leave after all of them have been. If
+// Enter returns false, the children of the node and its Leave call are
+// skipped.
+type Visitor interface {
+	Enter(c *Cursor) bool
+	Leave(c *Cursor)
+}
+
+// Hooks turns a pair of functions into a Visitor, either one may be nil.
+type Hooks struct {
+	EnterFn func(c *Cursor) bool
+	LeaveFn func(c *Cursor)
+}
+
+func (h Hooks) Enter(c *Cursor) bool {
+	if h.EnterFn == nil {
+		return true
+	}
+	return h.EnterFn(c)
+}
+
+func (h Hooks) Leave(c *Cursor) {
+	if h.LeaveFn != nil {
+		h.LeaveFn(c)
+	}
+}
+
+// A Cursor describes the node that is currently visited and the nodes
+// leading up to it from the root of the walk.
+type Cursor struct {
+	path []Node
+}
+
+// Node returns the current node.
+func (c *Cursor) Node() Node {
+	return c.path[len(c.path)-1]
+}
+
+// Parent returns the parent of the current node, or nil at the root.
+func (c *Cursor) Parent() Node {
+	if len(c.path) < 2 {
+		return nil
+	}
+	return c.path[len(c.path)-2]
+}
+
+// Path returns all nodes from the root up to and including the current
+// node. The slice is only valid during the current Enter or Leave call.
+func (c *Cursor) Path() []Node {
+	return c.path
+}
+
+// Depth returns the number of ancestors of the current node.
+func (c *Cursor) Depth() int {
+	return len(c.path) - 1
+}
+
+// Walk traverses the tree rooted at node depth-first, in source order.
+func Walk(v Visitor, node Node) {
+	if isNil(node) {
+		return
+	}
+	walk(v, &Cursor{}, node)
+}
+
+func walk(v Visitor, c *Cursor, node Node) {
+	c.path = append(c.path, node)
+
+	if v.Enter(c) {
+		for _, child := range Children(node) {
+			walk(v, c, child)
+		}
+		v.Leave(c)
+	}
+
+	c.path = c.path[:len(c.path)-1]
+}
+
+// Inspect traverses the tree rooted at node and calls f for every node in
+// depth-first order. Returning false from f skips the children of a node.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(Hooks{EnterFn: func(c *Cursor) bool { return f(c.Node()) }}, node)
+}
+
+// Children returns the direct children of node in source order. Missing
+// (nil) children are left out.
+func Children(node Node) []Node {
+	children := []Node{}
+	add := func(nodes ...Node) {
+		for _, n := range nodes {
+			if !isNil(n) {
+				children = append(children, n)
+			}
+		}
+	}
+
+	if isNil(node) {
+		return children
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			add(s)
+		}
+
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			add(s)
+		}
+
+	case *ExpressionStatement:
+		add(node.Expression)
+
+	case *ReturnStatement:
+		add(node.ReturnValue)
+
+	case *UseStatement:
+		add(node.Path)
+
+	case *LetStatement:
+		add(node.Name, node.Value)
+
+	case *FunctionStatement:
+		add(node.Name, node.Function)
+
+	case *InfixExpression:
+		add(node.Left, node.Right)
+
+	case *PrefixExpression:
+		add(node.Right)
+
+	case *IndexExpression:
+		add(node.Left, node.Index)
+
+	case *IfExpression:
+		add(node.Condition, node.Consequence, node.Alternative)
+
+	case *CallExpression:
+		add(node.Function)
+		for _, a := range node.Arguments {
+			add(a)
+		}
+
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			add(p)
+		}
+		add(node.Body)
+
+	case *MacroLiteral:
+		for _, p := range node.Parameters {
+			add(p)
+		}
+		add(node.Body)
+
+	case *ArrayLiteral:
+		for _, e := range node.Elements {
+			add(e)
+		}
+
+	case *SetLiteral:
+		for _, e := range node.Elements {
+			add(e)
+		}
+
+	case *HashLiteral:
+		for _, pair := range node.Data {
+			add(pair.Key, pair.Value)
+		}
+	}
+
+	return children
+}
+
+// isNil reports whether node is nil or a typed nil pointer.
+func isNil(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *Program:
+		return node == nil
+	case *BlockStatement:
+		return node == nil
+	case *ExpressionStatement:
+		return node == nil
+	case *ReturnStatement:
+		return node == nil
+	case *UseStatement:
+		return node == nil
+	case *LetStatement:
+		return node == nil
+	case *FunctionStatement:
+		return node == nil
+	case *Identifier:
+		return node == nil
+	case *IntegerLiteral:
+		return node == nil
+	case *BigIntegerLiteral:
+		return node == nil
+	case *StringLiteral:
+		return node == nil
+	case *BytesLiteral:
+		return node == nil
+	case *Boolean:
+		return node == nil
+	case *InfixExpression:
+		return node == nil
+	case *PrefixExpression:
+		return node == nil
+	case *IndexExpression:
+		return node == nil
+	case *IfExpression:
+		return node == nil
+	case *CallExpression:
+		return node == nil
+	case *FunctionLiteral:
+		return node == nil
+	case *MacroLiteral:
+		return node == nil
+	case *ArrayLiteral:
+		return node == nil
+	case *SetLiteral:
+		return node == nil
+	case *HashLiteral:
+		return node == nil
+	default:
+		return false
+	}
+}
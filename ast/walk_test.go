@@ -0,0 +1,136 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func testProgram() *Program {
+	// let add = fn(a, b) { a + b }; add(1, [2][0]);
+	return &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: &Identifier{Value: "add"},
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{{Value: "a"}, {Value: "b"}},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{Expression: &InfixExpression{
+								Left:     &Identifier{Value: "a"},
+								Operator: "+",
+								Right:    &Identifier{Value: "b"},
+							}},
+						},
+					},
+				},
+			},
+			&ExpressionStatement{Expression: &CallExpression{
+				Function: &Identifier{Value: "add"},
+				Arguments: []Expression{
+					&IntegerLiteral{Value: 1},
+					&IndexExpression{
+						Left:  &ArrayLiteral{Elements: []Expression{&IntegerLiteral{Value: 2}}},
+						Index: &IntegerLiteral{Value: 0},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func TestInspect(t *testing.T) {
+	identifiers := []string{}
+	Inspect(testProgram(), func(n Node) bool {
+		if ident, ok := n.(*Identifier); ok {
+			identifiers = append(identifiers, ident.Value)
+		}
+		return true
+	})
+
+	expected := "add a b a b add"
+	if got := strings.Join(identifiers, " "); got != expected {
+		t.Errorf("wrong identifiers visited. got=%q, want=%q", got, expected)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	count := 0
+	Inspect(testProgram(), func(n Node) bool {
+		count++
+		_, isFn := n.(*FunctionLiteral)
+		return !isFn
+	})
+
+	if count != 12 {
+		t.Errorf("wrong number of nodes visited. got=%d, want=%d", count, 12)
+	}
+}
+
+func TestWalkEnterLeave(t *testing.T) {
+	events := []string{}
+	var depth int
+	Walk(Hooks{
+		EnterFn: func(c *Cursor) bool {
+			if _, ok := c.Node().(*InfixExpression); ok {
+				events = append(events, "enter")
+				depth = c.Depth()
+				if _, ok := c.Parent().(*ExpressionStatement); !ok {
+					t.Errorf("wrong parent. got=%T", c.Parent())
+				}
+			}
+			if ident, ok := c.Node().(*Identifier); ok {
+				if _, ok := c.Parent().(*InfixExpression); ok {
+					events = append(events, ident.Value)
+				}
+			}
+			return true
+		},
+		LeaveFn: func(c *Cursor) {
+			if _, ok := c.Node().(*InfixExpression); ok {
+				events = append(events, "leave")
+			}
+		},
+	}, testProgram())
+
+	if got := strings.Join(events, " "); got != "enter a b leave" {
+		t.Errorf("wrong events. got=%q", got)
+	}
+
+	// Program > LetStatement > FunctionLiteral > BlockStatement > ExpressionStatement > InfixExpression
+	if depth != 5 {
+		t.Errorf("wrong depth. got=%d, want=%d", depth, 5)
+	}
+}
+
+func TestWalkPath(t *testing.T) {
+	var path []string
+	Walk(Hooks{EnterFn: func(c *Cursor) bool {
+		if lit, ok := c.Node().(*IntegerLiteral); ok && lit.Value == 2 {
+			for _, n := range c.Path() {
+				path = append(path, strings.TrimPrefix(strings.TrimPrefix(fmt.Sprintf("%T", n), "*"), "ast."))
+			}
+		}
+		return true
+	}}, testProgram())
+
+	expected := "Program ExpressionStatement CallExpression IndexExpression ArrayLiteral IntegerLiteral"
+	if got := strings.Join(path, " "); got != expected {
+		t.Errorf("wrong path. got=%q, want=%q", got, expected)
+	}
+}
+
+func TestChildrenSkipsNil(t *testing.T) {
+	ifExp := &IfExpression{
+		Condition:   &Boolean{Value: true},
+		Consequence: &BlockStatement{},
+	}
+
+	if n := len(Children(ifExp)); n != 2 {
+		t.Errorf("wrong number of children. got=%d, want=%d", n, 2)
+	}
+
+	if n := len(Children((*Program)(nil))); n != 0 {
+		t.Errorf("nil program has children. got=%d", n)
+	}
+}
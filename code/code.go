@@ -48,6 +48,14 @@ const (
 	OpArray
 	OpHash
 	OpIndex
+
+	OpPatchFree
+	OpTailCall
+	OpQuote
+	OpSet
+	OpIn
+	OpIs
+	OpBound
 )
 
 var definitions = map[Opcode]*Definition{
@@ -81,6 +89,13 @@ var definitions = map[Opcode]*Definition{
 	OpArray:          {"OpArray", []int{2}},
 	OpHash:           {"OpHash", []int{2}},
 	OpIndex:          {"OpIndex", []int{}},
+	OpPatchFree:      {"OpPatchFree", []int{1, 1}},
+	OpTailCall:       {"OpTailCall", []int{1}},
+	OpQuote:          {"OpQuote", []int{2, 1}},
+	OpSet:            {"OpSet", []int{2}},
+	OpIn:             {"OpIn", []int{}},
+	OpIs:             {"OpIs", []int{}},
+	OpBound:          {"OpBound", []int{2}},
 }
 
 type Instructions []byte
@@ -12,6 +12,7 @@ func TestMake(t *testing.T) {
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
 		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
 		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpQuote, []int{65534, 2}, []byte{byte(OpQuote), 255, 254, 2}},
 	}
 
 	for _, tt := range tests {
@@ -62,6 +63,7 @@ func TestReadOperands(t *testing.T) {
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
 		{OpClosure, []int{65535, 255}, 3},
+		{OpPatchFree, []int{255, 255}, 2},
 	}
 	for _, tt := range tests {
 		instruction := Make(tt.op, tt.operands...)
@@ -16,11 +16,34 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+
+	// pending holds the locals that are declared up front but not bound
+	// yet, with the free variable slots of closures that captured them.
+	pending map[int][]freePatch
+	// unbound holds the names of the scope that may be read before they
+	// are bound. Reading them is checked at runtime.
+	unbound map[string]bool
+	// shadowed holds the names of the locals whose let is being compiled.
+	// Its value still sees the variables they shadow, only the functions
+	// in it see the new ones.
+	shadowed map[string]bool
+}
+
+// freePatch points to a free variable of a closure stored in a local that
+// has to be filled in once the captured local gets its value.
+type freePatch struct {
+	closure int
+	free    int
 }
 
 type Compiler struct {
 	constants []object.Object
 	symbols   *SymbolTable
+	// builtins holds the names of the registered builtins the code uses,
+	// see Bytecode.Builtins.
+	builtins []string
+	// names holds the constants with the names OpBound reports.
+	names map[string]int
 
 	scopes     []CompilationScope
 	scopeIndex int
@@ -29,17 +52,33 @@ type Compiler struct {
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	// Macros is the source of the macros the program exports, so other
+	// programs can use them from the compiled file.
+	Macros string
+	// Builtins holds the names of the builtins registered with the runtime
+	// the code was compiled for, the ones after object.Builtins, or "" for
+	// those the code doesn't use. The runtime the code runs with has to
+	// have them at the same indexes, see object.Runtime.Check.
+	Builtins []string
 }
 
 func New() *Compiler {
+	return NewWithRuntime(object.DefaultRuntime)
+}
+
+// NewWithRuntime returns a compiler that resolves builtins in rt. The
+// code it compiles has to run in a VM with the same runtime.
+func NewWithRuntime(rt *object.Runtime) *Compiler {
 	mainScope := CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
+		unbound:             map[string]bool{},
+		shadowed:            map[string]bool{},
 	}
 	symbols := NewSymbolTable()
 
-	for i, v := range object.Builtins {
+	for i, v := range rt.Builtins() {
 		symbols.DefineBuiltin(i, v.Name)
 	}
 
@@ -60,7 +99,9 @@ func (c *Compiler) Reset() {
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
-		for _, stmt := range node.Statements {
+		c.predeclare(node.Statements, true)
+
+		for _, stmt := range node.Hoisted() {
 			err := c.Compile(stmt)
 			if err != nil {
 				return err
@@ -68,6 +109,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.BlockStatement:
+		c.predeclare(node.Statements, false)
+
 		for _, stmt := range node.Statements {
 			err := c.Compile(stmt)
 			if err != nil {
@@ -83,21 +126,13 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpPop)
 
 	case *ast.LetStatement:
-		symbol, ok := c.symbols.Resolve(node.Name.Value)
-		if !ok || symbol.Scope != LocalScope {
-			symbol = c.symbols.Define(node.Name.Value)
-		}
+		return c.compileBinding(node.Name.Value, node.Value)
 
-		err := c.Compile(node.Value)
-		if err != nil {
-			return err
-		}
+	case *ast.FunctionStatement:
+		return c.compileBinding(node.Name.Value, node.Function)
 
-		if symbol.Scope == LocalScope {
-			c.emit(code.OpSetLocal, symbol.Index)
-		} else {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		}
+	case *ast.UseStatement:
+		return fmt.Errorf("use %q is only allowed before macro expansion", node.Path.Value)
 
 	case *ast.ReturnStatement:
 		err := c.Compile(node.ReturnValue)
@@ -162,6 +197,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
+		case "in":
+			c.emit(code.OpIn)
+		case "is":
+			c.emit(code.OpIs)
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
@@ -174,14 +213,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		jmpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
 
-		err = c.Compile(node.Consequence)
+		err = c.compileBranch(node.Consequence)
 		if err != nil {
 			return err
 		}
 
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastInstruction()
-		}
+		c.keepBlockValue()
 
 		jumpPos := c.emit(code.OpJump, 9999)
 
@@ -191,14 +228,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
 		} else {
-			err := c.Compile(node.Alternative)
+			err := c.compileBranch(node.Alternative)
 			if err != nil {
 				return err
 			}
 
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastInstruction()
-			}
+			c.keepBlockValue()
 		}
 
 		afterAlternativePos := len(c.scopes[c.scopeIndex].instructions)
@@ -218,6 +253,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpIndex)
 
 	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return c.compileQuote(node)
+		}
+
 		err := c.Compile(node.Function)
 		if err != nil {
 			return err
@@ -236,10 +275,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
 
+	case *ast.BigIntegerLiteral:
+		integer := &object.BigInt{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
 
+	case *ast.BytesLiteral:
+		b := &object.Bytes{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(b))
+
 	case *ast.ArrayLiteral:
 		for _, elem := range node.Elements {
 			err := c.Compile(elem)
@@ -249,6 +296,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpArray, len(node.Elements))
 
+	case *ast.SetLiteral:
+		for _, elem := range node.Elements {
+			err := c.Compile(elem)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSet, len(node.Elements))
+
 	case *ast.HashLiteral:
 		for _, p := range node.Data {
 			err := c.Compile(p.Key)
@@ -263,68 +319,306 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpHash, len(node.Data)*2)
 
 	case *ast.FunctionLiteral:
-		c.enterScope()
+		free, err := c.compileFunctionLiteral(node)
+		if err != nil {
+			return err
+		}
+		c.keepForPatching(free)
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
 
-		if node.Name != "" {
-			c.symbols.DefineFunctionName(node.Name)
+	case *ast.Identifier:
+		if c.scopes[c.scopeIndex].shadowed[node.Value] {
+			if symbol, ok := c.symbols.ResolveOuter(node.Value); ok {
+				c.loadSymbol(symbol)
+				if c.mayBeUnbound(node.Value, c.scopeIndex-1) {
+					c.emit(code.OpBound, c.nameConstant(node.Value))
+				}
+				break
+			}
 		}
 
-		for _, p := range node.Parameters {
-			c.symbols.Define(p.Value)
+		symbol, ok := c.symbols.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("can't get global '%s', it's not defined.", node.Value)
+		}
+		c.loadSymbol(symbol)
+		if c.mayBeUnbound(node.Value, c.scopeIndex) {
+			c.emit(code.OpBound, c.nameConstant(node.Value))
 		}
 
-		err := c.Compile(node.Body)
+	}
+
+	return nil
+}
+
+// keepBlockValue leaves the value of the block just compiled on the stack.
+// Blocks that don't end in an expression have the value null.
+func (c *Compiler) keepBlockValue() {
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastInstruction()
+	} else {
+		c.emit(code.OpNull)
+	}
+}
+
+// compileFunctionLiteral emits the closure for a function literal and
+// returns the symbols it captured as free variables, in order.
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) ([]Symbol, error) {
+	c.enterScope()
+
+	if node.Name != "" {
+		c.symbols.DefineFunctionName(node.Name)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbols.Define(p.Value)
+	}
+
+	err := c.Compile(node.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+
+		c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+		c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+	}
+
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	c.markTailCalls()
+
+	freeSymbols := c.symbols.FreeSymbols
+	numLocals := c.symbols.numDefinitions
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	compiledFunc := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+	}
+
+	c.emit(code.OpClosure, c.addConstant(compiledFunc), len(freeSymbols))
+
+	return freeSymbols, nil
+}
+
+// markTailCalls turns the calls in the current scope whose result is
+// returned right away into tail calls. Following unconditional jumps finds
+// the calls at the end of if branches as well.
+func (c *Compiler) markTailCalls() {
+	ins := c.scopes[c.scopeIndex].instructions
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
 		if err != nil {
-			return err
+			return
 		}
+		_, read := code.ReadOperands(def, ins[i+1:])
+		next := i + 1 + read
 
-		if c.lastInstructionIs(code.OpPop) {
-			lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+		if code.Opcode(ins[i]) == code.OpCall && returnsAt(ins, next) {
+			ins[i] = byte(code.OpTailCall)
+		}
+		i = next
+	}
+}
 
-			c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
-			c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+// returnsAt reports whether execution starting at pos reaches an
+// OpReturnValue without doing anything else. Jumps only ever go forward.
+func returnsAt(ins code.Instructions, pos int) bool {
+	for pos < len(ins) {
+		switch code.Opcode(ins[pos]) {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			pos = int(code.ReadUint16(ins[pos+1:]))
+		default:
+			return false
 		}
+	}
+	return false
+}
+
+// compileBinding compiles a let or function statement. Closures that
+// captured a local before it was bound get patched right after binding it,
+// which lets local functions refer to each other regardless of order.
+func (c *Compiler) compileBinding(name string, value ast.Expression) error {
+	symbol, ok := c.symbols.Own(name)
+	if !ok || (symbol.Scope != LocalScope && symbol.Scope != GlobalScope) {
+		symbol = c.symbols.Define(name)
+		// only functions in the value can see the variable before it's
+		// bound, the value itself sees what the name meant before
+		c.scopes[c.scopeIndex].unbound[name] = true
+		c.scopes[c.scopeIndex].shadowed[name] = true
+	}
+	if _, ok := c.scopes[c.scopeIndex].pending[symbol.Index]; !ok && symbol.Scope == LocalScope {
+		c.scopes[c.scopeIndex].pending[symbol.Index] = nil
+	}
+
+	var free []Symbol
+	var err error
+	if fn, ok := value.(*ast.FunctionLiteral); ok {
+		free, err = c.compileFunctionLiteral(fn)
+	} else {
+		err = c.Compile(value)
+	}
+	if err != nil {
+		return err
+	}
+
+	delete(c.scopes[c.scopeIndex].unbound, name)
+	delete(c.scopes[c.scopeIndex].shadowed, name)
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+		return nil
+	}
+
+	c.emit(code.OpSetLocal, symbol.Index)
+	c.patchLater(symbol.Index, free)
 
-		if !c.lastInstructionIs(code.OpReturnValue) {
-			c.emit(code.OpReturn)
+	pending := c.scopes[c.scopeIndex].pending
+	if patches, ok := pending[symbol.Index]; ok {
+		for _, p := range patches {
+			c.emit(code.OpGetLocal, symbol.Index)
+			c.emit(code.OpPatchFree, p.closure, p.free)
 		}
+		delete(pending, symbol.Index)
+	}
 
-		freeSymbols := c.symbols.FreeSymbols
-		numLocals := c.symbols.numDefinitions
-		instructions := c.leaveScope()
+	return nil
+}
 
-		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+// patchLater remembers to patch the closure in the local closure once the
+// locals it captured before they were bound get their values.
+func (c *Compiler) patchLater(closure int, free []Symbol) {
+	pending := c.scopes[c.scopeIndex].pending
+	for i, s := range free {
+		if _, ok := pending[s.Index]; ok && s.Scope == LocalScope {
+			pending[s.Index] = append(pending[s.Index], freePatch{closure: closure, free: i})
 		}
+	}
+}
+
+// keepForPatching stores the closure on top of the stack, which isn't
+// bound by a let, in a local of its own if it captured locals that aren't
+// bound yet, so it can be patched like the others.
+func (c *Compiler) keepForPatching(free []Symbol) {
+	pending := c.scopes[c.scopeIndex].pending
+	for _, s := range free {
+		if _, ok := pending[s.Index]; !ok || s.Scope != LocalScope {
+			continue
+		}
+		// the name can't be written in a program
+		local := c.symbols.Define(fmt.Sprintf("<closure %d>", c.symbols.numDefinitions))
+		c.emit(code.OpSetLocal, local.Index)
+		c.emit(code.OpGetLocal, local.Index)
+		c.patchLater(local.Index, free)
+		return
+	}
+}
 
-		compiledFunc := &object.CompiledFunction{
-			Instructions:  instructions,
-			NumLocals:     numLocals,
-			NumParameters: len(node.Parameters),
+// predeclare defines the names of all functions bound in stmts before any
+// of them is compiled, so they can be referenced before their definition.
+// With lets it also defines the names other lets bind, the way globals
+// are seen by all functions of a program.
+func (c *Compiler) predeclare(stmts []ast.Statement, lets bool) {
+	for _, stmt := range stmts {
+		var name string
+		switch stmt := stmt.(type) {
+		case *ast.FunctionStatement:
+			name = stmt.Name.Value
+		case *ast.LetStatement:
+			if _, ok := stmt.Value.(*ast.FunctionLiteral); !ok && !lets {
+				continue
+			}
+			name = stmt.Name.Value
+		default:
+			continue
 		}
 
-		c.emit(code.OpClosure, c.addConstant(compiledFunc), len(freeSymbols))
+		symbol, ok := c.symbols.Own(name)
+		if !ok || (symbol.Scope != LocalScope && symbol.Scope != GlobalScope) {
+			symbol = c.symbols.Define(name)
+		}
 
-	case *ast.Boolean:
-		if node.Value {
-			c.emit(code.OpTrue)
-		} else {
-			c.emit(code.OpFalse)
+		c.scopes[c.scopeIndex].unbound[name] = true
+		if symbol.Scope == LocalScope {
+			c.scopes[c.scopeIndex].pending[symbol.Index] = nil
 		}
+	}
+}
 
-	case *ast.Identifier:
-		symbol, ok := c.symbols.Resolve(node.Value)
-		if !ok {
-			return fmt.Errorf("can't get global '%s', it's not defined.", node.Value)
+// mayBeUnbound reports whether the variable name refers to in the scope
+// at scopeIndex may be read before it is bound.
+func (c *Compiler) mayBeUnbound(name string, scopeIndex int) bool {
+	table := c.symbols
+	for i := c.scopeIndex; i > scopeIndex; i-- {
+		table = table.outer
+	}
+	for i := scopeIndex; i >= 0 && table != nil; i-- {
+		if symbol, ok := table.Own(name); ok {
+			switch symbol.Scope {
+			case LocalScope, GlobalScope:
+				return c.scopes[i].unbound[name]
+			case FreeScope:
+				// captured from an outer scope, which knows
+			default:
+				return false
+			}
 		}
-		c.loadSymbol(symbol)
+		table = table.outer
+	}
+	return false
+}
 
+// compileBranch compiles a block that may not run. What it binds may still
+// be unbound after it, and the locals it binds may need patching later.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	scope := &c.scopes[c.scopeIndex]
+	unbound := make(map[string]bool, len(scope.unbound))
+	for name := range scope.unbound {
+		unbound[name] = true
+	}
+	pending := make(map[int][]freePatch, len(scope.pending))
+	for index, patches := range scope.pending {
+		pending[index] = patches
+	}
+	defined := make(map[string]bool, len(c.symbols.store))
+	for name := range c.symbols.store {
+		defined[name] = true
 	}
 
-	return nil
+	err := c.Compile(block)
+
+	for name, symbol := range c.symbols.store {
+		if !defined[name] && (symbol.Scope == LocalScope || symbol.Scope == GlobalScope) {
+			unbound[name] = true
+		}
+	}
+	for index, patches := range c.scopes[c.scopeIndex].pending {
+		pending[index] = patches
+	}
+	c.scopes[c.scopeIndex].unbound = unbound
+	c.scopes[c.scopeIndex].pending = pending
+	return err
 }
 
-func (c Compiler) loadSymbol(s Symbol) {
+func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
 		c.emit(code.OpGetGlobal, s.Index)
@@ -332,6 +626,12 @@ func (c Compiler) loadSymbol(s Symbol) {
 		c.emit(code.OpGetLocal, s.Index)
 	case BuiltinScope:
 		c.emit(code.OpGetBuiltin, s.Index)
+		if i := s.Index - len(object.Builtins); i >= 0 {
+			for len(c.builtins) <= i {
+				c.builtins = append(c.builtins, "")
+			}
+			c.builtins[i] = s.Name
+		}
 	case FreeScope:
 		c.emit(code.OpGetFree, s.Index)
 	case FunctionScope:
@@ -339,11 +639,48 @@ func (c Compiler) loadSymbol(s Symbol) {
 	}
 }
 
+// compileQuote stores the quoted code as a constant and compiles the
+// arguments of its unquote calls, OpQuote puts their values into a copy of
+// it at runtime.
+func (c *Compiler) compileQuote(call *ast.CallExpression) error {
+	if len(call.Arguments) != 1 {
+		return fmt.Errorf("quote takes 1 argument, got %d", len(call.Arguments))
+	}
+	template := call.Arguments[0]
+
+	unquoted := object.UnquoteCalls(template)
+	for _, u := range unquoted {
+		if err := c.Compile(u.Arguments[0]); err != nil {
+			return err
+		}
+	}
+
+	if len(unquoted) > 255 {
+		return fmt.Errorf("too many unquote calls in quote: %d", len(unquoted))
+	}
+
+	c.emit(code.OpQuote, c.addConstant(&object.Quote{Node: template}), len(unquoted))
+	return nil
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
 }
 
+// nameConstant returns the index of the string constant name, which is
+// only added once.
+func (c *Compiler) nameConstant(name string) int {
+	if i, ok := c.names[name]; ok {
+		return i
+	}
+	if c.names == nil {
+		c.names = map[string]int{}
+	}
+	c.names[name] = c.addConstant(&object.String{Value: name})
+	return c.names[name]
+}
+
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
@@ -391,6 +728,7 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.scopes[c.scopeIndex].instructions,
 		Constants:    c.constants,
+		Builtins:     c.builtins,
 	}
 }
 
@@ -399,6 +737,9 @@ func (c *Compiler) enterScope() {
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
+		pending:             map[int][]freePatch{},
+		unbound:             map[string]bool{},
+		shadowed:            map[string]bool{},
 	}
 	c.scopes = append(c.scopes, scope)
 	c.scopeIndex++
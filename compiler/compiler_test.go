@@ -1,6 +1,7 @@
 package compiler
 
 import (
+	"encoding/json"
 	"fmt"
 	"monkey/ast"
 	"monkey/code"
@@ -10,6 +11,9 @@ import (
 	"testing"
 )
 
+// quoted is an expected quote constant, the String() of its code.
+type quoted string
+
 type compilerTestCase struct {
 	input                string
 	expectedConstants    []interface{}
@@ -426,6 +430,34 @@ func TestHashLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestSetLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "#{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpSet, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 in #{2, 3 + 4}",
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSet, 2),
+				code.Make(code.OpIn),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -720,7 +752,7 @@ func TestBuiltins(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpGetBuiltin, 0),
 					code.Make(code.OpArray, 0),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -869,7 +901,7 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1,
@@ -898,7 +930,7 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1,
@@ -907,22 +939,282 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpSetLocal, 0),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 2),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(f) { if (true) { f(1) } else { 1 + f(2) } }`,
+			expectedConstants: []interface{}{
+				1,
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpTrue),
+					code.Make(code.OpJumpNotTruthy, 14),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpJump, 25),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 2),
 					code.Make(code.OpCall, 1),
+					code.Make(code.OpAdd),
 					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(f) { let x = f(); return f(x); }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestForwardReferences(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+            main();
+            fn main() { 1 }
+            `,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpCall, 0),
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input: `
+            fn() {
+                let a = fn() { b() };
+                let b = fn() { a() };
+            }
+            `,
+			expectedConstants: []interface{}{
+				"b",
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpBound, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpPatchFree, 0, 0),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+            fn() {
+                let fs = [fn() { b() }];
+                let b = fn() { 1 };
+            }
+            `,
+			expectedConstants: []interface{}{
+				"b",
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpBound, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpArray, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpClosure, 3, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpPatchFree, 2, 0),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 4, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the name is stored once for all checks
+			input: `
+            let f = fn() { [x, x, x] };
+            let x = 1;
+            `,
+			expectedConstants: []interface{}{
+				"x",
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 1),
+					code.Make(code.OpBound, 0),
+					code.Make(code.OpGetGlobal, 1),
+					code.Make(code.OpBound, 0),
+					code.Make(code.OpGetGlobal, 1),
+					code.Make(code.OpBound, 0),
+					code.Make(code.OpArray, 3),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
 
+func TestQuote(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `quote(1 + x)`,
+			expectedConstants: []interface{}{quoted("(1 + x)")},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpQuote, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+            let x = 1;
+            quote(f(unquote(x), unquote_splice([2]), unquote(quote(unquote(x)))))
+            `,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				quoted("unquote(x)"),
+				quoted("f(unquote(x), unquote_splice([2]), unquote(quote(unquote(x))))"),
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpQuote, 2, 1),
+				code.Make(code.OpQuote, 3, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompileProgramFromJSON(t *testing.T) {
+	input := `
+    let map = fn(arr, f) {
+        let iter = fn(arr, acc) {
+            if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) }
+        };
+        iter(arr, []);
+    };
+    map([1, 2, 3], fn(x) { x * 2 })[0] + {"a": -1}["a"];
+    fn helper() { return !true != false; }
+    "done"
+    `
+
+	program := parse(input)
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+
+	var decoded ast.Program
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+
+	if decoded.String() != program.String() {
+		t.Fatalf("decoded program differs.\nwant=%q\ngot =%q", program.String(), decoded.String())
+	}
+
+	expected := New()
+	if err := expected.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	actual := New()
+	if err := actual.Compile(&decoded); err != nil {
+		t.Fatalf("compiler error on decoded program: %s", err)
+	}
+
+	if actual.Bytecode().Instructions.String() != expected.Bytecode().Instructions.String() {
+		t.Errorf("instructions differ.\nwant=%s\ngot =%s",
+			expected.Bytecode().Instructions, actual.Bytecode().Instructions)
+	}
+}
+
 // TESTS ABOVE
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
@@ -990,6 +1282,16 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 					i, err)
 			}
 
+		case quoted:
+			quote, ok := actual[i].(*object.Quote)
+			if !ok {
+				return fmt.Errorf("constant %d - not a quote: %T", i, actual[i])
+			}
+			if quote.Node.String() != string(constant) {
+				return fmt.Errorf("constant %d - wrong quote. want=%q, got=%q",
+					i, constant, quote.Node.String())
+			}
+
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -73,6 +73,12 @@ func (t *SymbolTable) defineFree(orig Symbol) Symbol {
 	return symbol
 }
 
+// Own looks up name in this table only, without consulting outer scopes.
+func (t *SymbolTable) Own(name string) (Symbol, bool) {
+	s, ok := t.store[name]
+	return s, ok
+}
+
 func (t *SymbolTable) Resolve(name string) (Symbol, bool) {
 	s, ok := t.store[name]
 	if ok || t.outer == nil {
@@ -87,3 +93,26 @@ func (t *SymbolTable) Resolve(name string) (Symbol, bool) {
 	free := t.defineFree(s)
 	return free, true
 }
+
+// ResolveOuter resolves name as if this table didn't define it, the way
+// the value of a let sees the variable the let shadows.
+func (t *SymbolTable) ResolveOuter(name string) (Symbol, bool) {
+	if t.outer == nil {
+		return Symbol{}, false
+	}
+
+	s, ok := t.outer.Resolve(name)
+	if !ok || s.Scope == GlobalScope || s.Scope == BuiltinScope {
+		return s, ok
+	}
+
+	// the name is taken by the local, so the free symbol is only found by
+	// the variable it captures
+	for i, free := range t.FreeSymbols {
+		if free == s {
+			return Symbol{Name: name, Scope: FreeScope, Index: i}, true
+		}
+	}
+	t.FreeSymbols = append(t.FreeSymbols, s)
+	return Symbol{Name: name, Scope: FreeScope, Index: len(t.FreeSymbols) - 1}, true
+}
@@ -1,15 +1,17 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"monkey/ast"
 	"monkey/object"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -28,10 +30,31 @@ func isError(obj object.Object) bool {
 	return obj != nil && obj.Type() == object.ERROR_OBJ
 }
 
+// EvalContext evaluates node in env like Eval, but stops once ctx is done
+// or the program exceeds limits. A program exceeding its limits returns a
+// *object.LimitError, a cancelled one the error of ctx.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits object.Limits) (object.Object, error) {
+	budget, cancel := object.NewBudget(ctx, limits)
+	defer cancel()
+
+	defer env.SetBudget(env.Budget())
+	env.SetBudget(budget)
+
+	result := Eval(node, env)
+	if err := budget.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := env.Budget().Step(); err != nil {
+		return newError("%s", err)
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node.Statements, env)
+		return evalProgram(node.Hoisted(), env)
 
 	case *ast.BlockStatement:
 		return evalBlockStatement(node.Statements, env)
@@ -46,6 +69,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		env.Set(node.Name.Value, val)
 
+	case *ast.FunctionStatement:
+		env.Set(node.Name.Value, Eval(node.Function, env))
+
+	case *ast.UseStatement:
+		return newError("use %q is only allowed before macro expansion", node.Path.Value)
+
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
@@ -73,14 +102,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return checkSize(applyFunction(function, args, env), env)
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return checkSize(object.NewArray(elements), env)
+
+	case *ast.SetLiteral:
+		return checkSize(evalSetLiteral(node, env), env)
 
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
@@ -95,7 +127,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIndexExpression(left, index)
 
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return checkSize(evalHashLiteral(node, env), env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
@@ -105,9 +137,15 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.BigIntegerLiteral:
+		return &object.BigInt{Value: node.Value}
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	case *ast.BytesLiteral:
+		return &object.Bytes{Value: node.Value}
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
@@ -129,7 +167,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return checkSize(evalInfixExpression(node.Operator, left, right, env.Budget()), env)
 
 	default:
 		return newError("Can't EVAL NODE: %s", node.String())
@@ -138,6 +176,15 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	return nil
 }
 
+// checkSize replaces a collection that is larger than the budget allows
+// with an error.
+func checkSize(obj object.Object, env *object.Environment) object.Object {
+	if err := env.Budget().CheckSize(obj); err != nil {
+		return newError("%s", err)
+	}
+	return obj
+}
+
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	hash := object.NewHash()
 
@@ -147,7 +194,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 			return key
 		}
 
-		hashableKey, ok := key.(object.Hashable)
+		hashableKey, ok := object.AsHashable(key)
 		if !ok {
 			return newError("unusable as hash key: %s", key.Type())
 		}
@@ -163,6 +210,26 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	return &hash
 }
 
+func evalSetLiteral(node *ast.SetLiteral, env *object.Environment) object.Object {
+	set := object.NewSet()
+
+	for _, e := range node.Elements {
+		elem := Eval(e, env)
+		if isError(elem) {
+			return elem
+		}
+
+		hashableElem, ok := object.AsHashable(elem)
+		if !ok {
+			return newError("unusable as set element: %s", elem.Type())
+		}
+
+		set.Add(hashableElem)
+	}
+
+	return &set
+}
+
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
@@ -179,14 +246,19 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ:
-		if index.Type() != object.INTEGER_OBJ {
+		if !object.IsInteger(index) {
 			return newError("index must be of type integer, got: %s", index.Type())
 		}
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.BYTES_OBJ:
+		if !object.IsInteger(index) {
+			return newError("index must be of type integer, got: %s", index.Type())
+		}
+		return evalBytesIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
-		hashableIdx, ok := index.(object.Hashable)
+		hashableIdx, ok := object.AsHashable(index)
 		if !ok {
-			return newError("Index must be of type integer, string or boolean, got: %s", index.Type())
+			return newError("Index must be of type integer, string, boolean or array, got: %s", index.Type())
 		}
 		if val, ok := left.(*object.Hash).Get(hashableIdx); ok {
 			return val
@@ -200,32 +272,170 @@ func evalIndexExpression(left, index object.Object) object.Object {
 
 func evalArrayIndexExpression(left, index object.Object) object.Object {
 	array := left.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(array.Elements) - 1)
+	// big integers are out of range
+	i, ok := index.(*object.Integer)
+	if !ok {
+		return NULL
+	}
+	idx := i.Value
+	max := int64(array.Len() - 1)
 
 	if idx < 0 || idx > max {
 		return NULL
 	}
 
-	return array.Elements[idx]
+	return array.At(int(idx))
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	switch fn := fn.(type) {
-	case *object.Function:
-		if len(args) != len(fn.Parameters) {
-			return newError("wrong amount of arguments. got %d, need %d", len(args), len(fn.Parameters))
-		}
-		funcEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, funcEnv)
-		return unwrapReturnValue(evaluated)
-	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
-			return result
-		}
+func evalBytesIndexExpression(left, index object.Object) object.Object {
+	value := left.(*object.Bytes).Value
+	i, ok := index.(*object.Integer)
+	if !ok || i.Value < 0 || i.Value >= int64(len(value)) {
 		return NULL
+	}
+
+	return &object.Integer{Value: int64(value[i.Value])}
+}
+
+// applyFunction calls fn from env. Calls in tail position of a function
+// body come back as a tailCall and are run in the same loop, so tail
+// recursion uses constant stack.
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
+	if f, ok := fn.(*object.Function); ok {
+		budget := f.Env.Budget()
+		if err := budget.Enter(); err != nil {
+			return newError("%s", err)
+		}
+		defer budget.Leave()
+	}
+
+	for {
+		switch f := fn.(type) {
+		case *object.Function:
+			if len(args) != len(f.Parameters) {
+				return newError("wrong amount of arguments. got %d, need %d", len(args), len(f.Parameters))
+			}
+			funcEnv := extendFunctionEnv(f, args)
+			evaluated := unwrapReturnValue(evalTail(f.Body, funcEnv))
+
+			tc, ok := evaluated.(*tailCall)
+			if !ok {
+				if evaluated == nil {
+					return NULL
+				}
+				return evaluated
+			}
+			fn, args = tc.fn, tc.args
+		case *object.Builtin:
+			if result := f.Call(env.Budget(), args...); result != nil {
+				return result
+			}
+			return NULL
+		default:
+			return newError("not a function: %s", fn.Type())
+		}
+	}
+}
+
+// tailCall is a call in tail position that hasn't been made yet. It never
+// leaves applyFunction.
+type tailCall struct {
+	fn   object.Object
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// evalTail evaluates node like Eval, but returns a tailCall instead of
+// making the call if node ends in one.
+func evalTail(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		if len(node.Statements) == 0 {
+			return nil
+		}
+		last := len(node.Statements) - 1
+		for _, stmt := range node.Statements[:last] {
+			result := evalReturning(stmt, env)
+			if result == nil {
+				continue
+			}
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+		return evalTail(node.Statements[last], env)
+
+	case *ast.ExpressionStatement:
+		return evalTail(node.Expression, env)
+
+	case *ast.ReturnStatement:
+		val := evalTail(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.IfExpression:
+		cond := Eval(node.Condition, env)
+		if isError(cond) {
+			return cond
+		}
+
+		var result object.Object = NULL
+		if isTruthy(cond) {
+			result = evalTail(node.Consequence, env)
+		} else if node.Alternative != nil {
+			result = evalTail(node.Alternative, env)
+		}
+
+		if result == nil {
+			return NULL
+		}
+		return result
+
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return Eval(node, env)
+		}
+
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+
+		return &tailCall{fn: function, args: args}
+
+	default:
+		return Eval(node, env)
+	}
+}
+
+// evalReturning evaluates a statement before the last one of a body. A
+// return in it is in tail position too, so statements that can return
+// are evaluated with evalTail and only a call they end in without
+// returning is made here.
+func evalReturning(stmt ast.Statement, env *object.Environment) object.Object {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement:
+		return evalTail(stmt, env)
+	case *ast.ExpressionStatement:
+		if _, ok := stmt.Expression.(*ast.IfExpression); !ok {
+			return Eval(stmt, env)
+		}
+		result := evalTail(stmt, env)
+		if tc, ok := result.(*tailCall); ok {
+			return applyFunction(tc.fn, tc.args, env)
+		}
+		return result
 	default:
-		return newError("not a function: %s", fn.Type())
+		return Eval(stmt, env)
 	}
 }
 
@@ -244,8 +454,8 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
-		return builtin
+	if i, ok := env.Runtime().Index(node.Value); ok {
+		return builtins(env)[i]
 	}
 
 	return newError("identifier not found: " + node.Value)
@@ -274,13 +484,17 @@ func evalIfExpression(condition ast.Expression, consequence *ast.BlockStatement,
 		return cond
 	}
 
+	var result object.Object = NULL
 	if isTruthy(cond) {
-		return Eval(consequence, env)
+		result = Eval(consequence, env)
 	} else if alternative != nil {
-		return Eval(alternative, env)
+		result = Eval(alternative, env)
 	}
 
-	return NULL
+	if result == nil {
+		return NULL
+	}
+	return result
 }
 
 func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
@@ -327,16 +541,22 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	}
 }
 
-func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+func evalInfixExpression(operator string, left object.Object, right object.Object, budget *object.Budget) object.Object {
 	switch {
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+	case operator == "in":
+		return evalInExpression(left, right)
+	case operator == "is":
+		return nativeBoolToBooleanObject(object.Identical(left, right))
+	case object.IsInteger(left) && object.IsInteger(right):
+		return evalIntegerInfixExpression(operator, left, right, budget)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case left.Type() == object.BYTES_OBJ && right.Type() == object.BYTES_OBJ:
+		return evalBytesInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -346,6 +566,14 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 	}
 }
 
+func evalInExpression(elem, container object.Object) object.Object {
+	found, err := object.Contains(container, elem)
+	if err != nil {
+		return newError("%s", err)
+	}
+	return nativeBoolToBooleanObject(found)
+}
+
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
@@ -361,27 +589,34 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	}
 }
 
-func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-
+func evalBytesInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Bytes).Value
+	rightVal := right.(*object.Bytes).Value
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		value := make([]byte, 0, len(leftVal)+len(rightVal))
+		return &object.Bytes{Value: append(append(value, leftVal...), rightVal...)}
 	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
+		return nativeBoolToBooleanObject(bytes.Equal(leftVal, rightVal))
 	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
+		return nativeBoolToBooleanObject(!bytes.Equal(leftVal, rightVal))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(operator string, left object.Object, right object.Object, budget *object.Budget) object.Object {
+	switch operator {
+	case "+", "-", "*", "/":
+		return object.IntegerArithmetic(budget, operator, left, right)
+	case "==":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) != 0)
 	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) < 0)
 	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) > 0)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -399,10 +634,9 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	if !object.IsInteger(right) {
 		return newError("unknown operator: -%s", right.Type())
 	}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return object.NegateInteger(right)
 }
@@ -1,10 +1,14 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -57,6 +61,88 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		typ      object.ObjectType
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808", object.BIGINT_OBJ},
+		{"-9223372036854775807 - 2", "-9223372036854775809", object.BIGINT_OBJ},
+		{"-9223372036854775808", "-9223372036854775808", object.INTEGER_OBJ},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808", object.BIGINT_OBJ},
+		{"4294967296 * 4294967296", "18446744073709551616", object.BIGINT_OBJ},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808", object.BIGINT_OBJ},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807", object.INTEGER_OBJ},
+		{"123456789012345678901234567890 / 10", "12345678901234567890123456789", object.BIGINT_OBJ},
+		{"-123456789012345678901234567890 / 1234567890123456789012345678", "-100", object.INTEGER_OBJ},
+		{"9223372036854775808 > 9223372036854775807", "true", object.BOOLEAN_OBJ},
+		{"1 < 9223372036854775808", "true", object.BOOLEAN_OBJ},
+		{"9223372036854775808 == 9223372036854775807 + 1", "true", object.BOOLEAN_OBJ},
+		{"9223372036854775808 != 1", "true", object.BOOLEAN_OBJ},
+		{"{9223372036854775808: 1}[9223372036854775807 + 1]", "1", object.INTEGER_OBJ},
+		{"[1, 2][9223372036854775808]", "null", object.NULL_OBJ},
+		{`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(25)`,
+			"15511210043330985984000000", object.BIGINT_OBJ},
+		{`9223372036854775808 + "a"`, "ERROR: type mismatch: BIGINT + STRING", object.ERROR_OBJ},
+		{"1 / 0", "ERROR: division by zero", object.ERROR_OBJ},
+		{"(9223372036854775807 * 2) / 0", "ERROR: division by zero", object.ERROR_OBJ},
+		{"(9223372036854775807 * 2) / (9223372036854775808 - 9223372036854775808)", "ERROR: division by zero", object.ERROR_OBJ},
+		{`quote(unquote(9223372036854775807 + 1))`, "QUOTE(9223372036854775808)", object.QUOTE_OBJ},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Type() != tt.typ || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s (%s), got=%s (%s)",
+				tt.input, tt.expected, tt.typ, evaluated.Inspect(), evaluated.Type())
+		}
+	}
+}
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`b"a\x00\xff"`, `b"a\x00\xff"`},
+		{`b"ab" + b"\x01"`, `b"ab\x01"`},
+		{`b"ab" == b"ab"`, "true"},
+		{`b"ab" != b"ab"`, "false"},
+		{`b"ab" == "ab"`, "false"},
+		{`b"a\xff"[1]`, "255"},
+		{`b"a"[1]`, "null"},
+		{`b"a"[-1]`, "null"},
+		{`len(b"\x00\x01")`, "2"},
+		{`bytes("ü")`, `b"\xc3\xbc"`},
+		{`bytes([104, 105])`, `b"hi"`},
+		{`bytes([256])`, "ERROR: can't make bytes of [256], elements must be integers from 0 to 255"},
+		{`bytes([1, "a"])`, `ERROR: can't make bytes of [1, "a"], elements must be integers from 0 to 255`},
+		{`string(b"\xc3\xbc")`, "ü"},
+		{`string(b"\xff")`, `ERROR: b"\xff" is not valid UTF-8`},
+		{`slice(b"abcdef", 1, 3)`, `b"bc"`},
+		{`slice(b"abcdef", -5, 99)`, `b"abcdef"`},
+		{`slice(b"abcdef", 4, 2)`, `b""`},
+		{`encode(b"\x00\xff", "hex")`, "00ff"},
+		{`encode("hi", "base64")`, "aGk="},
+		{`decode("00ff", "hex")`, `b"\x00\xff"`},
+		{`decode("aGk=", "base64")`, `b"hi"`},
+		{`decode("0", "hex")`, `ERROR: can't decode "0" as hex: encoding/hex: odd length hex string`},
+		{`encode(b"", "rot")`, `ERROR: unknown encoding: "rot"`},
+		{`{b"k": 1}[b"k"]`, "1"},
+		{`{b"k": 1}["k"]`, "null"},
+		{`b"a" - b"b"`, "ERROR: unknown operator: BYTES - BYTES"},
+		{`quote(unquote(b"\x00"))`, `QUOTE(b"\x00")`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -136,6 +222,8 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) { }", nil},
+		{"let a = if (true) { let b = 1; }; a", nil},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -227,7 +315,11 @@ func TestErrorHandling(t *testing.T) {
 		},
 		{
 			`{"name": "Monkey"}[fn(x) { x }];`,
-			"Index must be of type integer, string or boolean, got: FUNCTION",
+			"Index must be of type integer, string, boolean or array, got: FUNCTION",
+		},
+		{
+			`{[1, fn(x) { x }]: 1}`,
+			"unusable as hash key: ARRAY",
 		},
 	}
 	for _, tt := range tests {
@@ -307,6 +399,86 @@ func TestClosures(t *testing.T) {
 	testIntegerObject(t, testEval(input), 4)
 }
 
+func TestForwardReferences(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"main(); fn main() { 5 }", 5},
+		{"fn a() { b() } fn b() { 7 } a()", 7},
+		{`
+        let outer = fn() {
+            let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+            let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+            if (isEven(10)) { 1 } else { 0 }
+        };
+        outer();`, 1},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestUnboundLocals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn() { let fs = [fn() { b() }]; let b = fn() { 1 }; fs[0]() }()`, "1"},
+		{`fn() { let h = {"f": fn() { b() }}; let b = fn() { 2 }; h["f"]() }()`, "2"},
+		{`let f = fn() { x }; let x = 5; f()`, "5"},
+		{`fn() { let a = fn() { b() }; a(); let b = fn() { 1 }; }()`, "ERROR: identifier not found: b"},
+		{`fn() { let fs = [fn() { b() }]; fs[0](); let b = fn() { 1 }; }()`, "ERROR: identifier not found: b"},
+		{`let f = fn() { x }; f(); let x = 5;`, "ERROR: identifier not found: x"},
+		{`if (false) { let y = 1 }; y`, "ERROR: identifier not found: y"},
+		{`fn() { if (false) { let y = 1 }; y }()`, "ERROR: identifier not found: y"},
+		{`if (true) { let y = 1 }; y`, "1"},
+		// the value of a let sees the variable it shadows
+		{`let x = 1; let f = fn() { let x = x + 1; x }; f()`, "2"},
+		{`fn(x) { fn() { let x = x * 2; let g = fn() { x }; g() }() }(21)`, "42"},
+		{`fn() { let y = 3; fn() { let y = [y, fn() { y }]; y[1]()[0] }() }()`, "3"},
+		{`fn() { let x = x; x }()`, "ERROR: identifier not found: x"},
+	}
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+        let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } };
+        loop(1000000, 0);`, 1000000},
+		{`
+        let loop = fn(n) { if (n == 0) { return 7; } return loop(n - 1); };
+        loop(1000000);`, 7},
+		{`
+        fn isEven(n) { if (n == 0) { 1 } else { isOdd(n - 1) } }
+        fn isOdd(n) { if (n == 0) { 0 } else { isEven(n - 1) } }
+        isEven(100001);`, 0},
+		{`
+        let loop = fn(n) { if (n > 0) { return loop(n - 1); } 7 };
+        loop(1000000);`, 7},
+		{`
+        let loop = fn(n) { if (n > 0) { if (n > 1) { return loop(n - 2); } return loop(n - 1); } let done = 7; done };
+        loop(1000001);`, 7},
+		{`
+        let count = fn(n) { if (n > 0) { count(n - 1) } 7 };
+        count(100);`, 7},
+		{`
+        let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } };
+        sum(100);`, 5050},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 	evaluated := testEval(input)
@@ -339,11 +511,14 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len(1)`, "argument to `len` must be ARRAY, STRING, BYTES or SET, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 		{"len([1,2,3])", 3},
 		{"first([1,2,3])", 1},
 		{"last([1,2,3])", 3},
+		{"len(pop([1,2,3]))", 2},
+		{`push(1)`, "wrong number of arguments. got=1, want=2"},
+		{`first("one")`, "argument to `first` must be ARRAY, got STRING"},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -372,13 +547,13 @@ func TestArrayLiterals(t *testing.T) {
 	if !ok {
 		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
 	}
-	if len(result.Elements) != 3 {
+	if result.Len() != 3 {
 		t.Fatalf("array has wrong num of elements. got=%d",
-			len(result.Elements))
+			result.Len())
 	}
-	testIntegerObject(t, result.Elements[0], 1)
-	testIntegerObject(t, result.Elements[1], 4)
-	testIntegerObject(t, result.Elements[2], 6)
+	testIntegerObject(t, result.At(0), 1)
+	testIntegerObject(t, result.At(1), 4)
+	testIntegerObject(t, result.At(2), 6)
 }
 
 func TestArrayIndexExpressions(t *testing.T) {
@@ -473,6 +648,158 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 3: 3, true: 4}`, `{b : 1, a : 2, 3 : 3, true : 4}`},
+		{`{"a": 1, "b": 2, "a": 3}`, `{a : 3, b : 2}`},
+		{`keys({"z": 1, "y": 2, "x": 3})`, `[z, y, x]`},
+		{`values({"z": 1, "y": 2, "x": 3})`, `[1, 2, 3]`},
+		{`keys({})`, `[]`},
+		{`keys([])`, "ERROR: argument to `keys` must be HASH, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, `[a, b, , c]`},
+		{`split("héllo", "")`, `[h, é, l, l, o]`},
+		{`join(["a", "b", "c"], "-")`, `a-b-c`},
+		{`join([], "-")`, ``},
+		{`join(["a", 1], "-")`, "ERROR: elements joined by `join` must be STRING, got INTEGER"},
+		{`trim("  a b  ")`, `a b`},
+		{`trim_left("  a ")`, `a `},
+		{`trim_right("  a ")`, `  a`},
+		{`upper("héllo")`, `HÉLLO`},
+		{`lower("ÄB")`, `äb`},
+		{`contains("monkey", "key")`, `true`},
+		{`starts_with("monkey", "mon")`, `true`},
+		{`ends_with("monkey", "mon")`, `false`},
+		{`index_of("héllo", "l")`, `2`},
+		{`index_of("hello", "z")`, `-1`},
+		{`replace("a.b.c", ".", "::")`, `a::b::c`},
+		{`replace("abc", "", "x")`, "ERROR: can't replace an empty string"},
+		{`repeat("ab", 3)`, `ababab`},
+		{`repeat("ab", -1)`, "ERROR: can't repeat a string -1 times"},
+		{`pad_left("7", 3, "0")`, `007`},
+		{`pad_left("é", 4, "ab")`, `abaé`},
+		{`pad_right("abc", 2, " ")`, `abc`},
+		{`pad_right("a", 3, "")`, "ERROR: can't pad with an empty string"},
+		{`chars("añb")`, `[a, ñ, b]`},
+		{`chars("")`, `[]`},
+		// len counts bytes, the text builtins count characters
+		{`len("é")`, `2`},
+		{`len(chars("é"))`, `1`},
+		{`index_of("éa", "a")`, `1`},
+		{`len(pad_left("é", 2, "-"))`, `3`},
+		{`upper(1)`, "ERROR: argument to `upper` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestRuntimeBuiltins(t *testing.T) {
+	rt := object.NewRuntime()
+	if err := rt.Register("duplicate", strings.Repeat); err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+
+	env := object.NewEnvironment()
+	env.SetRuntime(rt)
+	program := parser.New(lexer.New(`let twice = fn(s) { duplicate(s, 2) }; twice("ab") + eval_quote(quote(duplicate("c", 3)))`)).ParseProgram()
+	if result := Eval(program, env); result.Inspect() != "ababccc" {
+		t.Errorf("wrong result. got=%q", result.Inspect())
+	}
+
+	if result := testEval(`duplicate("a", 2)`); result.Inspect() != "ERROR: identifier not found: duplicate" {
+		t.Errorf("builtin of another runtime found. got=%q", result.Inspect())
+	}
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, [2, "a"]] == [1, [2, "a"]]`, true},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, 2] != [1, 2, 3]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`#{1, 2} == #{2, 1}`, true},
+		{`b"ab" == b"ab"`, true},
+		{`[1] == "1"`, false},
+		{`let mk = fn(x) { fn() { x } }; mk(1) == mk(1)`, true},
+		{`let mk = fn(x) { fn() { x } }; mk(1) == mk(2)`, false},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f == f`, true},
+		{`let a = [1]; a is a`, true},
+		{`[1] is [1]`, false},
+		{`let a = [1]; let b = push(a, 2); a is b`, false},
+		{`1 is 1`, true},
+		{`"a" is "a"`, true},
+		{`[1] is [1] == false`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`#{3, 1, 2, 1, 3}`, `#{3, 1, 2}`},
+		{`#{}`, `#{}`},
+		{`#{[1, 2], "a", true}`, `#{[1, 2], a, true}`},
+		{`len(#{1, 2, 2})`, `2`},
+		{`2 in #{1, 2}`, `true`},
+		{`3 in #{1, 2}`, `false`},
+		{`[2, 1] in #{[1, 2]}`, `false`},
+		{`"a" in {"a": 1}`, `true`},
+		{`1 + 1 in #{2} == true`, `true`},
+		{`union(#{1, 2}, #{3, 2})`, `#{1, 2, 3}`},
+		{`intersect(#{1, 2, 3}, #{3, 2})`, `#{2, 3}`},
+		{`difference(#{1, 2, 3}, #{2})`, `#{1, 3}`},
+		{`elements(#{"b", "a"})`, `[b, a]`},
+		{`set([1, 2, 1])`, `#{1, 2}`},
+		{`let s = #{1}; union(s, #{2}); s`, `#{1}`},
+		{`#{fn(x) { x }}`, `ERROR: unusable as set element: FUNCTION`},
+		{`fn(x) { x } in #{1}`, `ERROR: unusable as set element: FUNCTION`},
+		{`1 in [1]`, `ERROR: unknown operator: INTEGER in ARRAY`},
+		{`set([{}])`, `ERROR: unusable as set element: HASH`},
+		{`union(#{1}, [1])`, "ERROR: argument 2 to `union` must be SET, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestHashIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -506,6 +833,22 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{[1, 2]: 1, [2, 1]: 5}[[2, 1]]`,
+			5,
+		},
+		{
+			`{[1, ["a", true]]: 5}[[1, ["a", true]]]`,
+			5,
+		},
+		{
+			`{[1]: 5}[["1"]]`,
+			nil,
+		},
+		{
+			`{[]: 5}[[]]`,
+			5,
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -517,3 +860,61 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestEvalContext(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits object.Limits
+		kind   object.LimitKind
+	}{
+		{`let loop = fn() { loop() }; loop();`, object.Limits{MaxSteps: 10000}, object.StepLimit},
+		{`let f = fn(n) { 1 + f(n + 1) }; f(0);`, object.Limits{MaxCallDepth: 100}, object.CallDepthLimit},
+		{`let grow = fn(arr) { grow(push(arr, 1)) }; grow([]);`, object.Limits{MaxCollectionSize: 100}, object.CollectionSizeLimit},
+		{`let grow = fn(s) { grow(s + s) }; grow("ab");`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`{1: 1, 2: 2, 3: 3, 4: 4}`, object.Limits{MaxCollectionSize: 3}, object.CollectionSizeLimit},
+		{`repeat("abcdefgh", 100000000)`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`pad_left("", 50000000, "é")`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`pad_right("abc", 600, "é")`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`replace(repeat("a", 1000), "a", repeat("b", 1000))`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`split(repeat(",", 1000), ",")`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`let s = repeat("a", 1000); join([s, s, s], "")`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`let loop = fn() { loop() }; loop();`, object.Limits{Timeout: 10 * time.Millisecond}, object.TimeLimit},
+		// squaring doubles the size of an integer in a single step
+		{`let f = fn(x, n) { if (n == 0) { x } else { f(x * x, n - 1) } }; f(3, 32);`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`let f = fn(x, n) { if (n == 0) { x } else { f(x * x, n - 1) } }; f(3, 32);`, object.Limits{MaxSteps: 10000, Timeout: 10 * time.Millisecond}, object.TimeLimit},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		_, err := EvalContext(context.Background(), program, object.NewEnvironment(), tt.limits)
+
+		var limitErr *object.LimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("expected *object.LimitError for %q, got=%v", tt.input, err)
+		}
+		if limitErr.Kind != tt.kind {
+			t.Errorf("wrong limit exceeded. want=%d, got=%d (%s)", tt.kind, limitErr.Kind, limitErr)
+		}
+	}
+
+	env := object.NewEnvironment()
+	program := parser.New(lexer.New(`let loop = fn(n) { if (n == 0) { 1 } else { loop(n - 1) } }; loop(100);`)).ParseProgram()
+	limits := object.Limits{MaxSteps: 100000, MaxCallDepth: 10, MaxCollectionSize: 10, Timeout: time.Minute}
+	result, err := EvalContext(context.Background(), program, env, limits)
+	if err != nil {
+		t.Fatalf("program within limits failed: %s", err)
+	}
+	testIntegerObject(t, result, 1)
+
+	if env.Budget() != nil {
+		t.Errorf("budget left in environment after EvalContext")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	program = parser.New(lexer.New(`let loop = fn() { loop() }; loop();`)).ParseProgram()
+	_, err = EvalContext(ctx, program, object.NewEnvironment(), object.Limits{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got=%v", err)
+	}
+}
@@ -1,64 +1,424 @@
 package evaluator
 
 import (
+	"fmt"
 	"monkey/ast"
 	"monkey/object"
 )
 
-func DefineMacros(program *ast.Program, env *object.Environment) {
-	macroIdxs := []int{}
+// DefineMacros adds the macros defined at the top level of program to env
+// and returns the program without those definitions. The program passed in
+// is left untouched.
+func DefineMacros(program *ast.Program, env *object.Environment) *ast.Program {
+	stmts := make([]ast.Statement, 0, len(program.Statements))
 
-	for i, stmt := range program.Statements {
+	for _, stmt := range program.Statements {
 		if isMacroDefinition(stmt) {
-			macroIdxs = append(macroIdxs, i)
 			addMacro(env, stmt)
+		} else {
+			stmts = append(stmts, stmt)
 		}
 	}
 
-	if len(macroIdxs) == 0 {
-		return
-	}
+	return &ast.Program{Statements: stmts}
+}
 
-	prevI := -1
-	newStmts := make([]ast.Statement, 0, len(program.Statements)-len(macroIdxs))
-	for i := 0; i < len(macroIdxs); i++ {
-		if prevI > 0 {
-			newStmts = append(newStmts, program.Statements[prevI+1:macroIdxs[i]]...)
-		} else {
-			newStmts = append(newStmts, program.Statements[:macroIdxs[i]]...)
-		}
-		prevI = macroIdxs[i]
+// MaxExpansionDepth is the default limit for macro calls produced by
+// other macro calls.
+const MaxExpansionDepth = 100
+
+// ExpansionStep describes one macro call replaced by its expansion. Depth
+// is the number of expansions that produced the call, 0 for calls written
+// in the program.
+type ExpansionStep struct {
+	Macro  string
+	Call   *ast.CallExpression
+	Result ast.Node
+	Depth  int
+}
+
+// An Expander replaces macro calls by their expansion until none are left.
+// Macros are defined at the top level of the program, in Env, or in the
+// block they are used in, and can be imported from other files with use
+// statements.
+type Expander struct {
+	Env *object.Environment
+	// MaxDepth limits how deeply expansions may produce further macro
+	// calls, MaxExpansionDepth if zero.
+	MaxDepth int
+	// Trace is called for every expanded macro call, if set.
+	Trace func(step ExpansionStep)
+	// Dir is the directory the paths of use statements are relative to,
+	// the working directory if empty.
+	Dir string
+
+	libraries *libraries
+}
+
+// ExpandMacros returns a copy of program with all macro calls replaced by
+// their expansion. The program passed in is left untouched.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	e := &Expander{Env: env}
+	return e.Expand(program)
+}
+
+// Define works like DefineMacros, but also imports the macros of the
+// libraries program uses into Env.
+func (e *Expander) Define(program *ast.Program) (*ast.Program, error) {
+	if err := e.define(program.Statements, e.Env); err != nil {
+		return nil, err
 	}
+	return &ast.Program{Statements: withoutMacroDefinitions(program.Statements)}, nil
+}
 
-	newStmts = append(newStmts, program.Statements[prevI+1:]...)
-	program.Statements = newStmts
+// Expand returns a copy of program with all macro calls replaced by their
+// expansion, expanding the macro calls in expansions as well. It fails if a
+// macro doesn't return quoted code, if a library can't be loaded, or if
+// expansion goes deeper than MaxDepth or would never end because a macro
+// call expands to itself.
+func (e *Expander) Expand(program ast.Node) (ast.Node, error) {
+	return e.expand(program, e.Env, 0, nil)
 }
 
-func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
-	return ast.Modify(program, func(n ast.Node) ast.Node {
+// expand expands the macro calls in node with the macros in env and those
+// defined in the blocks of node. active holds the calls whose expansion
+// produced node, seeing one of them again means the expansion runs in
+// circles.
+func (e *Expander) expand(node ast.Node, env *object.Environment, depth int, active []string) (ast.Node, error) {
+	node = ast.Clone(node)
+
+	// a macro call may use the macros of all blocks around it, so the
+	// environment of each call is found top-down before expanding
+	var err error
+	envs := []*object.Environment{env}
+	callEnvs := map[*ast.CallExpression]*object.Environment{}
+	// statements holds the calls that make up a statement of their own,
+	// which may expand to statements
+	statements := map[*ast.CallExpression]bool{}
+
+	ast.Walk(ast.Hooks{
+		EnterFn: func(c *ast.Cursor) bool {
+			if err != nil {
+				return false
+			}
+			current := envs[len(envs)-1]
+
+			switch n := c.Node().(type) {
+			case *ast.Program:
+				current, err = e.scope(n.Statements, current)
+				envs = append(envs, current)
+			case *ast.BlockStatement:
+				current, err = e.scope(n.Statements, current)
+				envs = append(envs, current)
+			case *ast.LetStatement:
+				// macro bodies are only expanded when they're called
+				return !isMacroDefinition(n)
+			case *ast.ExpressionStatement:
+				if call, ok := n.Expression.(*ast.CallExpression); ok {
+					statements[call] = true
+				}
+			case *ast.CallExpression:
+				callEnvs[n] = current
+				// a macro gets its arguments as they are written, macro
+				// calls in them are expanded with the expansion
+				if _, ok := isMacroCall(n, current); ok {
+					return false
+				}
+			}
+			return err == nil
+		},
+		LeaveFn: func(c *ast.Cursor) {
+			switch c.Node().(type) {
+			case *ast.Program, *ast.BlockStatement:
+				envs = envs[:len(envs)-1]
+			}
+		},
+	}, node)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := ast.Modify(node, func(n ast.Node) ast.Node {
+		if err != nil {
+			return n
+		}
+
+		switch n := n.(type) {
+		case *ast.Program:
+			n.Statements = withoutMacroDefinitions(n.Statements)
+			return n
+		case *ast.BlockStatement:
+			n.Statements = withoutMacroDefinitions(n.Statements)
+			return n
+		}
+
 		call, ok := n.(*ast.CallExpression)
-		if !ok {
+		if !ok || callEnvs[call] == nil {
 			return n
 		}
+		callEnv := callEnvs[call]
 
-		macro, ok := isMacroCall(call, env)
+		macro, ok := isMacroCall(call, callEnv)
 		if !ok {
 			return n
 		}
 
-		args := quoteArgs(call)
-		evalEnv := extendMacroEnv(macro, args)
+		name := call.Function.String()
+		key := call.String()
+		for _, a := range active {
+			if a == key {
+				err = fmt.Errorf("macro expansion never ends, %s expands to itself", key)
+				return n
+			}
+		}
 
-		evaluated := Eval(macro.Body, evalEnv)
+		maxDepth := e.MaxDepth
+		if maxDepth <= 0 {
+			maxDepth = MaxExpansionDepth
+		}
+		if depth >= maxDepth {
+			err = fmt.Errorf("macro expansion deeper than %d levels at %s", maxDepth, key)
+			return n
+		}
 
-		quote, ok := evaluated.(*object.Quote)
+		var result ast.Node
+		result, err = expandCall(name, macro, call)
+		if err != nil {
+			return n
+		}
+		if _, ok := result.(ast.Expression); !ok && !statements[call] {
+			err = fmt.Errorf("macro %s expanded to a statement where an expression is expected", name)
+			return n
+		}
 
-		if !ok {
-			panic("we only support returning AST-nodes from macros")
+		if e.Trace != nil {
+			e.Trace(ExpansionStep{Macro: name, Call: call, Result: result, Depth: depth})
+		}
+
+		result, err = e.expand(result, withMacrosOf(callEnv, macro.Env), depth+1, append(active[:len(active):len(active)], key))
+		return result
+	})
+
+	return expanded, err
+}
+
+// scope returns the environment for a block with stmts inside outer. Only
+// blocks that define or import macros get one of their own.
+func (e *Expander) scope(stmts []ast.Statement, outer *object.Environment) (*object.Environment, error) {
+	if len(withoutMacroDefinitions(stmts)) == len(stmts) {
+		return outer, nil
+	}
+
+	env := object.NewEnclosedEnvironment(outer)
+	return env, e.define(stmts, env)
+}
+
+// define adds the macros defined and imported by stmts to env.
+func (e *Expander) define(stmts []ast.Statement, env *object.Environment) error {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.UseStatement:
+			macros, err := e.library(stmt.Path.Value)
+			if err != nil {
+				return err
+			}
+			for name, macro := range macros {
+				env.Set(name, macro)
+			}
+		case *ast.LetStatement:
+			if isMacroDefinition(stmt) {
+				addMacro(env, stmt)
+			}
+		}
+	}
+	return nil
+}
+
+// withMacrosOf returns env extended by the macros visible in defEnv, the
+// environment a macro was defined in. The expansion of a macro may call
+// the macros next to it, even if the call site can't see them.
+func withMacrosOf(env *object.Environment, defEnv *object.Environment) *object.Environment {
+	if defEnv == env {
+		return env
+	}
+
+	extended := object.NewEnclosedEnvironment(env)
+	for name, obj := range defEnv.All() {
+		if macro, ok := obj.(*object.Macro); ok {
+			extended.Set(name, macro)
 		}
+	}
+	return extended
+}
+
+func withoutMacroDefinitions(stmts []ast.Statement) []ast.Statement {
+	kept := make([]ast.Statement, 0, len(stmts))
+	for _, stmt := range stmts {
+		if _, ok := stmt.(*ast.UseStatement); ok || isMacroDefinition(stmt) {
+			continue
+		}
+		kept = append(kept, stmt)
+	}
+	return kept
+}
+
+func expandCall(name string, macro *object.Macro, call *ast.CallExpression) (ast.Node, error) {
+	if len(call.Arguments) != len(macro.Parameters) {
+		return nil, fmt.Errorf("wrong number of arguments to macro %s. got=%d, want=%d",
+			name, len(call.Arguments), len(macro.Parameters))
+	}
+
+	args := quoteArgs(call)
+	evalEnv := extendMacroEnv(macro, args)
+
+	evaluated := unwrapReturnValue(Eval(hygienic(macro.Body), evalEnv))
+
+	switch evaluated := evaluated.(type) {
+	case *object.Quote:
+		return evaluated.Node, nil
+	case *object.Error:
+		return nil, fmt.Errorf("macro %s failed: %s", name, evaluated.Message)
+	case nil:
+		return nil, fmt.Errorf("macro %s returned nothing, macros have to return quoted code", name)
+	default:
+		return nil, fmt.Errorf("macro %s returned %s, macros have to return quoted code", name, evaluated.Type())
+	}
+}
 
-		return quote.Node
+// hygienic returns a copy of a macro body in which the names bound in
+// quoted code are replaced by fresh ones, so an expansion can neither
+// capture nor clobber variables at the call site. Code in unquote calls
+// comes from the caller and is left alone.
+func hygienic(body *ast.BlockStatement) *ast.BlockStatement {
+	body = ast.Clone(body).(*ast.BlockStatement)
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpression)
+		if !ok || call.Function.TokenLiteral() != "quote" {
+			return true
+		}
+		if len(call.Arguments) == 1 {
+			renameBindings(call.Arguments[0])
+		}
+		return false
 	})
+
+	return body
+}
+
+// renameBindings gives every name bound by a let statement, function
+// statement or function parameter in quoted a new name, and updates the
+// references to it that are in its scope, outside of unquote and
+// unquote_splice calls. A name used before the let that binds it still
+// refers to whatever it meant at the call site.
+func renameBindings(quoted ast.Node) {
+	renameScope(quoted, map[string]string{})
+}
+
+// renameScope renames the bindings of one function body, or of the quoted
+// code outside of any function. outer holds the new names of the bindings
+// of the enclosing scopes.
+//
+// A let binds its name from the statement after it on, and a function
+// statement is hoisted to the start of its scope. Functions usually run
+// after the scope around them is complete, so their bodies see all of its
+// bindings, wherever they are written.
+func renameScope(scope ast.Node, outer map[string]string) {
+	own := map[string]string{}
+	hoisted := map[string]string{}
+	bind := func(id *ast.Identifier) string {
+		if _, ok := own[id.Value]; !ok {
+			own[id.Value] = object.Gensym(id.Value)
+		}
+		return own[id.Value]
+	}
+
+	inspectQuoted(scope, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			bind(n.Name)
+		case *ast.FunctionStatement:
+			hoisted[n.Name.Value] = bind(n.Name)
+			return false
+		case *ast.FunctionLiteral:
+			return false
+		}
+		return true
+	})
+
+	visible := merge(outer, hoisted)
+	deferred := merge(outer, own)
+
+	var walk func(ast.Node)
+	walk = func(node ast.Node) {
+		inspectQuoted(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.LetStatement:
+				walk(n.Value)
+				visible[n.Name.Value] = own[n.Name.Value]
+				rename(n.Name, visible)
+				return false
+			case *ast.FunctionStatement:
+				rename(n.Name, visible)
+				renameFunction(n.Function, deferred)
+				return false
+			case *ast.FunctionLiteral:
+				renameFunction(n, deferred)
+				return false
+			case *ast.Identifier:
+				rename(n, visible)
+			}
+			return true
+		})
+	}
+	walk(scope)
+}
+
+// renameFunction renames the parameters of fn and the bindings in its
+// body. outer holds the new names of everything the body can see.
+func renameFunction(fn *ast.FunctionLiteral, outer map[string]string) {
+	if name, ok := outer[fn.Name]; ok {
+		fn.Name = name
+	}
+
+	params := map[string]string{}
+	for _, p := range fn.Parameters {
+		if _, ok := params[p.Value]; !ok {
+			params[p.Value] = object.Gensym(p.Value)
+		}
+		rename(p, params)
+	}
+
+	renameScope(fn.Body, merge(outer, params))
+}
+
+// inspectQuoted works like ast.Inspect but skips the arguments of unquote
+// and unquote_splice calls, which come from the caller.
+func inspectQuoted(node ast.Node, f func(ast.Node) bool) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpression); ok && (object.IsUnquoteCall(call) || object.IsSpliceCall(call)) {
+			return false
+		}
+		return f(n)
+	})
+}
+
+func rename(id *ast.Identifier, names map[string]string) {
+	if name, ok := names[id.Value]; ok {
+		id.Value = name
+		id.Token.Literal = name
+	}
+}
+
+func merge(a, b map[string]string) map[string]string {
+	merged := make(map[string]string, len(a)+len(b))
+	for k, v := range a {
+		merged[k] = v
+	}
+	for k, v := range b {
+		merged[k] = v
+	}
+	return merged
 }
 
 func extendMacroEnv(macro *object.Macro, args []*object.Quote) *object.Environment {
@@ -113,7 +473,7 @@ func isMacroDefinition(node ast.Statement) bool {
 
 func addMacro(env *object.Environment, stmt ast.Statement) {
 	letStmt, _ := stmt.(*ast.LetStatement)
-	macroLit, _ := letStmt.Value.(*ast.MacroLiteral)
+	macroLit, _ := ast.Clone(letStmt.Value).(*ast.MacroLiteral)
 
 	macro := &object.Macro{
 		Parameters: macroLit.Parameters,
@@ -1,10 +1,17 @@
 package evaluator
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
+
 	"monkey/ast"
+	"monkey/compiler"
+	"monkey/format"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/serializer"
 	"testing"
 )
 
@@ -18,10 +25,15 @@ func TestDefineMacros(t *testing.T) {
 	env := object.NewEnvironment()
 	program := testParseProgram(input)
 
-	DefineMacros(program, env)
+	defined := DefineMacros(program, env)
 
-	if len(program.Statements) != 2 {
+	if len(defined.Statements) != 2 {
 		t.Fatalf("Wrong number of statements. got=%d",
+			len(defined.Statements))
+	}
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("DefineMacros modified its input. got=%d statements",
 			len(program.Statements))
 	}
 
@@ -111,8 +123,8 @@ func TestExpandMacros(t *testing.T) {
 		program := testParseProgram(tt.input)
 
 		env := object.NewEnvironment()
-		DefineMacros(program, env)
-		expanded := ExpandMacros(program, env)
+		program = DefineMacros(program, env)
+		expanded := testExpandMacros(t, program, env)
 
 		if expanded.String() != expected.String() {
 			t.Errorf("not equal. want=%q, got=%q",
@@ -120,3 +132,513 @@ func TestExpandMacros(t *testing.T) {
 		}
 	}
 }
+
+func TestExpandMacrosLeavesInputUntouched(t *testing.T) {
+	input := `
+    let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+    reverse(2 + 2, 10 - 5);
+    reverse(1, 2);
+    `
+
+	env := object.NewEnvironment()
+	program := DefineMacros(testParseProgram(input), env)
+	original := program.String()
+
+	first := testExpandMacros(t, program, env)
+	second := testExpandMacros(t, program, env)
+
+	expected := testParseProgram(`(10 - 5) - (2 + 2); 2 - 1;`).String()
+	if first.String() != expected {
+		t.Errorf("first expansion wrong. want=%q, got=%q", expected, first.String())
+	}
+	if second.String() != expected {
+		t.Errorf("second expansion wrong. want=%q, got=%q", expected, second.String())
+	}
+	if program.String() != original {
+		t.Errorf("program was modified. want=%q, got=%q", original, program.String())
+	}
+}
+
+func TestHygienicExpansion(t *testing.T) {
+	input := `
+    let tmp = 10;
+    let addTo = macro(e) { quote(fn(tmp) { tmp + unquote(e) }(1)); };
+    let twice = macro(e) { quote(fn(f) { fn g(x) { f(f(x)) } g }(unquote(e))); };
+    let f = fn(x) { x * 3 };
+    [addTo(tmp), twice(f)(1)];
+    `
+
+	env := object.NewEnvironment()
+	program := DefineMacros(testParseProgram(input), env)
+	expanded := testExpandMacros(t, program, env)
+
+	if strings.Contains(expanded.String(), "fn(tmp)") {
+		t.Errorf("binding in macro wasn't renamed: %s", expanded.String())
+	}
+
+	result := Eval(expanded, object.NewEnvironment())
+	array, ok := result.(*object.Array)
+	if !ok {
+		t.Fatalf("result is not Array. got=%T (%+v)", result, result)
+	}
+	testIntegerObject(t, array.At(0), 11)
+	testIntegerObject(t, array.At(1), 9)
+}
+
+func TestHygienicExpansionUsesFreshNames(t *testing.T) {
+	input := `
+    let m = macro() { quote(fn(x) { x }); };
+    m();
+    m();
+    `
+
+	env := object.NewEnvironment()
+	program := DefineMacros(testParseProgram(input), env)
+	expanded := testExpandMacros(t, program, env).(*ast.Program)
+
+	first := expanded.Statements[0].String()
+	second := expanded.Statements[1].String()
+	if first == second {
+		t.Errorf("expansions share names: %s", first)
+	}
+
+	// the new names can't be written in source code
+	fn := expanded.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	name := fn.Parameters[0].Value
+	if tok, _ := lexer.New(name).NextToken(); tok.Literal == name {
+		t.Errorf("new name %q can be written in source code", name)
+	}
+}
+
+func TestHygienicExpansionScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// uses before the let refer to the caller's variable
+		{
+			`let x = 1; let m = macro() { quote([x, fn() { let y = x; let x = 2; x + y }()]); }; m();`,
+			"[1, 3]",
+		},
+		{
+			`let x = 1; let m = macro() { quote(fn() { let x = x + 1; x }()); }; m();`,
+			"2",
+		},
+		// function bodies see lets that come after them
+		{
+			`let m = macro() { quote(fn() { let f = fn() { g() }; let g = fn() { 5 }; f() }()); }; m();`,
+			"5",
+		},
+		{
+			`let m = macro() { quote(fn() { let a = fn() { h() }; fn h() { 4 } a() }()); }; m();`,
+			"4",
+		},
+		// parameters shadow outer bindings only inside their function
+		{
+			`let x = 10; let m = macro() { quote(fn() { let f = fn(x) { x }; [f(1), x] }()); }; m();`,
+			"[1, 10]",
+		},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		program := DefineMacros(testParseProgram(tt.input), env)
+		expanded := testExpandMacros(t, program, env)
+
+		result := Eval(expanded, env)
+		if result == nil || result.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%v", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestGensym(t *testing.T) {
+	first, ok := testEval(`gensym()`).(*object.Quote)
+	if !ok {
+		t.Fatalf("gensym() didn't return a Quote")
+	}
+	second := testEval(`gensym()`).(*object.Quote)
+	if first.Node.String() == second.Node.String() {
+		t.Errorf("gensym() returned %s twice", first.Node)
+	}
+
+	prefixed := testEval(`gensym("tmp")`).(*object.Quote)
+	if !strings.HasPrefix(prefixed.Node.String(), "tmp@") {
+		t.Errorf("gensym(\"tmp\") doesn't start with the prefix. got=%s", prefixed.Node)
+	}
+
+	err, ok := testEval(`gensym("a", "b")`).(*object.Error)
+	if !ok || err.Message != "wrong number of arguments. got=2, want at most 1" {
+		t.Errorf("gensym with two arguments didn't fail. got=%v", err)
+	}
+
+	err, ok = testEval(`gensym(1)`).(*object.Error)
+	if !ok || err.Message != "argument to `gensym` must be STRING, got INTEGER" {
+		t.Errorf("gensym with an integer didn't fail. got=%v", err)
+	}
+}
+
+func TestRecursiveExpansion(t *testing.T) {
+	input := `
+    let unless = macro(cond, then) { quote(if (!(unquote(cond))) { unquote(then) }); };
+    let when = macro(cond, then) { quote(unless(!(unquote(cond)), unquote(then))); };
+    when(x > 1, puts(x));
+    `
+	expected := `if (!(!(x > 1))) { puts(x) }`
+
+	env := object.NewEnvironment()
+	program := DefineMacros(testParseProgram(input), env)
+
+	steps := []ExpansionStep{}
+	expander := &Expander{Env: env, Trace: func(step ExpansionStep) { steps = append(steps, step) }}
+	expanded, err := expander.Expand(program)
+	if err != nil {
+		t.Fatalf("expansion failed: %s", err)
+	}
+
+	if expanded.String() != testParseProgram(expected).String() {
+		t.Errorf("not equal. want=%q, got=%q", testParseProgram(expected).String(), expanded.String())
+	}
+
+	if len(steps) != 2 {
+		t.Fatalf("wrong number of steps. want=2, got=%d", len(steps))
+	}
+	for i, name := range []string{"when", "unless"} {
+		if steps[i].Macro != name || steps[i].Depth != i {
+			t.Errorf("step %d wrong. want=%s at depth %d, got=%s at depth %d",
+				i, name, i, steps[i].Macro, steps[i].Depth)
+		}
+	}
+}
+
+func TestExpansionOutsideIn(t *testing.T) {
+	input := `
+    let inner = macro() { quote(1) };
+    let kind = macro(x) { quote(unquote(node_kind(x))) };
+    let twice = macro(x) { quote([unquote(x), unquote(x)]) };
+    kind(inner());
+    twice(inner());
+    `
+	expected := `"CallExpression"; [1, 1];`
+
+	env := object.NewEnvironment()
+	program := DefineMacros(testParseProgram(input), env)
+
+	steps := []string{}
+	expander := &Expander{Env: env, Trace: func(step ExpansionStep) { steps = append(steps, step.Macro) }}
+	expanded, err := expander.Expand(program)
+	if err != nil {
+		t.Fatalf("expansion failed: %s", err)
+	}
+
+	if format.Node(expanded) != format.Node(testParseProgram(expected)) {
+		t.Errorf("not equal. want=%q, got=%q", format.Node(testParseProgram(expected)), format.Node(expanded))
+	}
+	if got := strings.Join(steps, " "); got != "kind twice inner inner" {
+		t.Errorf("macros expanded in the wrong order. got=%q", got)
+	}
+}
+
+func TestExpansionToStatements(t *testing.T) {
+	input := `
+    let block = macro() { make_block([quote(1), quote(2)]) };
+    block();
+    3;
+    `
+
+	env := object.NewEnvironment()
+	program := DefineMacros(testParseProgram(input), env)
+	expanded := testExpandMacros(t, program, env).(*ast.Program)
+
+	if len(expanded.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(expanded.Statements))
+	}
+	block, ok := expanded.Statements[0].(*ast.BlockStatement)
+	if !ok {
+		t.Fatalf("expansion isn't the statement. got=%T (%+v)", expanded.Statements[0], expanded.Statements[0])
+	}
+	if len(block.Statements) != 2 {
+		t.Errorf("wrong number of statements in block. got=%d", len(block.Statements))
+	}
+}
+
+func TestExpansionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxDepth int
+		expected string
+	}{
+		{
+			`let loop = macro() { quote(loop()); }; loop();`,
+			0,
+			"macro expansion never ends, loop() expands to itself",
+		},
+		{
+			`let grow = macro(x) { quote(grow(unquote(x) + 1)); }; grow(0);`,
+			10,
+			"macro expansion deeper than 10 levels at grow(",
+		},
+		{
+			`let two = macro(a, b) { quote(unquote(a)); }; two(1);`,
+			0,
+			"wrong number of arguments to macro two. got=1, want=2",
+		},
+		{
+			`let number = macro() { 1 }; number();`,
+			0,
+			"macro number returned INTEGER, macros have to return quoted code",
+		},
+		{
+			`let block = macro() { make_block([quote(1)]) }; puts(block());`,
+			0,
+			"macro block expanded to a statement where an expression is expected",
+		},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		program := DefineMacros(testParseProgram(tt.input), env)
+
+		_, err := (&Expander{Env: env, MaxDepth: tt.maxDepth}).Expand(program)
+		if err == nil {
+			t.Errorf("expected an error for %q", tt.input)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q..., got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestProceduralMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		result   int64
+	}{
+		{
+			`
+            let calls = macro(fns) {
+                let build = fn(fs, acc) {
+                    if (len(fs) == 0) { acc } else { build(rest(fs), push(acc, make_call(first(fs), []))) }
+                };
+                quote(fn() { unquote_splice(build(node_children(fns), [])) }());
+            };
+            let one = fn() { 1 };
+            let two = fn() { 2 };
+            calls([one, two]);
+            `,
+			`let one = fn() { 1 }; let two = fn() { 2 }; fn() { one(); two() }();`,
+			2,
+		},
+		{
+			`
+            let sum = macro(list) {
+                if (node_kind(list) != "ArrayLiteral") {
+                    return quote(unquote(list));
+                }
+                quote(add(unquote_splice(node_children(list))));
+            };
+            let add = fn(a, b, c) { a + b + c };
+            sum([1, 2, 3]) + sum(4);
+            `,
+			`let add = fn(a, b, c) { a + b + c }; add(1, 2, 3) + 4;`,
+			10,
+		},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		program := DefineMacros(testParseProgram(tt.input), env)
+		expanded := testExpandMacros(t, program, env)
+
+		expected := testParseProgram(tt.expected)
+		if format.Node(expanded) != format.Node(expected) {
+			t.Errorf("not equal. want=%q, got=%q", format.Node(expected), format.Node(expanded))
+		}
+
+		testIntegerObject(t, Eval(expanded, object.NewEnvironment()), tt.result)
+	}
+}
+
+func TestScopedMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+            let f = fn() {
+                let double = macro(x) { quote(unquote(x) * 2) };
+                double(21)
+            };
+            double(1);
+            `,
+			`let f = fn() { 21 * 2 }; double(1);`,
+		},
+		{
+			`
+            let twice = macro(x) { quote([unquote(x), unquote(x)]) };
+            let f = fn() {
+                let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+                twice(1)
+            };
+            twice(2);
+            `,
+			`let f = fn() { 1 + 1 }; [2, 2];`,
+		},
+		{
+			`
+            let inner = macro(x) { quote(-unquote(x)) };
+            let outer = macro(x) { quote(inner(unquote(x))) };
+            if (true) {
+                let inner = macro(x) { quote(unquote(x)) };
+                outer(1)
+            }
+            `,
+			`if (true) { -1 }`,
+		},
+	}
+
+	for _, tt := range tests {
+		expanded := testExpandMacros(t, testParseProgram(tt.input), object.NewEnvironment())
+
+		expected := testParseProgram(tt.expected)
+		if format.Node(expanded) != format.Node(expected) {
+			t.Errorf("not equal. want=%q, got=%q", format.Node(expected), format.Node(expanded))
+		}
+	}
+}
+
+func TestUseLibraries(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "lib", "unless.monkey"), `
+    let unless = macro(cond, then) { quote(if (!(unquote(cond))) { unquote(then) }); };
+    `)
+	writeFile(t, filepath.Join(dir, "lib", "when.monkey"), `
+    use "unless.monkey";
+    let when = macro(cond, then) { quote(unless(!(unquote(cond)), unquote(then))); };
+    `)
+
+	// a compiled library exports the macros stored with its bytecode
+	s := serializer.New()
+	s.Write(&compiler.Bytecode{Macros: `let square = macro(x) { quote(unquote(x) * unquote(x)) };`})
+	writeFile(t, filepath.Join(dir, "square.mky"), string(s.Output))
+
+	input := `
+    use "lib/when.monkey";
+    let f = fn(x) {
+        use "square.mky";
+        when(x > 0, square(x))
+    };
+    square(2);
+    `
+	expected := `let f = fn(x) { if (!(!(x > 0))) { x * x } }; square(2);`
+
+	env := object.NewEnvironment()
+	expander := &Expander{Env: env, Dir: dir}
+	program, err := expander.Define(testParseProgram(input))
+	if err != nil {
+		t.Fatalf("defining macros failed: %s", err)
+	}
+	expanded, err := expander.Expand(program)
+	if err != nil {
+		t.Fatalf("expansion failed: %s", err)
+	}
+
+	if format.Node(expanded) != format.Node(testParseProgram(expected)) {
+		t.Errorf("not equal. want=%q, got=%q", format.Node(testParseProgram(expected)), format.Node(expanded))
+	}
+
+	// macros a library uses itself aren't exported
+	if _, ok := env.Get("unless"); ok {
+		t.Errorf("unless leaked out of lib/when.monkey")
+	}
+}
+
+func TestUseCompiledLibraryWithImports(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "lib", "unless.monkey"), `
+    let unless = macro(cond, then) { quote(if (!(unquote(cond))) { unquote(then) }); };
+    `)
+
+	// export lib/when.monkey the way the compile command does
+	exported := MacroDefinitions(testParseProgram(`
+    use "unless.monkey";
+    let when = macro(cond, then) { quote(unless(!(unquote(cond)), unquote(then))); };
+    puts("not exported");
+    `))
+	s := serializer.New()
+	s.Write(&compiler.Bytecode{Macros: format.Node(exported)})
+	writeFile(t, filepath.Join(dir, "lib", "when.mky"), string(s.Output))
+
+	input := `use "lib/when.mky"; when(x > 0, puts(x));`
+	expected := `if (!(!(x > 0))) { puts(x) }`
+
+	env := object.NewEnvironment()
+	expander := &Expander{Env: env, Dir: dir}
+	program, err := expander.Define(testParseProgram(input))
+	if err != nil {
+		t.Fatalf("defining macros failed: %s", err)
+	}
+	expanded, err := expander.Expand(program)
+	if err != nil {
+		t.Fatalf("expansion failed: %s", err)
+	}
+
+	if format.Node(expanded) != format.Node(testParseProgram(expected)) {
+		t.Errorf("not equal. want=%q, got=%q", format.Node(testParseProgram(expected)), format.Node(expanded))
+	}
+	if _, ok := env.Get("unless"); ok {
+		t.Errorf("unless leaked out of lib/when.mky")
+	}
+}
+
+func TestUseErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.monkey"), `use "b.monkey";`)
+	writeFile(t, filepath.Join(dir, "b.monkey"), `use "a.monkey";`)
+	writeFile(t, filepath.Join(dir, "broken.monkey"), `let = macro`)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`use "missing.monkey";`, `use "missing.monkey": open `},
+		{`use "a.monkey";`, `use "a.monkey": library uses itself`},
+		{`if (true) { use "broken.monkey"; }`, `use "broken.monkey": expected next token to be IDENT`},
+	}
+
+	for _, tt := range tests {
+		expander := &Expander{Env: object.NewEnvironment(), Dir: dir}
+		_, err := expander.Expand(testParseProgram(tt.input))
+		if err == nil {
+			t.Errorf("expected an error for %q", tt.input)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q..., got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func writeFile(t *testing.T, path string, contents string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testExpandMacros(t *testing.T, program ast.Node, env *object.Environment) ast.Node {
+	t.Helper()
+
+	expanded, err := ExpandMacros(program, env)
+	if err != nil {
+		t.Fatalf("macro expansion failed: %s", err)
+	}
+	return expanded
+}
@@ -0,0 +1,111 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/serializer"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// libraries are the macro libraries loaded by an Expander, shared with the
+// expanders of the libraries themselves.
+type libraries struct {
+	loaded  map[string]map[string]*object.Macro
+	loading map[string]bool
+}
+
+// library returns the macros defined at the top level of the file at path.
+// Macros the library imports itself are only visible to its own macros.
+// Source files are read as Monkey code, .mky files are read from the
+// macros stored with their bytecode.
+func (e *Expander) library(path string) (map[string]*object.Macro, error) {
+	if e.libraries == nil {
+		e.libraries = &libraries{
+			loaded:  map[string]map[string]*object.Macro{},
+			loading: map[string]bool{},
+		}
+	}
+
+	file := path
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(e.Dir, file)
+	}
+	file = filepath.Clean(file)
+
+	if macros, ok := e.libraries.loaded[file]; ok {
+		return macros, nil
+	}
+	if e.libraries.loading[file] {
+		return nil, fmt.Errorf("use %q: library uses itself", path)
+	}
+	e.libraries.loading[file] = true
+	defer delete(e.libraries.loading, file)
+
+	program, err := readLibrary(file)
+	if err != nil {
+		return nil, fmt.Errorf("use %q: %s", path, err)
+	}
+
+	lib := &Expander{Dir: filepath.Dir(file), libraries: e.libraries}
+	env, err := lib.scope(program.Statements, object.NewEnvironment())
+	if err != nil {
+		return nil, err
+	}
+
+	macros := map[string]*object.Macro{}
+	for _, stmt := range program.Statements {
+		if isMacroDefinition(stmt) {
+			name := stmt.(*ast.LetStatement).Name.Value
+			macro, _ := env.Get(name)
+			macros[name] = macro.(*object.Macro)
+		}
+	}
+
+	e.libraries.loaded[file] = macros
+	return macros, nil
+}
+
+func readLibrary(file string) (*ast.Program, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	src := string(contents)
+	if filepath.Ext(file) == ".mky" {
+		// only the macros are used, the code doesn't have to run here
+		loader := serializer.NewLoader(contents)
+		loader.SetRuntime(nil)
+		bytecode, err := loader.Load()
+		if err != nil {
+			return nil, err
+		}
+		src = bytecode.Macros
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), "\n"))
+	}
+	return program, nil
+}
+
+// MacroDefinitions returns a program with only the macro definitions at the
+// top level of program, the macros a library exports, and the use
+// statements their expansions may need. The paths of the use statements
+// stay relative to the directory of program.
+func MacroDefinitions(program *ast.Program) *ast.Program {
+	defs := &ast.Program{}
+	for _, stmt := range program.Statements {
+		if _, ok := stmt.(*ast.UseStatement); ok || isMacroDefinition(stmt) {
+			defs.Statements = append(defs.Statements, stmt)
+		}
+	}
+	return defs
+}
@@ -1,62 +1,43 @@
 package evaluator
 
 import (
-	"fmt"
 	"monkey/ast"
 	"monkey/object"
-	"monkey/token"
 )
 
 func quote(node ast.Node, env *object.Environment) object.Object {
-	node = evalUnquoteCalls(node, env)
-	return &object.Quote{Node: node}
-}
-
-func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
-	return ast.Modify(quoted, func(n ast.Node) ast.Node {
-		if !isUnquoteCall(n) {
-			return n
-		}
+	calls := object.UnquoteCalls(node)
 
-		call, ok := n.(*ast.CallExpression)
-		if !ok {
-			return n
+	values := make([]object.Object, 0, len(calls))
+	for _, call := range calls {
+		value := Eval(call.Arguments[0], env)
+		if isError(value) {
+			return value
 		}
+		values = append(values, value)
+	}
 
-		if len(call.Arguments) != 1 {
-			return n
-		}
-
-		unquoted := Eval(call.Arguments[0], env)
-		return convertToAstNode(unquoted)
-	})
-}
-
-func isUnquoteCall(node ast.Node) bool {
-	callExp, ok := node.(*ast.CallExpression)
-	return ok && callExp.Function.TokenLiteral() == "unquote"
+	unquoted, err := object.Unquote(node, values)
+	if err != nil {
+		return newError("%s", err)
+	}
+	return &object.Quote{Node: unquoted}
 }
 
-func convertToAstNode(obj object.Object) ast.Node {
-	switch obj := obj.(type) {
-	case *object.Integer:
-		t := token.Token{
-			Type:    token.INT,
-			Literal: fmt.Sprintf("%d", obj.Value),
-		}
-		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
-
-	case *object.Boolean:
-		if obj.Value {
-			return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}}
-		} else {
-			return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}}
-		}
-
-	case *object.Quote:
-		return obj.Node
-
-	default:
-		return nil
+// builtins returns the builtins of the runtime of env, bound to the
+// evaluator once per outermost environment and runtime. Builtins that run
+// quoted code run it in an environment of its own, values get in through
+// unquote, but it counts against the budget and uses the builtins of env.
+func builtins(env *object.Environment) []*object.Builtin {
+	bound := env.Builtins()
+	if len(bound) < len(env.Runtime().Builtins()) {
+		bound = env.Runtime().Bind(func(node ast.Node) object.Object {
+			quoteEnv := object.NewEnvironment()
+			quoteEnv.SetBudget(env.Budget())
+			quoteEnv.SetRuntime(env.Runtime())
+			return unwrapReturnValue(Eval(node, quoteEnv))
+		})
+		env.SetBuiltins(bound)
 	}
+	return bound
 }
@@ -90,6 +90,14 @@ func TestQuoteUnquote(t *testing.T) {
             quote(unquote(4 + 4) + unquote(quotedInfixExpression))`,
 			`(8 + (4 + 4))`,
 		},
+		{
+			`quote(unquote("mon" + "key"))`,
+			`monkey`,
+		},
+		{
+			`quote(unquote([1, 2 * 3, quote(x)]))`,
+			`[1, 6, x]`,
+		},
 	}
 
 	for i, tt := range tests {
@@ -109,3 +117,166 @@ func TestQuoteUnquote(t *testing.T) {
 		}
 	}
 }
+
+func TestUnquoteSplice(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let xs = [1, 2];
+            quote(f(0, unquote_splice(xs), 3))`,
+			`f(0, 1, 2, 3)`,
+		},
+		{
+			`quote([unquote_splice([]), unquote_splice([1, 2]), 3])`,
+			`[1, 2, 3]`,
+		},
+		{
+			`quote(fn() { unquote_splice([quote(a), quote(b)]); c })`,
+			`fn() abc`,
+		},
+		{
+			`let wrap = fn(x) { quote(g(unquote(x))) };
+            quote(f(unquote_splice([wrap(1), wrap(2)])))`,
+			`f(g(1), g(2))`,
+		},
+	}
+
+	for i, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("test[%d]: expected *object.Quote. got=%T (%v)",
+				i, evaluated, evaluated)
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("test[%d]: not equal. got=%q, want=%q", i, quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestAstBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`node_kind(quote(f(x)))`, "CallExpression"},
+		{`node_kind(quote(1 + 2))`, "InfixExpression"},
+		{`len(node_children(quote(f(x, y))))`, 3},
+		{`node_value(first(node_children(quote(f(x)))))`, "f"},
+		{`node_value(quote(5))`, 5},
+		{`node_value(quote("five"))`, "five"},
+		{`node_kind(make_ident("foo"))`, "Identifier"},
+		{`make_ident("foo bar")`, `not a valid identifier: "foo bar"`},
+		{`make_ident("let")`, `not a valid identifier: "let"`},
+		{`make_call("f", [len])`, "arguments to `make_call` must be expressions, got [builtin function]"},
+		{`make_block([puts])`, "elements of a block must be statements or expressions, got [builtin function]"},
+		{`node_kind(42)`, "argument to `node_kind` must be QUOTE, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("wrong value for %s. want=%q, got=%q", tt.input, expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error for %s. want=%q, got=%q", tt.input, expected, obj.Message)
+				}
+			default:
+				t.Errorf("unexpected result for %s: %T (%+v)", tt.input, obj, obj)
+			}
+		}
+	}
+
+	quotes := []struct {
+		input    string
+		expected string
+	}{
+		{`make_ident("foo")`, `foo`},
+		{`make_call("f", [1, quote(x), [true]])`, `f(1, x, [true])`},
+		{`make_call(quote(fns[0]), [])`, `(fns[0])()`},
+		{`make_call(make_ident("g"), [make_call("h", [])])`, `g(h())`},
+		{`make_block([quote(x), 1])`, `x1`},
+	}
+
+	for _, tt := range quotes {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote for %s. got=%T (%v)", tt.input, evaluated, evaluated)
+		}
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal for %s. got=%q, want=%q", tt.input, quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(n) { n }; quote(unquote(f)(1))`, "can't unquote FUNCTION, it has no literal"},
+		{`quote(f(unquote_splice(1)))`, "can't splice INTEGER, it's not an array"},
+		{`quote(f(unquote_splice([len])))`, "can't splice [builtin function], not all elements are expressions"},
+		{`quote(unquote(nope))`, "identifier not found: nope"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %s", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestEvalQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`eval_quote(quote(1 + 2))`, 3},
+		{`let x = 20; eval_quote(quote(unquote(x) + 22))`, 42},
+		{`eval_quote(make_call("len", [[1, 2, 3]]))`, 3},
+		{`eval_quote(make_block([quote(1), quote(2)]))`, 2},
+		{`eval_quote(quote(fn(n) { n * 2 }(21)))`, 42},
+		{`eval_quote(quote(fn(x) { x * 2 }))(4)`, 8},
+		{`let f = eval_quote(quote(fn() { eval_quote(quote(fn() { 10 + 1 })) })); f()()`, 11},
+		{`let x = 1; eval_quote(quote(x))`, "identifier not found: x"},
+		{`eval_quote(1)`, "argument to `eval_quote` must be QUOTE, got INTEGER"},
+		{`eval_quote == eval_quote`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %s. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
@@ -0,0 +1,547 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strconv"
+	"strings"
+)
+
+const (
+	indentation = "    "
+	maxWidth    = 80
+)
+
+// Source formats Monkey source code. Comments and single blank lines
+// between statements are kept, everything else is printed canonically.
+func Source(src []byte) ([]byte, error) {
+	l := lexer.New(string(src))
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("can't format, parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	pr := &printer{
+		lines:    strings.Split(string(src), "\n"),
+		comments: l.Comments(),
+	}
+
+	return []byte(pr.statements(program.Statements, 0, -1)), nil
+}
+
+// Node prints a syntax tree in canonical form. Trees without source, like
+// the results of macro expansion, can't carry comments or blank lines.
+func Node(node ast.Node) string {
+	pr := &printer{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		return pr.statements(node.Statements, 0, -1)
+	case ast.Statement:
+		return pr.statements([]ast.Statement{node}, 0, -1)
+	case ast.Expression:
+		return pr.expression(node, 0)
+	default:
+		return ""
+	}
+}
+
+type printer struct {
+	lines    []string
+	comments []token.Token
+	// ends holds the last lines of the statements being printed. A comment
+	// at the end of a line goes to the outermost statement ending there.
+	ends []int
+}
+
+// statements prints stmts one per line at the given depth. Comments before
+// the line end are printed as well, a negative end prints all that are left.
+func (p *printer) statements(stmts []ast.Statement, depth int, end int) string {
+	var out bytes.Buffer
+	last := 0
+
+	write := func(start, stop int, text string) {
+		if last > 0 && p.blankBetween(last, start) {
+			out.WriteString("\n")
+		}
+		out.WriteString(strings.Repeat(indentation, depth))
+		out.WriteString(text)
+		out.WriteString("\n")
+		if stop > 0 {
+			last = stop
+		}
+	}
+
+	for i, stmt := range stmts {
+		start := startLine(stmt)
+		for _, c := range p.commentsBefore(start) {
+			write(c.Line, c.Line, c.Literal)
+		}
+
+		var next ast.Statement
+		if i+1 < len(stmts) {
+			next = stmts[i+1]
+		}
+
+		stop := endLine(stmt)
+		outermost := !p.endsOn(stop)
+		p.ends = append(p.ends, stop)
+		text := p.statement(stmt, next, depth)
+		p.ends = p.ends[:len(p.ends)-1]
+		if outermost {
+			for _, c := range p.trailingComments(stop) {
+				text += " " + c.Literal
+			}
+		}
+		write(start, stop, text)
+	}
+
+	for _, c := range p.commentsBefore(end) {
+		write(c.Line, c.Line, c.Literal)
+	}
+
+	return out.String()
+}
+
+func (p *printer) statement(stmt ast.Statement, next ast.Statement, depth int) string {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return "let " + stmt.Name.Value + " = " + p.expression(stmt.Value, depth) + ";"
+
+	case *ast.ReturnStatement:
+		if stmt.ReturnValue == nil {
+			return "return;"
+		}
+		return "return " + p.expression(stmt.ReturnValue, depth) + ";"
+
+	case *ast.UseStatement:
+		return "use " + quote(stmt.Path.Value) + ";"
+
+	case *ast.FunctionStatement:
+		return "fn " + stmt.Name.Value + p.function(stmt.Function.Parameters, stmt.Function.Body, depth)
+
+	case *ast.ExpressionStatement:
+		text := p.expression(stmt.Expression, depth)
+		if _, ok := stmt.Expression.(*ast.IfExpression); ok && !continuesExpression(next) {
+			return text
+		}
+		return text + ";"
+
+	case *ast.BlockStatement:
+		return p.block(stmt, depth)
+
+	default:
+		return stmt.String()
+	}
+}
+
+// continuesExpression reports whether stmt would be parsed as part of the
+// expression before it when the two aren't separated by a semicolon.
+func continuesExpression(stmt ast.Statement) bool {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+
+	exp := es.Expression
+	for {
+		switch e := exp.(type) {
+		case *ast.PrefixExpression:
+			return e.Operator == "-"
+		case *ast.ArrayLiteral:
+			return true
+		case *ast.InfixExpression:
+			if precedence(e.Left) < operatorPrecedence(e.Operator) {
+				return true
+			}
+			exp = e.Left
+		case *ast.CallExpression:
+			if precedence(e.Function) < parser.CALL {
+				return true
+			}
+			exp = e.Function
+		case *ast.IndexExpression:
+			if precedence(e.Left) < parser.INDEX {
+				return true
+			}
+			exp = e.Left
+		default:
+			return false
+		}
+	}
+}
+
+func (p *printer) expression(exp ast.Expression, depth int) string {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return exp.Value
+
+	case *ast.IntegerLiteral:
+		return strconv.FormatInt(exp.Value, 10)
+
+	case *ast.BigIntegerLiteral:
+		return exp.Value.String()
+
+	case *ast.StringLiteral:
+		return quote(exp.Value)
+
+	case *ast.BytesLiteral:
+		return exp.String()
+
+	case *ast.Boolean:
+		return strconv.FormatBool(exp.Value)
+
+	case *ast.PrefixExpression:
+		return exp.Operator + p.operand(exp.Right, parser.PREFIX, depth)
+
+	case *ast.InfixExpression:
+		prec := operatorPrecedence(exp.Operator)
+		left := p.operand(exp.Left, prec, depth)
+		// operators are left associative, so equal precedence on the
+		// right needs parentheses
+		right := p.operand(exp.Right, prec+1, depth)
+		return left + " " + exp.Operator + " " + right
+
+	case *ast.CallExpression:
+		args := []string{}
+		function := p.operand(exp.Function, parser.CALL, depth)
+		for _, a := range exp.Arguments {
+			args = append(args, p.expression(a, depth))
+		}
+		return function + "(" + strings.Join(args, ", ") + ")"
+
+	case *ast.IndexExpression:
+		return p.operand(exp.Left, parser.INDEX, depth) + "[" + p.expression(exp.Index, depth) + "]"
+
+	case *ast.IfExpression:
+		out := "if (" + p.expression(exp.Condition, depth) + ") " + p.block(exp.Consequence, depth)
+		if exp.Alternative != nil {
+			out += " else " + p.block(exp.Alternative, depth)
+		}
+		return out
+
+	case *ast.FunctionLiteral:
+		return "fn" + p.function(exp.Parameters, exp.Body, depth)
+
+	case *ast.MacroLiteral:
+		return "macro" + p.function(exp.Parameters, exp.Body, depth)
+
+	case *ast.ArrayLiteral:
+		items := p.elements(exp.Elements, depth)
+		return p.list("[", items, p.commentsBefore(exp.Rbracket.Line), "]", depth)
+
+	case *ast.SetLiteral:
+		items := p.elements(exp.Elements, depth)
+		return p.list("#{", items, p.commentsBefore(exp.Rbrace.Line), "}", depth)
+
+	case *ast.HashLiteral:
+		pairs := []item{}
+		for i, pair := range exp.Data {
+			var next ast.Node
+			if i+1 < len(exp.Data) {
+				next = exp.Data[i+1].Key
+			}
+			before := p.commentsBefore(firstLine(pair.Key))
+			key := p.expression(pair.Key, depth+1)
+			text := key + ": " + p.expression(pair.Value, depth+1)
+			pairs = append(pairs, item{text, before, p.itemComments(pair.Value, next)})
+		}
+		return p.list("{", pairs, p.commentsBefore(exp.Rbrace.Line), "}", depth)
+
+	case nil:
+		return ""
+
+	default:
+		return exp.String()
+	}
+}
+
+// operand prints exp, wrapped in parentheses if it binds less strongly
+// than minPrecedence.
+func (p *printer) operand(exp ast.Expression, minPrecedence int, depth int) string {
+	text := p.expression(exp, depth)
+	if precedence(exp) < minPrecedence {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return operatorPrecedence(exp.Operator)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	default:
+		return parser.INDEX
+	}
+}
+
+// operatorPrecedence returns the precedence of the infix operator op,
+// which is a keyword like in or the literal of its token.
+func operatorPrecedence(op string) int {
+	if t := token.LookupIdent(op); t != token.IDENT {
+		return parser.Precedence(t)
+	}
+	return parser.Precedence(token.TokenType(op))
+}
+
+func (p *printer) function(params []*ast.Identifier, body *ast.BlockStatement, depth int) string {
+	names := []string{}
+	for _, param := range params {
+		names = append(names, param.Value)
+	}
+	return "(" + strings.Join(names, ", ") + ") " + p.block(body, depth)
+}
+
+func (p *printer) block(block *ast.BlockStatement, depth int) string {
+	if block == nil {
+		return "{}"
+	}
+
+	end := block.Rbrace.Line
+	if end == 0 {
+		end = endLine(block)
+	}
+
+	body := p.statements(block.Statements, depth+1, end)
+	if body == "" {
+		return "{}"
+	}
+	return "{\n" + body + strings.Repeat(indentation, depth) + "}"
+}
+
+// An item is an element of a list with the comments on the lines before
+// it and at the end of its line.
+type item struct {
+	text     string
+	before   []token.Token
+	trailing []token.Token
+}
+
+func (p *printer) elements(exps []ast.Expression, depth int) []item {
+	items := []item{}
+	for i, e := range exps {
+		var next ast.Node
+		if i+1 < len(exps) {
+			next = exps[i+1]
+		}
+		before := p.commentsBefore(firstLine(e))
+		text := p.expression(e, depth+1)
+		items = append(items, item{text, before, p.itemComments(e, next)})
+	}
+	return items
+}
+
+// itemComments takes the comments at the end of the line a list element
+// ends on, unless the next element or the statement goes on on that line.
+func (p *printer) itemComments(element ast.Node, next ast.Node) []token.Token {
+	line := endLine(element)
+	if next != nil && firstLine(next) <= line || p.endsOn(line) {
+		return nil
+	}
+	return p.trailingComments(line)
+}
+
+// list puts the items on a single line if they fit, or one per line if
+// not. Items with comments always go on lines of their own, and so do the
+// comments at the end of the list.
+func (p *printer) list(open string, items []item, end []token.Token, close string, depth int) string {
+	texts := []string{}
+	commented := len(end) > 0
+	for _, it := range items {
+		texts = append(texts, it.text)
+		commented = commented || len(it.before) > 0 || len(it.trailing) > 0
+	}
+
+	inline := open + strings.Join(texts, ", ") + close
+	if !commented && len(inline)+depth*len(indentation) <= maxWidth && !strings.Contains(inline, "\n") {
+		return inline
+	}
+
+	var out bytes.Buffer
+	out.WriteString(open + "\n")
+	for i, it := range items {
+		for _, c := range it.before {
+			out.WriteString(strings.Repeat(indentation, depth+1) + c.Literal + "\n")
+		}
+		out.WriteString(strings.Repeat(indentation, depth+1))
+		out.WriteString(it.text)
+		if i < len(items)-1 {
+			out.WriteString(",")
+		}
+		for _, c := range it.trailing {
+			out.WriteString(" " + c.Literal)
+		}
+		out.WriteString("\n")
+	}
+	for _, c := range end {
+		out.WriteString(strings.Repeat(indentation, depth+1) + c.Literal + "\n")
+	}
+	out.WriteString(strings.Repeat(indentation, depth) + close)
+	return out.String()
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// commentsBefore takes all comments that start before line from the queue.
+// A negative line takes all of them.
+func (p *printer) commentsBefore(line int) []token.Token {
+	i := 0
+	for i < len(p.comments) && (line < 0 || p.comments[i].Line < line) {
+		i++
+	}
+	taken := p.comments[:i]
+	p.comments = p.comments[i:]
+	return taken
+}
+
+// trailingComments takes the comments that follow code on line.
+func (p *printer) trailingComments(line int) []token.Token {
+	taken := []token.Token{}
+	for len(p.comments) > 0 && p.comments[0].Line == line && p.isTrailing(p.comments[0]) {
+		taken = append(taken, p.comments[0])
+		p.comments = p.comments[1:]
+	}
+	return taken
+}
+
+// endsOn reports whether a statement being printed ends on line.
+func (p *printer) endsOn(line int) bool {
+	for _, end := range p.ends {
+		if end == line {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *printer) isTrailing(c token.Token) bool {
+	if c.Line < 1 || c.Line > len(p.lines) {
+		return false
+	}
+	line := p.lines[c.Line-1]
+	if c.Column-1 > len(line) {
+		return false
+	}
+	return strings.TrimSpace(line[:c.Column-1]) != ""
+}
+
+func (p *printer) blankBetween(from, to int) bool {
+	for line := from + 1; line < to && line <= len(p.lines); line++ {
+		if strings.TrimSpace(p.lines[line-1]) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func startLine(stmt ast.Statement) int {
+	return nodeToken(stmt).Line
+}
+
+// firstLine returns the first source line a node is known to occupy, 0
+// if it has no position.
+func firstLine(node ast.Node) int {
+	first := 0
+	ast.Inspect(node, func(n ast.Node) bool {
+		if line := nodeToken(n).Line; line > 0 && (first == 0 || line < first) {
+			first = line
+		}
+		return true
+	})
+	return first
+}
+
+// endLine returns the last source line a node is known to occupy.
+func endLine(node ast.Node) int {
+	end := 0
+	ast.Inspect(node, func(n ast.Node) bool {
+		if line := nodeToken(n).Line; line > end {
+			end = line
+		}
+		if line := closingLine(n); line > end {
+			end = line
+		}
+		return true
+	})
+	return end
+}
+
+// closingLine returns the line of the bracket or brace closing node, 0 if
+// it has none.
+func closingLine(node ast.Node) int {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		return node.Rbrace.Line
+	case *ast.ArrayLiteral:
+		return node.Rbracket.Line
+	case *ast.SetLiteral:
+		return node.Rbrace.Line
+	case *ast.HashLiteral:
+		return node.Rbrace.Line
+	default:
+		return 0
+	}
+}
+
+func nodeToken(node ast.Node) token.Token {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token
+	case *ast.ReturnStatement:
+		return node.Token
+	case *ast.UseStatement:
+		return node.Token
+	case *ast.ExpressionStatement:
+		return node.Token
+	case *ast.FunctionStatement:
+		return node.Token
+	case *ast.BlockStatement:
+		return node.Token
+	case *ast.Identifier:
+		return node.Token
+	case *ast.IntegerLiteral:
+		return node.Token
+	case *ast.BigIntegerLiteral:
+		return node.Token
+	case *ast.StringLiteral:
+		return node.Token
+	case *ast.BytesLiteral:
+		return node.Token
+	case *ast.Boolean:
+		return node.Token
+	case *ast.PrefixExpression:
+		return node.Token
+	case *ast.InfixExpression:
+		return node.Token
+	case *ast.IfExpression:
+		return node.Token
+	case *ast.FunctionLiteral:
+		return node.Token
+	case *ast.MacroLiteral:
+		return node.Token
+	case *ast.CallExpression:
+		return node.Token
+	case *ast.ArrayLiteral:
+		return node.Token
+	case *ast.IndexExpression:
+		return node.Token
+	case *ast.HashLiteral:
+		return node.Token
+	case *ast.SetLiteral:
+		return node.Token
+	default:
+		return token.Token{}
+	}
+}
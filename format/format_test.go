@@ -0,0 +1,178 @@
+package format
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x=1+2*3;x",
+			"let x = 1 + 2 * 3;\nx;\n",
+		},
+		{
+			`use   "lib.monkey"
+unless(a, b)`,
+			"use \"lib.monkey\";\nunless(a, b);\n",
+		},
+		{
+			`b"\x00a\"" + b"\xFF\n"`,
+			"b\"\\x00a\\\"\" + b\"\\xff\\n\";\n",
+		},
+		{
+			"(x in #{1,2}) == (x+1 in s)",
+			"x in #{1, 2} == x + 1 in s;\n",
+		},
+		{
+			"18446744073709551616+1",
+			"18446744073709551616 + 1;\n",
+		},
+		{
+			"(1 + 2) * 3 - (4 - 5)",
+			"(1 + 2) * 3 - (4 - 5);\n",
+		},
+		{
+			"-(a + b) == !c",
+			"-(a + b) == !c;\n",
+		},
+		{
+			`let add = fn(a,b){return a+b}`,
+			"let add = fn(a, b) {\n    return a + b;\n};\n",
+		},
+		{
+			"fn double(x) { x * 2 }\ndouble(2)",
+			"fn double(x) {\n    x * 2;\n}\ndouble(2);\n",
+		},
+		{
+			"if (x) { 1 } else { }\nputs(x)",
+			"if (x) {\n    1;\n} else {}\nputs(x);\n",
+		},
+		{
+			"if (x) { 1 };\n(y)",
+			"if (x) {\n    1;\n}\ny;\n",
+		},
+		{
+			"if (x) { 1 };\n(y + 1) * 2",
+			"if (x) {\n    1;\n};\n(y + 1) * 2;\n",
+		},
+		{
+			"if (x) { 1 };\n-y",
+			"if (x) {\n    1;\n};\n-y;\n",
+		},
+		{
+			`puts("say \"hi\" \\ bye")`,
+			"puts(\"say \\\"hi\\\" \\\\ bye\");\n",
+		},
+		{
+			"[1,2][0]; {\"a\":1}[\"a\"]",
+			"[1, 2][0];\n{\"a\": 1}[\"a\"];\n",
+		},
+		{
+			`let long = ["aaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbb", "ccccccccccccccc", "ddddddddddddddd", "eeeeeeeeeeeeeeee"]`,
+			"let long = [\n    \"aaaaaaaaaaaaaaa\",\n    \"bbbbbbbbbbbbbbb\",\n    \"ccccccccccccccc\",\n" +
+				"    \"ddddddddddddddd\",\n    \"eeeeeeeeeeeeeeee\"\n];\n",
+		},
+		{
+			"// header\n\n\n\nlet a = 1; // one\n\nlet b = 2;\n// footer",
+			"// header\n\nlet a = 1; // one\n\nlet b = 2;\n// footer\n",
+		},
+		{
+			"let f = fn() {\n  // nothing yet\n}",
+			"let f = fn() {\n    // nothing yet\n};\n",
+		},
+		{
+			"let f = fn() {\n  a;\n\n\n  b // last\n  // end\n}",
+			"let f = fn() {\n    a;\n\n    b; // last\n    // end\n};\n",
+		},
+		{
+			"let g = fn(x) { x } // c",
+			"let g = fn(x) {\n    x;\n}; // c\n",
+		},
+		{
+			"if (x) { 1 } else { 2 } // c\nputs(x)",
+			"if (x) {\n    1;\n} else {\n    2;\n} // c\nputs(x);\n",
+		},
+		{
+			"let h = {\n  \"a\": 1, // one\n  \"b\": 2\n};",
+			"let h = {\n    \"a\": 1, // one\n    \"b\": 2\n};\n",
+		},
+		{
+			"let xs = [\n  // first\n  1,\n  2, 3 // rest\n]",
+			"let xs = [\n    // first\n    1,\n    2,\n    3 // rest\n];\n",
+		},
+		{
+			"let xs = [1, 2] // c",
+			"let xs = [1, 2]; // c\n",
+		},
+		{
+			"let xs = [\n  1\n]; // c\nxs",
+			"let xs = [1]; // c\nxs;\n",
+		},
+		{
+			"let s = #{\n  1\n  // more later\n}",
+			"let s = #{\n    1\n    // more later\n};\n",
+		},
+	}
+
+	for i, tt := range tests {
+		actual, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("[%d] format failed: %s", i, err)
+		}
+		if string(actual) != tt.expected {
+			t.Errorf("[%d] wrong output.\nwant=%q\ngot =%q", i, tt.expected, actual)
+		}
+
+		again, err := Source(actual)
+		if err != nil {
+			t.Fatalf("[%d] formatting the output failed: %s", i, err)
+		}
+		if string(again) != string(actual) {
+			t.Errorf("[%d] not idempotent.\nfirst =%q\nsecond=%q", i, actual, again)
+		}
+	}
+}
+
+func TestSourceKeepsMeaning(t *testing.T) {
+	inputs := []string{
+		"a - (b - c) - d",
+		"a * (b + c) / d",
+		"(a < b) == (c > d)",
+		"-(-a)",
+		"(fn(x) { x })(1)[0]",
+		"if (a) { b } else { c }(d)",
+		`{"a": [1, 2], true: fn() { 1 }}["a"][1]`,
+	}
+
+	for _, input := range inputs {
+		formatted, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("format failed: %s", err)
+		}
+
+		if parse(t, string(formatted)) != parse(t, input) {
+			t.Errorf("formatting changed the meaning of %q, got %q", input, formatted)
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	_, err := Source([]byte("let = 5"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program.String()
+}
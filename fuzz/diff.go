@@ -0,0 +1,182 @@
+package fuzz
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Kind is the category of the result of a run.
+type Kind int
+
+const (
+	Value Kind = iota
+	RuntimeError
+	CompileError
+	Panic
+	// LimitExceeded runs can't be compared, the engines count steps and
+	// calls differently.
+	LimitExceeded
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Value:
+		return "value"
+	case RuntimeError:
+		return "runtime error"
+	case CompileError:
+		return "compile error"
+	case Panic:
+		return "panic"
+	case LimitExceeded:
+		return "limit exceeded"
+	default:
+		return "unknown"
+	}
+}
+
+// Outcome is the result of running a program in one engine. Detail is the
+// Inspect() output of the value or the error message.
+type Outcome struct {
+	Kind   Kind
+	Detail string
+}
+
+func (o Outcome) String() string {
+	return o.Kind.String() + ": " + strings.ReplaceAll(o.Detail, "\n", " ")
+}
+
+// Limits keep generated programs from running forever.
+var Limits = object.Limits{
+	MaxSteps:          1_000_000,
+	MaxCallDepth:      500,
+	MaxCollectionSize: 10_000,
+	Timeout:           time.Second,
+}
+
+// Evaluate runs program in the tree-walking evaluator.
+func Evaluate(program *ast.Program) (outcome Outcome) {
+	defer recoverPanic(&outcome)
+
+	result, err := evaluator.EvalContext(context.Background(), program, object.NewEnvironment(), Limits)
+	if err != nil {
+		return errorOutcome(err)
+	}
+	return objectOutcome(result)
+}
+
+// Execute compiles program and runs it in the VM.
+func Execute(program *ast.Program) (outcome Outcome) {
+	defer recoverPanic(&outcome)
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return Outcome{Kind: CompileError, Detail: err.Error()}
+	}
+
+	machine := vm.New(comp.Bytecode().Instructions, comp.Bytecode().Constants)
+	machine.SetLimits(Limits)
+	if err := machine.Run(); err != nil {
+		return errorOutcome(err)
+	}
+	return objectOutcome(machine.LastPoppedStackElem())
+}
+
+func objectOutcome(obj object.Object) Outcome {
+	if obj == nil {
+		return Outcome{Kind: Value, Detail: "null"}
+	}
+	if err, ok := obj.(*object.Error); ok {
+		return Outcome{Kind: RuntimeError, Detail: err.Message}
+	}
+	return Outcome{Kind: Value, Detail: obj.Inspect()}
+}
+
+func errorOutcome(err error) Outcome {
+	var limitErr *object.LimitError
+	if errors.As(err, &limitErr) {
+		return Outcome{Kind: LimitExceeded, Detail: err.Error()}
+	}
+	return Outcome{Kind: RuntimeError, Detail: err.Error()}
+}
+
+func recoverPanic(outcome *Outcome) {
+	if r := recover(); r != nil {
+		*outcome = Outcome{Kind: Panic, Detail: fmt.Sprint(r)}
+	}
+}
+
+// A Divergence is a program the engines disagree on.
+type Divergence struct {
+	Source string
+	Eval   Outcome
+	VM     Outcome
+}
+
+func (d *Divergence) String() string {
+	return fmt.Sprintf("evaluator: %s\nvm: %s\n%s", d.Eval, d.VM, d.Source)
+}
+
+// sameKind reports whether other fails the same way as d.
+func (d *Divergence) sameKind(other *Divergence) bool {
+	return d.Eval.Kind == other.Eval.Kind && d.VM.Kind == other.VM.Kind
+}
+
+// Check runs src through both engines and returns how they disagree, or
+// nil if they agree. Errors only have to agree on their kind, the engines
+// word their messages differently. Sources that don't parse are ignored.
+func Check(src string) *Divergence {
+	program := parse(src)
+	if program == nil {
+		return nil
+	}
+
+	// each engine gets its own tree, in case one of them changes it
+	evalOutcome := Evaluate(program)
+	vmOutcome := Execute(parse(src))
+
+	if evalOutcome.Kind == LimitExceeded || vmOutcome.Kind == LimitExceeded {
+		return nil
+	}
+	if evalOutcome.Kind == vmOutcome.Kind && (evalOutcome.Kind != Value || evalOutcome.Detail == vmOutcome.Detail) {
+		return nil
+	}
+
+	return &Divergence{Source: src, Eval: evalOutcome, VM: vmOutcome}
+}
+
+func parse(src string) *ast.Program {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil
+	}
+	return program
+}
+
+// Save writes the divergence to a file in dir named after its source and
+// returns the path. The outcomes are written as comments on top.
+func Save(dir string, d *Divergence) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	sum := sha1.Sum([]byte(d.Source))
+	path := filepath.Join(dir, fmt.Sprintf("%x.monkey", sum[:6]))
+	content := fmt.Sprintf("// evaluator: %s\n// vm: %s\n%s", d.Eval, d.VM, d.Source)
+
+	return path, os.WriteFile(path, []byte(content), 0o644)
+}
@@ -0,0 +1,117 @@
+package fuzz
+
+import (
+	"monkey/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// divergenceDir collects the minimized programs the fuzzer found.
+const divergenceDir = "testdata/divergences"
+
+func FuzzEngines(f *testing.F) {
+	for seed := int64(0); seed < 200; seed++ {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		src := format.Node(NewGenerator(seed).Program())
+
+		d := Check(src)
+		if d == nil {
+			return
+		}
+
+		d = Minimize(d)
+		path, err := Save(divergenceDir, d)
+		if err != nil {
+			t.Errorf("could not save divergence: %s", err)
+		}
+		t.Errorf("engines disagree, saved to %s\n%s", path, d)
+	})
+}
+
+func TestGeneratedProgramsCompile(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		src := format.Node(NewGenerator(seed).Program())
+
+		program := parse(src)
+		if program == nil {
+			t.Fatalf("generated program doesn't parse:\n%s", src)
+		}
+		if outcome := Execute(program); outcome.Kind == CompileError || outcome.Kind == Panic {
+			t.Fatalf("generated program failed: %s\n%s", outcome, src)
+		}
+	}
+}
+
+// TestSavedDivergences makes sure divergences stay fixed once they are.
+func TestSavedDivergences(t *testing.T) {
+	paths, _ := filepath.Glob(filepath.Join(divergenceDir, "*.monkey"))
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("could not read %s: %s", path, err)
+		}
+		if d := Check(string(src)); d != nil {
+			t.Errorf("%s: engines disagree\n%s", path, d)
+		}
+	}
+}
+
+func TestQuotesAgree(t *testing.T) {
+	sources := []string{
+		`quote(1 + unquote(2 * 3))`,
+		`let f = fn(x) { quote(g(unquote(x), unquote_splice([x, x]))) }; f("a")`,
+		`let n = 5; eval_quote(quote(unquote(n) * 2))`,
+		`eval_quote(make_call("len", [quote([1, 2])]))`,
+		`node_children(quote(f(x)))`,
+		`quote(unquote(fn() { 1 }))`,
+		`eval_quote(quote(x))`,
+	}
+
+	for _, src := range sources {
+		if d := Check(src); d != nil {
+			t.Errorf("engines disagree\n%s", d)
+		}
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	// pretend the engines disagree on every program calling len
+	check := func(src string) *Divergence {
+		if !strings.Contains(src, "len(") {
+			return nil
+		}
+		return &Divergence{Source: src, Eval: Outcome{Kind: Value}, VM: Outcome{Kind: RuntimeError}}
+	}
+
+	src := `
+    let a = 1;
+    let b = fn(x) { x * 2 };
+    let c = if (a > 0) { b(len([1, 2, 3])) } else { 0 };
+    c + a;
+    `
+	d := minimize(check(src), check)
+
+	want := "len([]);\n"
+	if d.Source != want {
+		t.Errorf("wrong minimized program. want=%q, got=%q", want, d.Source)
+	}
+
+	// a divergence on any program mentioning len mustn't lose the call
+	check = func(src string) *Divergence {
+		if !strings.Contains(src, "len") {
+			return nil
+		}
+		return &Divergence{Source: src, Eval: Outcome{Kind: Value}, VM: Outcome{Kind: RuntimeError}}
+	}
+	d = minimize(check(`len(pop); 11;`), check)
+
+	want = "len(pop);\n"
+	if d.Source != want {
+		t.Errorf("wrong minimized program. want=%q, got=%q", want, d.Source)
+	}
+}
@@ -0,0 +1,288 @@
+// Package fuzz generates random Monkey programs and runs them through both
+// the evaluator and the compiler and VM to find programs the two engines
+// disagree on.
+package fuzz
+
+import (
+	"math/rand"
+	"monkey/ast"
+)
+
+// Type is the static type of a generated expression.
+type Type int
+
+const (
+	Int Type = iota
+	Bool
+	String
+	Array // array of integers
+	Hash  // hash from strings to integers
+	Func  // function from an integer to an integer
+)
+
+var (
+	allTypes = []Type{Int, Bool, String, Array, Hash, Func}
+	// resultTypes are the types a program may end in. Functions print
+	// differently in the two engines, so they're left out.
+	resultTypes = []Type{Int, Bool, String, Array, Hash}
+	words       = []string{"", "a", "b", "monkey"}
+)
+
+type variable struct {
+	name string
+	typ  Type
+	// predeclared names are known before the statements of their block
+	// run, which is all a hoisted function can refer to
+	predeclared bool
+}
+
+// A Generator produces random, well-typed programs. Values may still turn
+// out to be null at runtime, for example by indexing past the end of an
+// array, so not every program runs without errors.
+type Generator struct {
+	MaxDepth      int
+	MaxStatements int
+
+	rand  *rand.Rand
+	vars  []variable
+	names int
+}
+
+// NewGenerator returns a generator that always produces the same programs
+// for the same seed.
+func NewGenerator(seed int64) *Generator {
+	return &Generator{
+		MaxDepth:      4,
+		MaxStatements: 6,
+		rand:          rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Program generates a program that binds a few values and ends in an
+// expression statement.
+func (g *Generator) Program() *ast.Program {
+	g.vars = nil
+	program := &ast.Program{}
+
+	for i := g.rand.Intn(g.MaxStatements); i > 0; i-- {
+		program.Statements = append(program.Statements, g.binding(0))
+	}
+
+	result := resultTypes[g.rand.Intn(len(resultTypes))]
+	program.Statements = append(program.Statements, &ast.ExpressionStatement{Expression: g.expression(result, 0)})
+
+	return program
+}
+
+// binding generates a let or function statement and brings its name into
+// scope after generating the value, so nothing refers to itself.
+func (g *Generator) binding(depth int) ast.Statement {
+	name := g.newName("v")
+
+	if g.rand.Intn(4) == 0 {
+		// functions at the top level are hoisted
+		vars := g.vars
+		if depth == 0 {
+			g.vars = predeclared(vars)
+		}
+		fn := g.function(depth)
+		g.vars = vars
+
+		fn.Name = name
+		g.vars = append(g.vars, variable{name, Func, true})
+		return &ast.FunctionStatement{Name: &ast.Identifier{Value: name}, Function: fn}
+	}
+
+	typ := allTypes[g.rand.Intn(len(allTypes))]
+	value := g.expression(typ, depth)
+	_, isFn := value.(*ast.FunctionLiteral)
+	g.vars = append(g.vars, variable{name, typ, isFn})
+	return &ast.LetStatement{Name: &ast.Identifier{Value: name}, Value: value}
+}
+
+// newName returns a fresh identifier. Identifiers can't contain digits,
+// so the counter is written in letters.
+func (g *Generator) newName(prefix string) string {
+	g.names++
+	name := []byte{}
+	for n := g.names; n > 0; n /= 26 {
+		name = append([]byte{byte('a' + n%26)}, name...)
+	}
+	return prefix + "_" + string(name)
+}
+
+func (g *Generator) expression(typ Type, depth int) ast.Expression {
+	if depth >= g.MaxDepth || g.rand.Intn(g.MaxDepth+1) < depth {
+		return g.leaf(typ, depth)
+	}
+	depth++
+
+	if g.rand.Intn(8) == 0 {
+		return g.ifExpression(typ, depth)
+	}
+
+	switch typ {
+	case Int:
+		switch g.rand.Intn(8) {
+		case 0:
+			return prefix("-", g.expression(Int, depth))
+		case 1:
+			return infix(g.expression(Int, depth), "+", g.expression(Int, depth))
+		case 2:
+			return infix(g.expression(Int, depth), "-", g.expression(Int, depth))
+		case 3:
+			return infix(g.expression(Int, depth), "*", g.expression(Int, depth))
+		case 4:
+			return call("len", g.expression(g.pick(Array, String), depth))
+		case 5:
+			return &ast.CallExpression{Function: g.expression(Func, depth), Arguments: []ast.Expression{g.expression(Int, depth)}}
+		case 6:
+			return &ast.IndexExpression{Left: g.expression(Array, depth), Index: g.expression(Int, depth)}
+		default:
+			pair := g.hashKey()
+			return &ast.IndexExpression{Left: g.expression(Hash, depth), Index: pair}
+		}
+
+	case Bool:
+		switch g.rand.Intn(6) {
+		case 0:
+			return prefix("!", g.expression(g.pick(allTypes...), depth))
+		case 1:
+			return infix(g.expression(Int, depth), g.pickString("<", ">", "==", "!="), g.expression(Int, depth))
+		case 2:
+			return infix(g.expression(Bool, depth), g.pickString("==", "!="), g.expression(Bool, depth))
+		case 3:
+			return infix(g.expression(String, depth), g.pickString("==", "!="), g.expression(String, depth))
+		default:
+			return g.leaf(Bool, depth)
+		}
+
+	case String:
+		return infix(g.expression(String, depth), "+", g.expression(String, depth))
+
+	case Array:
+		switch g.rand.Intn(4) {
+		case 0:
+			return call("push", g.expression(Array, depth), g.expression(Int, depth))
+		case 1:
+			return call(g.pickString("rest", "pop"), g.expression(Array, depth))
+		default:
+			return g.arrayLiteral(depth)
+		}
+
+	case Func:
+		return g.function(depth)
+
+	default:
+		return g.leaf(typ, depth)
+	}
+}
+
+// leaf generates a variable or a literal of typ.
+func (g *Generator) leaf(typ Type, depth int) ast.Expression {
+	candidates := []string{}
+	for _, v := range g.vars {
+		if v.typ == typ {
+			candidates = append(candidates, v.name)
+		}
+	}
+	if len(candidates) > 0 && g.rand.Intn(2) == 0 {
+		return &ast.Identifier{Value: candidates[g.rand.Intn(len(candidates))]}
+	}
+
+	switch typ {
+	case Int:
+		return &ast.IntegerLiteral{Value: int64(g.rand.Intn(20))}
+	case Bool:
+		return &ast.Boolean{Value: g.rand.Intn(2) == 0}
+	case String:
+		return &ast.StringLiteral{Value: g.pickString(words...)}
+	case Array:
+		return g.arrayLiteral(g.MaxDepth)
+	case Hash:
+		hash := &ast.HashLiteral{}
+		for i := g.rand.Intn(3); i > 0; i-- {
+			hash.Data = append(hash.Data, ast.HashPair{Key: g.hashKey(), Value: g.leaf(Int, depth)})
+		}
+		return hash
+	default:
+		return g.function(g.MaxDepth)
+	}
+}
+
+func (g *Generator) arrayLiteral(depth int) ast.Expression {
+	array := &ast.ArrayLiteral{Elements: []ast.Expression{}}
+	for i := g.rand.Intn(4); i > 0; i-- {
+		array.Elements = append(array.Elements, g.expression(Int, depth))
+	}
+	return array
+}
+
+func (g *Generator) hashKey() ast.Expression {
+	return &ast.StringLiteral{Value: g.pickString(words...)}
+}
+
+func (g *Generator) ifExpression(typ Type, depth int) ast.Expression {
+	return &ast.IfExpression{
+		Condition:   g.expression(Bool, depth),
+		Consequence: g.block(typ, depth),
+		Alternative: g.block(typ, depth),
+	}
+}
+
+// block generates a block with a few local bindings that ends in an
+// expression of typ. The bindings go out of scope after the block.
+func (g *Generator) block(typ Type, depth int) *ast.BlockStatement {
+	outer := len(g.vars)
+	defer func() { g.vars = g.vars[:outer] }()
+
+	block := &ast.BlockStatement{}
+	for i := g.rand.Intn(2); i > 0; i-- {
+		block.Statements = append(block.Statements, g.binding(depth))
+	}
+	block.Statements = append(block.Statements, &ast.ExpressionStatement{Expression: g.expression(typ, depth)})
+	return block
+}
+
+func (g *Generator) function(depth int) *ast.FunctionLiteral {
+	outer := len(g.vars)
+	defer func() { g.vars = g.vars[:outer] }()
+
+	param := g.newName("p")
+	g.vars = append(g.vars, variable{param, Int, false})
+
+	return &ast.FunctionLiteral{
+		Parameters: []*ast.Identifier{{Value: param}},
+		Body:       g.block(Int, depth),
+	}
+}
+
+func predeclared(vars []variable) []variable {
+	known := []variable{}
+	for _, v := range vars {
+		if v.predeclared {
+			known = append(known, v)
+		}
+	}
+	return known
+}
+
+func (g *Generator) pick(types ...Type) Type {
+	return types[g.rand.Intn(len(types))]
+}
+
+func (g *Generator) pickString(options ...string) string {
+	return options[g.rand.Intn(len(options))]
+}
+
+func prefix(operator string, right ast.Expression) ast.Expression {
+	return &ast.PrefixExpression{Operator: operator, Right: right}
+}
+
+func infix(left ast.Expression, operator string, right ast.Expression) ast.Expression {
+	return &ast.InfixExpression{Left: left, Operator: operator, Right: right}
+}
+
+func call(name string, args ...ast.Expression) ast.Expression {
+	return &ast.CallExpression{Function: &ast.Identifier{Value: name}, Arguments: args}
+}
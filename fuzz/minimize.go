@@ -0,0 +1,146 @@
+package fuzz
+
+import (
+	"monkey/ast"
+	"monkey/format"
+	"reflect"
+)
+
+// Minimize shrinks the program of d as long as the engines keep
+// disagreeing the same way. It tries dropping statements and array
+// elements and replacing expressions by one of their subexpressions of the
+// same kind, and keeps every change that makes the source shorter.
+func Minimize(d *Divergence) *Divergence {
+	return minimize(d, Check)
+}
+
+func minimize(d *Divergence, check func(string) *Divergence) *Divergence {
+	program := parse(d.Source)
+	if program == nil {
+		return d
+	}
+
+	for {
+		smaller := shrink(program, d, check)
+		if smaller == nil {
+			return d
+		}
+		program, d = smaller.program, smaller.divergence
+	}
+}
+
+type reduction struct {
+	program    *ast.Program
+	divergence *Divergence
+}
+
+// shrink returns the first reduction of program that still diverges like
+// d, or nil if there is none.
+func shrink(program *ast.Program, d *Divergence, check func(string) *Divergence) *reduction {
+	count := 0
+	ast.Transform(program, func(n ast.Node) ast.Node {
+		count++
+		return n
+	})
+
+	for target := 0; target < count; target++ {
+		var replacements []ast.Node
+		visit(program, target, func(n ast.Node) ast.Node {
+			replacements = reductions(n)
+			return n
+		})
+
+		for _, r := range replacements {
+			candidate := visit(program, target, func(ast.Node) ast.Node { return r })
+			src := format.Node(candidate)
+			if len(src) >= len(d.Source) {
+				continue
+			}
+
+			if next := check(src); next != nil && next.sameKind(d) {
+				return &reduction{program: parse(src), divergence: next}
+			}
+		}
+	}
+
+	return nil
+}
+
+// visit returns a copy of program with the target'th node, counted in the
+// order ast.Transform visits them, replaced by the result of f.
+func visit(program *ast.Program, target int, f ast.ModifierFunc) *ast.Program {
+	i := 0
+	return ast.Transform(program, func(n ast.Node) ast.Node {
+		defer func() { i++ }()
+		if i == target {
+			return f(n)
+		}
+		return n
+	}).(*ast.Program)
+}
+
+// reductions returns smaller nodes that could take the place of n. An
+// expression is only replaced by one of the same kind, like a call by a
+// call, so the value it stands for doesn't turn into something else, say
+// a builtin where its result used to be, which diverges for other
+// reasons.
+func reductions(n ast.Node) []ast.Node {
+	smaller := []ast.Node{}
+
+	switch n := n.(type) {
+	case *ast.Program:
+		for i := range n.Statements {
+			smaller = append(smaller, &ast.Program{Statements: without(n.Statements, i)})
+		}
+		return smaller
+
+	case *ast.BlockStatement:
+		for i := range n.Statements {
+			smaller = append(smaller, &ast.BlockStatement{Statements: without(n.Statements, i)})
+		}
+		return smaller
+
+	case *ast.LetStatement:
+		return append(smaller, &ast.ExpressionStatement{Expression: n.Value})
+
+	case *ast.FunctionLiteral:
+		// a function can only be replaced by a function
+		return smaller
+
+	case *ast.ArrayLiteral:
+		for i := range n.Elements {
+			smaller = append(smaller, &ast.ArrayLiteral{Token: n.Token, Elements: withoutExpression(n.Elements, i), Rbracket: n.Rbracket})
+		}
+
+	case *ast.IfExpression:
+		// the value of an if is the value of the branch taken
+		for _, block := range []*ast.BlockStatement{n.Consequence, n.Alternative} {
+			if block == nil || len(block.Statements) != 1 {
+				continue
+			}
+			if es, ok := block.Statements[0].(*ast.ExpressionStatement); ok {
+				smaller = append(smaller, es.Expression)
+			}
+		}
+	}
+
+	if _, ok := n.(ast.Expression); !ok {
+		return smaller
+	}
+	for _, child := range ast.Children(n) {
+		if exp, ok := child.(ast.Expression); ok && reflect.TypeOf(exp) == reflect.TypeOf(n) {
+			smaller = append(smaller, exp)
+		}
+	}
+	return smaller
+}
+
+func without(stmts []ast.Statement, i int) []ast.Statement {
+	rest := append([]ast.Statement{}, stmts[:i]...)
+	return append(rest, stmts[i+1:]...)
+}
+
+func withoutExpression(exps []ast.Expression, i int) []ast.Expression {
+	rest := append([]ast.Expression{}, exps[:i]...)
+	return append(rest, exps[i+1:]...)
+}
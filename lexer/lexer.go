@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"monkey/token"
+	"strings"
 )
 
 type Lexer struct {
@@ -11,10 +12,13 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	line         int
+	column       int
+	comments     []token.Token
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
@@ -24,6 +28,8 @@ func (l *Lexer) NextToken() (token.Token, error) {
 
 	l.skipWhitespace()
 
+	line, column := l.line, l.column
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -71,6 +77,13 @@ func (l *Lexer) NextToken() (token.Token, error) {
 		tok = newToken(token.RBRACE, l.ch)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
+	case '#':
+		if l.peekChar() == '{' {
+			l.readChar()
+			tok = token.Token{Type: token.SET_LBRACE, Literal: "#{"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case '"':
@@ -83,14 +96,30 @@ func (l *Lexer) NextToken() (token.Token, error) {
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
+	case 'b':
+		if l.peekChar() != '"' {
+			tok.Literal = l.readIdentifier()
+			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line, tok.Column = line, column
+			return tok, nil
+		}
+		l.readChar()
+		if bytes, err := l.readBytes(); err == nil {
+			tok.Type = token.BYTES
+			tok.Literal = bytes
+		} else {
+			return token.Token{Type: token.ILLEGAL}, err
+		}
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line, tok.Column = line, column
 			return tok, nil
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
+			tok.Line, tok.Column = line, column
 			return tok, nil
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -98,16 +127,45 @@ func (l *Lexer) NextToken() (token.Token, error) {
 	}
 
 	l.readChar()
+	tok.Line, tok.Column = line, column
 	return tok, nil
 }
 
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+func (l *Lexer) readComment() {
+	tok := token.Token{Type: token.COMMENT, Line: l.line, Column: l.column}
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	tok.Literal = strings.TrimRight(l.input[position:l.position], " \t\r")
+	l.comments = append(l.comments, tok)
+}
+
+// Comments returns the `//` comments skipped so far, in source order.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -143,6 +201,66 @@ func (l *Lexer) readString() (string, error) {
 
 }
 
+// readBytes reads a byte string literal, l.ch being its opening quote. The
+// literal of its token holds the bytes. Besides the escapes of strings,
+// byte strings know \n, \r, \t and \x followed by two hex digits.
+func (l *Lexer) readBytes() (string, error) {
+	var out strings.Builder
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String(), nil
+		case 0:
+			return "", errors.New("Unterminated byte string literal")
+		case '\\':
+			l.readChar()
+			switch l.ch {
+			case '\\', '"':
+				out.WriteByte(l.ch)
+			case 'n':
+				out.WriteByte('\n')
+			case 'r':
+				out.WriteByte('\r')
+			case 't':
+				out.WriteByte('\t')
+			case 'x':
+				hi, lo := unhex(l.peekChar()), unhex(l.peekCharAt(1))
+				if hi < 0 || lo < 0 {
+					return "", fmt.Errorf("Found wrong hex escape in byte string: \\x%c%c", l.peekChar(), l.peekCharAt(1))
+				}
+				out.WriteByte(byte(hi<<4 | lo))
+				l.readChar()
+				l.readChar()
+			default:
+				return "", fmt.Errorf("Found wrong escape char: %v", l.ch)
+			}
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
+func unhex(ch byte) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'F':
+		return int(ch-'A') + 10
+	default:
+		return -1
+	}
+}
+
+func (l *Lexer) peekCharAt(offset int) byte {
+	if l.readPosition+offset >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPosition+offset]
+}
+
 func (l *Lexer) peekChar() byte {
 	if l.readPosition >= len(l.input) {
 		return 0
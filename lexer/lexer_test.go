@@ -15,6 +15,7 @@ func TestNextToken(t *testing.T) {
     [1, 2];
     {"A" : true, 123 : "false", true: "false"}
     macro(x, y) { x + y; };
+    #{1} in s is t
     `
 
 	tests := []struct {
@@ -65,6 +66,13 @@ func TestNextToken(t *testing.T) {
 		{token.SEMICOLON, ";"},
 		{token.RBRACE, "}"},
 		{token.SEMICOLON, ";"},
+		{token.SET_LBRACE, "#{"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.IN, "in"},
+		{token.IDENT, "s"},
+		{token.IS, "is"},
+		{token.IDENT, "t"},
 		{token.EOF, ""},
 	}
 
@@ -205,3 +213,116 @@ func TestSimpleProgram(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "a b";`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"a b", 2, 7},
+		{";", 2, 12},
+		{"", 2, 13},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok, err := l.NextToken()
+		failOnError(t, i, err)
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestBytesLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{`b""`, "", ""},
+		{`b"abc"`, "abc", ""},
+		{`b"\x00\xfF\"\\\n\r\t"`, "\x00\xff\"\\\n\r\t", ""},
+		{`b"\x0g"`, "", "Found wrong hex escape in byte string: \\x0g"},
+		{`b"\q"`, "", "Found wrong escape char: 113"},
+		{`b"abc`, "", "Unterminated byte string literal"},
+	}
+
+	for _, tt := range tests {
+		tok, err := New(tt.input).NextToken()
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("wrong error for %s. expected=%q, got=%v", tt.input, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("NextToken() returned an error for %s: %s", tt.input, err)
+		}
+		if tok.Type != token.BYTES || tok.Literal != tt.expected {
+			t.Errorf("wrong token for %s. expected=BYTES %q, got=%s %q", tt.input, tt.expected, tok.Type, tok.Literal)
+		}
+	}
+
+	// b is still an identifier
+	tok, _ := New("bytes").NextToken()
+	if tok.Type != token.IDENT || tok.Literal != "bytes" {
+		t.Errorf("wrong token for bytes. got=%s %q", tok.Type, tok.Literal)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 10 / 2; // trailing
+// last`
+
+	expected := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SLASH, token.INT, token.SEMICOLON, token.EOF,
+	}
+
+	l := New(input)
+	for i, tt := range expected {
+		tok, err := l.NextToken()
+		failOnError(t, i, err)
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+
+	comments := l.Comments()
+	if len(comments) != 3 {
+		t.Fatalf("wrong number of comments. expected=3, got=%d", len(comments))
+	}
+
+	tests := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"// leading", 1, 1},
+		{"// trailing", 2, 17},
+		{"// last", 3, 1},
+	}
+	for i, tt := range tests {
+		c := comments[i]
+		if c.Type != token.COMMENT || c.Literal != tt.literal || c.Line != tt.line || c.Column != tt.column {
+			t.Errorf("comments[%d] wrong. expected=%q at %d:%d, got=%+v", i, tt.literal, tt.line, tt.column, c)
+		}
+	}
+}
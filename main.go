@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"monkey/ast"
 	"monkey/compiler"
 	"monkey/evaluator"
+	"monkey/format"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
@@ -14,6 +18,7 @@ import (
 	"os"
 	"os/user"
 	"path"
+	"strings"
 )
 
 type Mode int
@@ -23,6 +28,9 @@ const (
 	COMPILE
 	RUN
 	SCRIPT
+	AST
+	FORMAT
+	EXPAND
 )
 
 func main() {
@@ -38,6 +46,12 @@ func main() {
 			mode = RUN
 		case "s", "script":
 			mode = SCRIPT
+		case "ast":
+			mode = AST
+		case "fmt", "format":
+			mode = FORMAT
+		case "expand":
+			mode = EXPAND
 		case "repl", "eval", "console":
 			mode = REPL
 		default:
@@ -87,6 +101,54 @@ func main() {
 
 		runScript(filename)
 
+	case AST:
+		astFlags := flag.NewFlagSet("ast", flag.ExitOnError)
+		asJSON := astFlags.Bool("json", false, "print the syntax tree as JSON")
+		astFlags.Parse(flag.Args()[1:])
+
+		filename := astFlags.Arg(0)
+		if filename == "" {
+			fmt.Println("the ast command requires you to specify a script file to parse.")
+			fmt.Println("Like this: monkey ast --json chimp.monkey")
+			os.Exit(-1)
+		}
+
+		printAst(filename, *asJSON)
+
+	case FORMAT:
+		fmtFlags := flag.NewFlagSet("fmt", flag.ExitOnError)
+		write := fmtFlags.Bool("w", false, "write the result to the file instead of printing it")
+		fmtFlags.Parse(flag.Args()[1:])
+
+		if fmtFlags.NArg() == 0 {
+			fmt.Println("the fmt command requires you to specify one or more script files to format.")
+			fmt.Println("Like this: monkey fmt -w chimp.monkey")
+			os.Exit(-1)
+		}
+
+		ok := true
+		for _, filename := range fmtFlags.Args() {
+			ok = formatScript(filename, *write) && ok
+		}
+		if !ok {
+			os.Exit(-1)
+		}
+
+	case EXPAND:
+		expandFlags := flag.NewFlagSet("expand", flag.ExitOnError)
+		trace := expandFlags.Bool("trace", false, "print every macro call and the code it expanded to")
+		depth := expandFlags.Int("depth", evaluator.MaxExpansionDepth, "maximum depth of macro calls produced by macros")
+		expandFlags.Parse(flag.Args()[1:])
+
+		filename := expandFlags.Arg(0)
+		if filename == "" {
+			fmt.Println("the expand command requires you to specify a script file to expand.")
+			fmt.Println("Like this: monkey expand --trace chimp.monkey")
+			os.Exit(-1)
+		}
+
+		expandScript(filename, *trace, *depth)
+
 	default:
 		fmt.Println("Not implemented yet...")
 		os.Exit(-1)
@@ -152,7 +214,103 @@ func compileScript(filename string) {
 	}
 }
 
-func loadScript(filename string) *compiler.Bytecode {
+func printAst(filename string, asJSON bool) {
+	if _, err := os.Stat(filename); err != nil {
+		// filename not found, try with .monkey extension
+		if _, err := os.Stat(filename + ".monkey"); err != nil {
+			fmt.Println(fmt.Sprintf("Can't find '%s(.monkey)'", filename))
+			os.Exit(-1)
+		}
+		filename = filename + ".monkey"
+	}
+
+	program := parseScript(filename)
+
+	if !asJSON {
+		fmt.Println(program.String())
+		return
+	}
+
+	out, err := json.MarshalIndent(program, "", "  ")
+	if err != nil {
+		fmt.Println("Error encoding the syntax tree: ", err.Error())
+		os.Exit(-1)
+	}
+	fmt.Println(string(out))
+}
+
+func expandScript(filename string, trace bool, depth int) {
+	if _, err := os.Stat(filename); err != nil {
+		// filename not found, try with .monkey extension
+		if _, err := os.Stat(filename + ".monkey"); err != nil {
+			fmt.Println(fmt.Sprintf("Can't find '%s(.monkey)'", filename))
+			os.Exit(-1)
+		}
+		filename = filename + ".monkey"
+	}
+
+	program := parseScript(filename)
+
+	expander := &evaluator.Expander{Env: object.NewEnvironment(), MaxDepth: depth, Dir: path.Dir(filename)}
+	program, err := expander.Define(program)
+	if err != nil {
+		fmt.Println("Error expanding macros: ", err.Error())
+		os.Exit(-1)
+	}
+
+	if trace {
+		// the trace is printed as comments, so the output stays a program
+		expander.Trace = func(step evaluator.ExpansionStep) {
+			indent := "// " + strings.Repeat("    ", step.Depth)
+			fmt.Println(indent + format.Node(step.Call) + " expands to")
+			for _, line := range strings.Split(strings.TrimSuffix(format.Node(step.Result), "\n"), "\n") {
+				fmt.Println(indent + "    " + line)
+			}
+		}
+	}
+
+	expanded, err := expander.Expand(program)
+	if err != nil {
+		fmt.Println("Error expanding macros: ", err.Error())
+		os.Exit(-1)
+	}
+
+	if trace {
+		fmt.Println()
+	}
+	fmt.Print(format.Node(expanded))
+}
+
+func formatScript(filename string, write bool) bool {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Println("Can't read from", filename, ":", err.Error())
+		return false
+	}
+
+	formatted, err := format.Source(src)
+	if err != nil {
+		fmt.Println(filename, ":", err.Error())
+		return false
+	}
+
+	if !write {
+		fmt.Print(string(formatted))
+		return true
+	}
+
+	if bytes.Equal(src, formatted) {
+		return true
+	}
+
+	if err := os.WriteFile(filename, formatted, 0666); err != nil {
+		fmt.Println("Error writing results: ", err.Error())
+		return false
+	}
+	return true
+}
+
+func parseScript(filename string) *ast.Program {
 	file, err := os.Open(filename)
 	if err != nil {
 		fmt.Println(fmt.Sprintf("Can't open file %s: %s", filename, err.Error()))
@@ -176,10 +334,6 @@ func loadScript(filename string) *compiler.Bytecode {
 	p := parser.New(l)
 	program := p.ParseProgram()
 
-	macroEnv := object.NewEnvironment()
-	evaluator.DefineMacros(program, macroEnv)
-	expanded := evaluator.ExpandMacros(program, macroEnv)
-
 	if len(p.Errors()) > 0 {
 		fmt.Println("Error(s) parsing the script:")
 		for _, e := range p.Errors() {
@@ -188,6 +342,25 @@ func loadScript(filename string) *compiler.Bytecode {
 		os.Exit(-1)
 	}
 
+	return program
+}
+
+func loadScript(filename string) *compiler.Bytecode {
+	program := parseScript(filename)
+	exported := evaluator.MacroDefinitions(program)
+
+	expander := &evaluator.Expander{Env: object.NewEnvironment(), Dir: path.Dir(filename)}
+	program, err := expander.Define(program)
+	if err != nil {
+		fmt.Println("Error expanding macros: ", err.Error())
+		os.Exit(-1)
+	}
+	expanded, err := expander.Expand(program)
+	if err != nil {
+		fmt.Println("Error expanding macros: ", err.Error())
+		os.Exit(-1)
+	}
+
 	c := compiler.New()
 	err = c.Compile(expanded)
 
@@ -196,7 +369,11 @@ func loadScript(filename string) *compiler.Bytecode {
 		os.Exit(-1)
 	}
 
-	return c.Bytecode()
+	bytecode := c.Bytecode()
+	if len(exported.Statements) > 0 {
+		bytecode.Macros = format.Node(exported)
+	}
+	return bytecode
 }
 
 func runScript(filename string) {
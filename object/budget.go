@@ -0,0 +1,196 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Limits bound the resources a single run of a program may use. A zero
+// field means there is no limit.
+type Limits struct {
+	// MaxSteps is the number of instructions the VM executes, or the
+	// number of nodes the evaluator evaluates.
+	MaxSteps int64
+	// MaxCallDepth is the number of nested function calls. Tail calls
+	// don't add to the depth.
+	MaxCallDepth int
+	// MaxCollectionSize is the number of elements of an array, pairs of a
+	// hash or bytes of a string or big integer a program may create.
+	MaxCollectionSize int
+	// Timeout is the wall-clock time a run may take.
+	Timeout time.Duration
+}
+
+type LimitKind int
+
+const (
+	StepLimit LimitKind = iota + 1
+	CallDepthLimit
+	CollectionSizeLimit
+	TimeLimit
+)
+
+// LimitError is returned when a run exceeds one of its Limits.
+type LimitError struct {
+	Kind  LimitKind
+	Limit int64
+
+	cause error
+}
+
+func (e *LimitError) Error() string {
+	switch e.Kind {
+	case StepLimit:
+		return fmt.Sprintf("step limit exceeded: more than %d steps", e.Limit)
+	case CallDepthLimit:
+		return fmt.Sprintf("call depth limit exceeded: more than %d nested calls", e.Limit)
+	case CollectionSizeLimit:
+		return fmt.Sprintf("collection size limit exceeded: more than %d elements", e.Limit)
+	case TimeLimit:
+		return "time limit exceeded"
+	default:
+		return "limit exceeded"
+	}
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.cause
+}
+
+// contextCheckInterval is the number of steps between two looks at the
+// context, checking it on every step would be too slow.
+const contextCheckInterval = 1024
+
+// A Budget keeps track of the resources used by a run. The methods of a
+// nil Budget never fail. Once a check failed, all later ones fail with the
+// same error.
+type Budget struct {
+	ctx    context.Context
+	limits Limits
+	steps  int64
+	depth  int
+	err    error
+}
+
+// NewBudget returns a budget for a run that ends when ctx is done. The
+// returned cancel function releases the timer of limits.Timeout.
+func NewBudget(ctx context.Context, limits Limits) (*Budget, context.CancelFunc) {
+	cancel := context.CancelFunc(func() {})
+	if limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+	}
+	return &Budget{ctx: ctx, limits: limits}, cancel
+}
+
+// Err returns the error of the first failed check, if any.
+func (b *Budget) Err() error {
+	if b == nil {
+		return nil
+	}
+	return b.err
+}
+
+// Step counts one step of execution.
+func (b *Budget) Step() error {
+	if b == nil || b.err != nil {
+		return b.Err()
+	}
+
+	b.steps++
+	if b.limits.MaxSteps > 0 && b.steps > b.limits.MaxSteps {
+		return b.fail(&LimitError{Kind: StepLimit, Limit: b.limits.MaxSteps})
+	}
+
+	if b.steps%contextCheckInterval == 0 {
+		return b.checkContext()
+	}
+
+	return nil
+}
+
+// checkContext fails if the context of the run is done.
+func (b *Budget) checkContext() error {
+	select {
+	case <-b.ctx.Done():
+		err := b.ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = &LimitError{Kind: TimeLimit, Limit: int64(b.limits.Timeout), cause: err}
+		}
+		return b.fail(err)
+	default:
+		return nil
+	}
+}
+
+// Enter counts a function call, Leave has to be called when it returns.
+func (b *Budget) Enter() error {
+	if b == nil || b.err != nil {
+		return b.Err()
+	}
+
+	b.depth++
+	if b.limits.MaxCallDepth > 0 && b.depth > b.limits.MaxCallDepth {
+		return b.fail(&LimitError{Kind: CallDepthLimit, Limit: int64(b.limits.MaxCallDepth)})
+	}
+	return nil
+}
+
+func (b *Budget) Leave() {
+	if b != nil && b.depth > 0 {
+		b.depth--
+	}
+}
+
+// CheckSize checks the size of a newly created array, hash, string or big
+// integer.
+func (b *Budget) CheckSize(obj Object) error {
+	size := 0
+	switch obj := obj.(type) {
+	case *Array:
+		size = obj.Len()
+	case *Hash:
+		size = obj.Len()
+	case *Set:
+		size = obj.Len()
+	case *String:
+		size = len(obj.Value)
+	case *Bytes:
+		size = len(obj.Value)
+	case *BigInt:
+		size = (obj.Value.BitLen() + 7) / 8
+	}
+	return b.CheckLength(int64(size))
+}
+
+// CheckBits checks the size of a big integer of about bits bits before it
+// is computed. A single operation on big integers can take long without
+// any steps being counted, so the context is checked as well.
+func (b *Budget) CheckBits(bits int64) error {
+	if b == nil || b.err != nil {
+		return b.Err()
+	}
+	if err := b.checkContext(); err != nil {
+		return err
+	}
+	return b.CheckLength((bits + 7) / 8)
+}
+
+// CheckLength checks the size of an array, hash or string before it is
+// created, so builtins can refuse to make one that is too large before
+// allocating it.
+func (b *Budget) CheckLength(size int64) error {
+	if b == nil || b.err != nil {
+		return b.Err()
+	}
+	if b.limits.MaxCollectionSize > 0 && size > int64(b.limits.MaxCollectionSize) {
+		return b.fail(&LimitError{Kind: CollectionSizeLimit, Limit: int64(b.limits.MaxCollectionSize)})
+	}
+	return nil
+}
+
+func (b *Budget) fail(err error) error {
+	b.err = err
+	return err
+}
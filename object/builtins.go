@@ -1,162 +1,767 @@
 package object
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
 )
 
-var Builtins = []struct {
-	Name    string
+// ArgSpec lists the object types a builtin accepts for one argument. An
+// empty ArgSpec accepts any object.
+type ArgSpec []ObjectType
+
+var Any = ArgSpec{}
+
+// A BuiltinDefinition describes a builtin function. Builtin checks the
+// number and types of the arguments against Params before calling Fn, so
+// Fn can rely on them.
+type BuiltinDefinition struct {
+	Name   string
+	Params []ArgSpec
+	// Variadic lets the last parameter take any number of arguments,
+	// including none.
+	Variadic bool
+	// Optional is the number of parameters at the end of Params that can
+	// be left out.
+	Optional int
+	Fn       BuiltinFunction
+	// BudgetFn, if set, is called instead of Fn by the engines with the
+	// budget of the run, so it can check the size of what it makes before
+	// allocating it. Fn then calls it without a budget.
+	BudgetFn func(b *Budget, args ...Object) Object
+	// EngineFn, if set, makes the builtin need the engine running it. The
+	// engines bind it with BindEngine once per runtime, Fn is what it does
+	// anywhere else.
+	EngineFn func(run Engine, args ...Object) Object
+
 	Builtin *Builtin
-}{
-	{
-		"len",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
+}
+
+// An Engine runs code for the builtins that need it, the way the
+// evaluator or the VM running them runs programs.
+type Engine func(node ast.Node) Object
 
+// Builtins are the builtin functions every Runtime starts with. Compiled
+// programs refer to builtins by their index, so new ones have to be added
+// at the end.
+//
+// len measures strings in bytes, as it always has. The string builtins
+// index_of, pad_left, pad_right and chars work on text and count
+// characters (runes) instead, so for "é" len is 2 but chars has one
+// element.
+var Builtins = defineBuiltins(
+	&BuiltinDefinition{
+		Name:   "len",
+		Params: []ArgSpec{{ARRAY_OBJ, STRING_OBJ, BYTES_OBJ, SET_OBJ}},
+		Fn: func(args ...Object) Object {
 			switch arg := args[0].(type) {
 			case *Array:
-				return &Integer{Value: int64(len(arg.Elements))}
-			case *String:
+				return &Integer{Value: int64(arg.Len())}
+			case *Set:
+				return &Integer{Value: int64(arg.Len())}
+			case *Bytes:
 				return &Integer{Value: int64(len(arg.Value))}
 			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
+				return &Integer{Value: int64(len(arg.(*String).Value))}
 			}
 		},
-		},
 	},
-	{
-		"puts",
-		&Builtin{Fn: func(args ...Object) Object {
+	&BuiltinDefinition{
+		Name:     "puts",
+		Params:   []ArgSpec{Any},
+		Variadic: true,
+		Fn: func(args ...Object) Object {
 			for _, obj := range args {
-				fmt.Println(obj.Inspect())
+				fmt.Println(OutputInspector.Inspect(obj))
 			}
 			return nil
 		},
-		},
 	},
-	{
-		"first",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("first() requires exactly one argument, got %d", len(args))
+	&BuiltinDefinition{
+		Name:   "first",
+		Params: []ArgSpec{{ARRAY_OBJ}},
+		Fn: func(args ...Object) Object {
+			arr := args[0].(*Array)
+			if arr.Len() > 0 {
+				return arr.At(0)
 			}
 
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+			return nil
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "last",
+		Params: []ArgSpec{{ARRAY_OBJ}},
+		Fn: func(args ...Object) Object {
+			arr := args[0].(*Array)
+			length := arr.Len()
+			if length > 0 {
+				return arr.At(length - 1)
 			}
 
+			return nil
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "rest",
+		Params: []ArgSpec{{ARRAY_OBJ}},
+		Fn: func(args ...Object) Object {
 			arr := args[0].(*Array)
-			if len(arr.Elements) > 0 {
-				return arr.Elements[0]
+			if arr.Len() > 0 {
+				return arr.Rest()
 			}
 
 			return nil
 		},
+	},
+	&BuiltinDefinition{
+		Name:   "push",
+		Params: []ArgSpec{{ARRAY_OBJ}, Any},
+		Fn: func(args ...Object) Object {
+			return args[0].(*Array).Push(args[1])
 		},
 	},
-	{
-		"last",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("last() requires exactly one argument, got %d", len(args))
+	&BuiltinDefinition{
+		Name:   "pop",
+		Params: []ArgSpec{{ARRAY_OBJ}},
+		Fn: func(args ...Object) Object {
+			arr := args[0].(*Array)
+			if arr.Len() == 0 {
+				return nil
 			}
 
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+			return arr.Pop()
+		},
+	},
+	&BuiltinDefinition{
+		Name:     "gensym",
+		Params:   []ArgSpec{{STRING_OBJ}},
+		Optional: 1,
+		Fn: func(args ...Object) Object {
+			prefix := "g"
+			if len(args) > 0 {
+				prefix = args[0].(*String).Value
 			}
-
-			arr := args[0].(*Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				return arr.Elements[length-1]
+			name := Gensym(prefix)
+			return &Quote{Node: &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "node_kind",
+		Params: []ArgSpec{{QUOTE_OBJ}},
+		Fn: func(args ...Object) Object {
+			return &String{Value: ast.Kind(args[0].(*Quote).Node)}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "node_children",
+		Params: []ArgSpec{{QUOTE_OBJ}},
+		Fn: func(args ...Object) Object {
+			children := []Object{}
+			for _, child := range ast.Children(args[0].(*Quote).Node) {
+				children = append(children, &Quote{Node: child})
 			}
-
-			return nil
+			return NewArray(children)
 		},
+	},
+	&BuiltinDefinition{
+		Name:   "node_value",
+		Params: []ArgSpec{{QUOTE_OBJ}},
+		Fn: func(args ...Object) Object {
+			switch node := args[0].(*Quote).Node.(type) {
+			case *ast.Identifier:
+				return &String{Value: node.Value}
+			case *ast.IntegerLiteral:
+				return &Integer{Value: node.Value}
+			case *ast.BigIntegerLiteral:
+				return &BigInt{Value: node.Value}
+			case *ast.StringLiteral:
+				return &String{Value: node.Value}
+			case *ast.BytesLiteral:
+				return &Bytes{Value: node.Value}
+			case *ast.Boolean:
+				return NativeBool(node.Value)
+			default:
+				return nil
+			}
 		},
 	},
-	{
-		"rest",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("rest() requires exactly one argument, got %d", len(args))
+	&BuiltinDefinition{
+		Name:   "make_ident",
+		Params: []ArgSpec{{STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			name := args[0].(*String).Value
+			if !isIdentifier(name) {
+				return newError("not a valid identifier: %q", name)
 			}
-
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to rest() must be an ARRAY, got %s", args[0].Type())
+			return &Quote{Node: &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "make_call",
+		Params: []ArgSpec{{QUOTE_OBJ, STRING_OBJ}, {ARRAY_OBJ}},
+		Fn: func(args ...Object) Object {
+			var function ast.Expression
+			switch fn := args[0].(type) {
+			case *String:
+				if !isIdentifier(fn.Value) {
+					return newError("not a valid identifier: %q", fn.Value)
+				}
+				function = &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: fn.Value}, Value: fn.Value}
+			default:
+				exp, ok := ToAstNode(fn).(ast.Expression)
+				if !ok {
+					return newError("can't call %s", ErrorInspector.Inspect(fn))
+				}
+				function = exp
 			}
 
-			arr := args[0].(*Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				newElements := make([]Object, length-1, length-1)
-				copy(newElements, arr.Elements[1:length])
-				a := &Array{Elements: newElements}
-				return a
+			arguments, ok := ToExpressions(args[1].(*Array).Elements())
+			if !ok {
+				return newError("arguments to `make_call` must be expressions, got %s", ErrorInspector.Inspect(args[1]))
 			}
 
-			return nil
+			return &Quote{Node: &ast.CallExpression{
+				Token:     token.Token{Type: token.LPAREN, Literal: "("},
+				Function:  function,
+				Arguments: arguments,
+			}}
 		},
+	},
+	&BuiltinDefinition{
+		Name:   "make_block",
+		Params: []ArgSpec{{ARRAY_OBJ}},
+		Fn: func(args ...Object) Object {
+			stmts, ok := ToStatements(args[0].(*Array).Elements())
+			if !ok {
+				return newError("elements of a block must be statements or expressions, got %s", ErrorInspector.Inspect(args[0]))
+			}
+			return &Quote{Node: &ast.BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{"}, Statements: stmts}}
 		},
 	},
-	{
-		"push",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 2 {
-				return newError("push() requires exactly two arguments, got %d", len(args))
+	&BuiltinDefinition{
+		Name:   "eval_quote",
+		Params: []ArgSpec{{QUOTE_OBJ}},
+		Fn: func(args ...Object) Object {
+			return newError("`eval_quote` is not supported here")
+		},
+		EngineFn: func(run Engine, args ...Object) Object {
+			return run(args[0].(*Quote).Node)
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "keys",
+		Params: []ArgSpec{{HASH_OBJ}},
+		Fn: func(args ...Object) Object {
+			return NewArray(args[0].(*Hash).Keys())
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "values",
+		Params: []ArgSpec{{HASH_OBJ}},
+		Fn: func(args ...Object) Object {
+			return NewArray(args[0].(*Hash).Values())
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "bytes",
+		Params: []ArgSpec{{STRING_OBJ, ARRAY_OBJ, BYTES_OBJ}},
+		Fn: func(args ...Object) Object {
+			switch arg := args[0].(type) {
+			case *String:
+				return &Bytes{Value: []byte(arg.Value)}
+			case *Array:
+				value := make([]byte, 0, arg.Len())
+				for _, e := range arg.Elements() {
+					b, ok := e.(*Integer)
+					if !ok || b.Value < 0 || b.Value > 255 {
+						return newError("can't make bytes of %s, elements must be integers from 0 to 255", ErrorInspector.Inspect(arg))
+					}
+					value = append(value, byte(b.Value))
+				}
+				return &Bytes{Value: value}
+			default:
+				return arg
 			}
-
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "string",
+		Params: []ArgSpec{{BYTES_OBJ}},
+		Fn: func(args ...Object) Object {
+			value := args[0].(*Bytes).Value
+			if !utf8.Valid(value) {
+				return newError("%s is not valid UTF-8", ErrorInspector.Inspect(args[0]))
+			}
+			return &String{Value: string(value)}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "slice",
+		Params: []ArgSpec{{BYTES_OBJ}, {INTEGER_OBJ}, {INTEGER_OBJ}},
+		Fn: func(args ...Object) Object {
+			value := args[0].(*Bytes).Value
+			start := clamp(args[1].(*Integer).Value, len(value))
+			end := clamp(args[2].(*Integer).Value, len(value))
+			if end < start {
+				end = start
+			}
+			return &Bytes{Value: value[start:end:end]}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "encode",
+		Params: []ArgSpec{{BYTES_OBJ, STRING_OBJ}, {STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			var value []byte
+			switch arg := args[0].(type) {
+			case *Bytes:
+				value = arg.Value
+			default:
+				value = []byte(arg.(*String).Value)
 			}
 
-			arr := args[0].(*Array)
-			length := len(arr.Elements)
-
-			newElements := make([]Object, length+1, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
+			switch encoding := args[1].(*String).Value; encoding {
+			case "hex":
+				return &String{Value: hex.EncodeToString(value)}
+			case "base64":
+				return &String{Value: base64.StdEncoding.EncodeToString(value)}
+			default:
+				return newError("unknown encoding: %q", encoding)
+			}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "decode",
+		Params: []ArgSpec{{STRING_OBJ}, {STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			text := args[0].(*String).Value
 
-			return &Array{Elements: newElements}
+			var value []byte
+			var err error
+			switch encoding := args[1].(*String).Value; encoding {
+			case "hex":
+				value, err = hex.DecodeString(text)
+			case "base64":
+				value, err = base64.StdEncoding.DecodeString(text)
+			default:
+				return newError("unknown encoding: %q", encoding)
+			}
+			if err != nil {
+				return newError("can't decode %q as %s: %s", text, args[1].Inspect(), err)
+			}
+			return &Bytes{Value: value}
 		},
+	},
+	&BuiltinDefinition{
+		Name:   "set",
+		Params: []ArgSpec{{ARRAY_OBJ}},
+		Fn: func(args ...Object) Object {
+			set := NewSet()
+			for _, e := range args[0].(*Array).Elements() {
+				elem, ok := AsHashable(e)
+				if !ok {
+					return newError("unusable as set element: %s", e.Type())
+				}
+				set.Add(elem)
+			}
+			return &set
 		},
 	},
-	{
-		"pop",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("pop() requires one argument: just an array, got %d", len(args))
+	&BuiltinDefinition{
+		Name:   "elements",
+		Params: []ArgSpec{{SET_OBJ}},
+		Fn: func(args ...Object) Object {
+			return NewArray(args[0].(*Set).Elements())
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "union",
+		Params: []ArgSpec{{SET_OBJ}, {SET_OBJ}},
+		Fn: func(args ...Object) Object {
+			return args[0].(*Set).Union(args[1].(*Set))
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "intersect",
+		Params: []ArgSpec{{SET_OBJ}, {SET_OBJ}},
+		Fn: func(args ...Object) Object {
+			return args[0].(*Set).Intersect(args[1].(*Set))
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "difference",
+		Params: []ArgSpec{{SET_OBJ}, {SET_OBJ}},
+		Fn: func(args ...Object) Object {
+			return args[0].(*Set).Difference(args[1].(*Set))
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "split",
+		Params: []ArgSpec{{STRING_OBJ}, {STRING_OBJ}},
+		BudgetFn: func(b *Budget, args ...Object) Object {
+			s, sep := args[0].(*String).Value, args[1].(*String).Value
+			count := utf8.RuneCountInString(s)
+			if sep != "" {
+				count = strings.Count(s, sep) + 1
 			}
-
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `pop` must be ARRAY, got %s", args[0].Type())
+			if err := b.CheckLength(int64(count)); err != nil {
+				return newError("%s", err)
 			}
+			return stringArray(strings.Split(s, sep))
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "join",
+		Params: []ArgSpec{{ARRAY_OBJ}, {STRING_OBJ}},
+		BudgetFn: func(b *Budget, args ...Object) Object {
+			sep := args[1].(*String).Value
+			parts := []string{}
+			length := int64(0)
+			for i, e := range args[0].(*Array).Elements() {
+				s, ok := e.(*String)
+				if !ok {
+					return newError("elements joined by `join` must be STRING, got %s", e.Type())
+				}
+				parts = append(parts, s.Value)
+				length += int64(len(s.Value))
+				if i > 0 {
+					length += int64(len(sep))
+				}
+			}
+			if length > maxStringLength {
+				return newError("joining %d strings makes a string too long", len(parts))
+			}
+			if err := b.CheckLength(length); err != nil {
+				return newError("%s", err)
+			}
+			return &String{Value: strings.Join(parts, sep)}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "trim",
+		Params: []ArgSpec{{STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			return &String{Value: strings.TrimSpace(args[0].(*String).Value)}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "trim_left",
+		Params: []ArgSpec{{STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			return &String{Value: strings.TrimLeftFunc(args[0].(*String).Value, unicode.IsSpace)}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "trim_right",
+		Params: []ArgSpec{{STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			return &String{Value: strings.TrimRightFunc(args[0].(*String).Value, unicode.IsSpace)}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "upper",
+		Params: []ArgSpec{{STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			return &String{Value: strings.ToUpper(args[0].(*String).Value)}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "lower",
+		Params: []ArgSpec{{STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			return &String{Value: strings.ToLower(args[0].(*String).Value)}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "contains",
+		Params: []ArgSpec{{STRING_OBJ}, {STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			return NativeBool(strings.Contains(args[0].(*String).Value, args[1].(*String).Value))
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "starts_with",
+		Params: []ArgSpec{{STRING_OBJ}, {STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			return NativeBool(strings.HasPrefix(args[0].(*String).Value, args[1].(*String).Value))
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "ends_with",
+		Params: []ArgSpec{{STRING_OBJ}, {STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			return NativeBool(strings.HasSuffix(args[0].(*String).Value, args[1].(*String).Value))
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "index_of",
+		Params: []ArgSpec{{STRING_OBJ}, {STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			s := args[0].(*String).Value
+			i := strings.Index(s, args[1].(*String).Value)
+			if i < 0 {
+				return &Integer{Value: -1}
+			}
+			return &Integer{Value: int64(utf8.RuneCountInString(s[:i]))}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "replace",
+		Params: []ArgSpec{{STRING_OBJ}, {STRING_OBJ}, {STRING_OBJ}},
+		BudgetFn: func(b *Budget, args ...Object) Object {
+			s, from, to := args[0].(*String).Value, args[1].(*String).Value, args[2].(*String).Value
+			if from == "" {
+				return newError("can't replace an empty string")
+			}
+			length := int64(len(s)) + int64(strings.Count(s, from))*int64(len(to)-len(from))
+			if length > maxStringLength {
+				return newError("replacing %q makes the string too long", from)
+			}
+			if err := b.CheckLength(length); err != nil {
+				return newError("%s", err)
+			}
+			return &String{Value: strings.ReplaceAll(s, from, to)}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "repeat",
+		Params: []ArgSpec{{STRING_OBJ}, {INTEGER_OBJ}},
+		BudgetFn: func(b *Budget, args ...Object) Object {
+			s, count := args[0].(*String).Value, args[1].(*Integer).Value
+			if count < 0 {
+				return newError("can't repeat a string %d times", count)
+			}
+			if len(s) > 0 && count > int64(maxStringLength/len(s)) {
+				return newError("repeating a string %d times makes it too long", count)
+			}
+			if err := b.CheckLength(int64(len(s)) * count); err != nil {
+				return newError("%s", err)
+			}
+			return &String{Value: strings.Repeat(s, int(count))}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "pad_left",
+		Params: []ArgSpec{{STRING_OBJ}, {INTEGER_OBJ}, {STRING_OBJ}},
+		BudgetFn: func(b *Budget, args ...Object) Object {
+			s := args[0].(*String).Value
+			padding, err := pad(b, s, args[1].(*Integer).Value, args[2].(*String).Value)
+			if err != nil {
+				return err
+			}
+			return &String{Value: padding + s}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "pad_right",
+		Params: []ArgSpec{{STRING_OBJ}, {INTEGER_OBJ}, {STRING_OBJ}},
+		BudgetFn: func(b *Budget, args ...Object) Object {
+			s := args[0].(*String).Value
+			padding, err := pad(b, s, args[1].(*Integer).Value, args[2].(*String).Value)
+			if err != nil {
+				return err
+			}
+			return &String{Value: s + padding}
+		},
+	},
+	&BuiltinDefinition{
+		Name:   "chars",
+		Params: []ArgSpec{{STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			chars := []string{}
+			for _, r := range args[0].(*String).Value {
+				chars = append(chars, string(r))
+			}
+			return stringArray(chars)
+		},
+	},
+)
 
-			arr := args[0].(*Array)
-			length := len(arr.Elements)
+// maxStringLength bounds the strings repeat, replace, join and the pad
+// builtins make when the run has no limit on them.
+const maxStringLength = 1 << 30
 
-			newElements := make([]Object, length-1, length-1)
-			copy(newElements, arr.Elements[:len(newElements)])
+func stringArray(values []string) *Array {
+	elements := make([]Object, len(values))
+	for i, v := range values {
+		elements[i] = &String{Value: v}
+	}
+	return NewArray(elements)
+}
 
-			return &Array{Elements: newElements}
-		}},
-	},
+// pad returns the padding that makes s width characters long, made of
+// copies of padding with the last one cut short. Its length is checked
+// against b before it's built.
+func pad(b *Budget, s string, width int64, padding string) (string, *Error) {
+	missing := width - int64(utf8.RuneCountInString(s))
+	if missing <= 0 {
+		return "", nil
+	}
+	if padding == "" {
+		return "", newError("can't pad with an empty string")
+	}
+	if width > maxStringLength {
+		return "", newError("can't pad a string to %d characters", width)
+	}
+
+	runes := []rune(padding)
+	copies, rest := missing/int64(len(runes)), int(missing%int64(len(runes)))
+	tail := string(runes[:rest])
+	length := copies*int64(len(padding)) + int64(len(tail))
+	if length > maxStringLength {
+		return "", newError("can't pad a string to %d characters", width)
+	}
+	if err := b.CheckLength(int64(len(s)) + length); err != nil {
+		return "", newError("%s", err)
+	}
+
+	var out strings.Builder
+	out.Grow(int(length))
+	for i := int64(0); i < copies; i++ {
+		out.WriteString(padding)
+	}
+	out.WriteString(tail)
+	return out.String(), nil
 }
 
-func generateBuiltinLookup() map[string]int {
-	index := make(map[string]int, len(Builtins))
-	for i, b := range Builtins {
-		index[b.Name] = i
+// clamp limits the index i to the range from 0 to length.
+func clamp(i int64, length int) int {
+	if i < 0 {
+		return 0
 	}
-	return index
+	if i > int64(length) {
+		return length
+	}
+	return int(i)
 }
 
-var BuiltinIndex = generateBuiltinLookup()
+var gensymCounter atomic.Uint64
+
+// Gensym returns a new identifier starting with prefix, different from all
+// identifiers it returned before. The name contains an @, which the lexer
+// never reads as part of an identifier, so it can't clash with a name
+// written in source code or made with make_ident.
+func Gensym(prefix string) string {
+	return prefix + "@" + strconv.FormatUint(gensymCounter.Add(1), 10)
+}
 
-func GetBuiltinByName(name string) *Builtin {
-	return Builtins[BuiltinIndex[name]].Builtin
+// isIdentifier reports whether name would be read as an identifier.
+func isIdentifier(name string) bool {
+	if name == "" || token.LookupIdent(name) != token.IDENT {
+		return false
+	}
+	for _, ch := range name {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func defineBuiltins(defs ...*BuiltinDefinition) []*BuiltinDefinition {
+	for _, def := range defs {
+		if def.BudgetFn == nil {
+			def.Builtin = def.Bind(def.Fn)
+			continue
+		}
+		def := def
+		def.Fn = func(args ...Object) Object { return def.BudgetFn(nil, args...) }
+		def.Builtin = def.Bind(def.Fn)
+		def.Builtin.BudgetFn = func(b *Budget, args ...Object) Object {
+			if err := def.checkArgs(args); err != nil {
+				return err
+			}
+			return def.BudgetFn(b, args...)
+		}
+	}
+	return defs
+}
+
+// Bind returns a builtin that checks its arguments against def and then
+// calls fn instead of def.Fn.
+func (def *BuiltinDefinition) Bind(fn BuiltinFunction) *Builtin {
+	return &Builtin{Fn: func(args ...Object) Object {
+		if err := def.checkArgs(args); err != nil {
+			return err
+		}
+		return fn(args...)
+	}}
+}
+
+// BindEngine returns the builtin def is in code run by run, def.Builtin
+// unless def has an EngineFn.
+func (def *BuiltinDefinition) BindEngine(run Engine) *Builtin {
+	if def.EngineFn == nil {
+		return def.Builtin
+	}
+	return def.Bind(func(args ...Object) Object { return def.EngineFn(run, args...) })
+}
+
+// checkArgs returns an error if args don't match the parameters of def.
+func (def *BuiltinDefinition) checkArgs(args []Object) *Error {
+	want := len(def.Params)
+	if def.Variadic {
+		if len(args) < want-1 {
+			return newError("wrong number of arguments. got=%d, want at least %d", len(args), want-1)
+		}
+	} else if def.Optional > 0 {
+		if len(args) < want-def.Optional {
+			return newError("wrong number of arguments. got=%d, want at least %d", len(args), want-def.Optional)
+		}
+		if len(args) > want {
+			return newError("wrong number of arguments. got=%d, want at most %d", len(args), want)
+		}
+	} else if len(args) != want {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+
+	for i, arg := range args {
+		spec := def.Params[want-1]
+		if i < want {
+			spec = def.Params[i]
+		}
+		if spec.accepts(arg) {
+			continue
+		}
+
+		if want == 1 {
+			return newError("argument to `%s` must be %s, got %s", def.Name, spec, arg.Type())
+		}
+		return newError("argument %d to `%s` must be %s, got %s", i+1, def.Name, spec, arg.Type())
+	}
+
+	return nil
+}
+
+func (spec ArgSpec) accepts(obj Object) bool {
+	if len(spec) == 0 {
+		return true
+	}
+	for _, t := range spec {
+		if obj.Type() == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (spec ArgSpec) String() string {
+	types := []string{}
+	for _, t := range spec {
+		types = append(types, string(t))
+	}
+	if len(types) < 2 {
+		return strings.Join(types, "")
+	}
+	return strings.Join(types[:len(types)-1], ", ") + " or " + types[len(types)-1]
 }
 
 func newError(format string, a ...interface{}) *Error {
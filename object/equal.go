@@ -0,0 +1,160 @@
+package object
+
+import "bytes"
+
+// Equal reports whether a and b are structurally equal, the meaning of ==
+// in both engines. Integers, strings, bytes and booleans are equal if
+// their values are. Arrays are equal element by element, hashes if they
+// have equal keys mapped to equal values in any order, and sets if they
+// have the same elements. Quotes are equal if they hold the same code.
+//
+// Functions are equal if they come from the same function literal and
+// captured equal values, so a closure can be compared to itself even
+// when it captures itself. Everything else, like builtins and errors, is
+// only equal to itself.
+func Equal(a, b Object) bool {
+	e := equality{}
+	return e.equal(a, b)
+}
+
+// Identical reports whether a and b are the same object, the meaning of
+// is. Integers, strings, booleans and null have no identity apart from
+// their value, so for them it's the same as Equal.
+func Identical(a, b Object) bool {
+	switch a.(type) {
+	case *Integer, *BigInt, *String, *Boolean, *Null:
+		return Equal(a, b)
+	default:
+		return a == b
+	}
+}
+
+// equality remembers the pairs of functions and environments it's
+// comparing. Meeting one of them again means going round a cycle, and
+// the pair is taken to be equal unless something else on the way isn't.
+type equality struct {
+	seen map[[2]interface{}]bool
+}
+
+func (e *equality) visit(a, b interface{}) bool {
+	if e.seen == nil {
+		e.seen = map[[2]interface{}]bool{}
+	}
+	key := [2]interface{}{a, b}
+	if e.seen[key] {
+		return false
+	}
+	e.seen[key] = true
+	return true
+}
+
+func (e *equality) equal(a, b Object) bool {
+	if a == b {
+		return true
+	}
+	if IsInteger(a) && IsInteger(b) {
+		return CompareIntegers(a, b) == 0
+	}
+
+	switch a := a.(type) {
+	case *String:
+		o, ok := b.(*String)
+		return ok && a.Value == o.Value
+
+	case *Bytes:
+		o, ok := b.(*Bytes)
+		return ok && bytes.Equal(a.Value, o.Value)
+
+	case *Boolean:
+		o, ok := b.(*Boolean)
+		return ok && a.Value == o.Value
+
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+
+	case *Array:
+		o, ok := b.(*Array)
+		if !ok || a.Len() != o.Len() {
+			return false
+		}
+		for i, elem := range a.Elements() {
+			if !e.equal(elem, o.At(i)) {
+				return false
+			}
+		}
+		return true
+
+	case *Hash:
+		o, ok := b.(*Hash)
+		if !ok || a.Len() != o.Len() {
+			return false
+		}
+		for _, pair := range a.Pairs() {
+			value, ok := o.Get(pair.Key.(Hashable))
+			if !ok || !e.equal(pair.Value, value) {
+				return false
+			}
+		}
+		return true
+
+	case *Set:
+		o, ok := b.(*Set)
+		if !ok || a.Len() != o.Len() {
+			return false
+		}
+		for _, elem := range a.Elements() {
+			if !o.Has(elem.(Hashable)) {
+				return false
+			}
+		}
+		return true
+
+	case *Quote:
+		o, ok := b.(*Quote)
+		return ok && a.Node.String() == o.Node.String()
+
+	case *Closure:
+		o, ok := b.(*Closure)
+		if !ok || a.Fn != o.Fn || len(a.Free) != len(o.Free) {
+			return false
+		}
+		if !e.visit(a, o) {
+			return true
+		}
+		for i, free := range a.Free {
+			if !e.equal(free, o.Free[i]) {
+				return false
+			}
+		}
+		return true
+
+	case *Function:
+		o, ok := b.(*Function)
+		return ok && a.Body == o.Body && e.equalEnvironments(a.Env, o.Env)
+
+	default:
+		return false
+	}
+}
+
+// equalEnvironments reports whether a and b bind the same names to equal
+// values, and so do their outer environments.
+func (e *equality) equalEnvironments(a, b *Environment) bool {
+	for a != b {
+		if a == nil || b == nil || len(a.store) != len(b.store) {
+			return false
+		}
+		if !e.visit(a, b) {
+			return true
+		}
+		for name, value := range a.store {
+			other, ok := b.store[name]
+			if !ok || !e.equal(value, other) {
+				return false
+			}
+		}
+		a, b = a.outer, b.outer
+	}
+	return true
+}
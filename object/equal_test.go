@@ -0,0 +1,94 @@
+package object
+
+import (
+	"monkey/ast"
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	hash := func(pairs ...Object) *Hash {
+		h := NewHash()
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i].(Hashable), pairs[i+1])
+		}
+		return &h
+	}
+	set := func(elems ...Object) *Set {
+		s := NewSet()
+		for _, e := range elems {
+			s.Add(e.(Hashable))
+		}
+		return &s
+	}
+	code := &CompiledFunction{}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{one, &Integer{Value: 1}, true},
+		{one, two, false},
+		{&String{Value: "a"}, &String{Value: "a"}, true},
+		{&String{Value: "1"}, one, false},
+		{NewArray([]Object{one, NewArray([]Object{two})}), NewArray([]Object{&Integer{Value: 1}, NewArray([]Object{two})}), true},
+		{NewArray([]Object{one}), NewArray([]Object{one, two}), false},
+		{hash(&String{Value: "a"}, one, &String{Value: "b"}, two), hash(&String{Value: "b"}, two, &String{Value: "a"}, one), true},
+		{hash(&String{Value: "a"}, one), hash(&String{Value: "a"}, two), false},
+		{set(one, two), set(two, one), true},
+		{set(one), set(two), false},
+		{&Closure{Fn: code, Free: []Object{one}}, &Closure{Fn: code, Free: []Object{&Integer{Value: 1}}}, true},
+		{&Closure{Fn: code, Free: []Object{one}}, &Closure{Fn: code, Free: []Object{two}}, false},
+		{&Closure{Fn: code}, &Closure{Fn: &CompiledFunction{}}, false},
+		{&Builtin{}, &Builtin{}, false},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("[%d] Equal(%s, %s) = %t, want %t", i, tt.a.Inspect(), tt.b.Inspect(), got, tt.expected)
+		}
+	}
+}
+
+func TestEqualCycles(t *testing.T) {
+	code := &CompiledFunction{}
+	a := &Closure{Fn: code, Free: []Object{nil, &Integer{Value: 1}}}
+	a.Free[0] = a
+	b := &Closure{Fn: code, Free: []Object{nil, &Integer{Value: 1}}}
+	b.Free[0] = b
+	if !Equal(a, b) {
+		t.Errorf("closures capturing themselves aren't equal")
+	}
+	b.Free[1] = &Integer{Value: 2}
+	if Equal(a, b) {
+		t.Errorf("closures capturing different values are equal")
+	}
+
+	body := &ast.BlockStatement{}
+	newFunction := func(value int64) *Function {
+		env := NewEnvironment()
+		fn := &Function{Body: body, Env: env}
+		env.Set("f", fn)
+		env.Set("x", &Integer{Value: value})
+		return fn
+	}
+	if !Equal(newFunction(1), newFunction(1)) {
+		t.Errorf("functions in environments holding themselves aren't equal")
+	}
+	if Equal(newFunction(1), newFunction(2)) {
+		t.Errorf("functions in different environments are equal")
+	}
+}
+
+func TestIdentical(t *testing.T) {
+	array := NewArray([]Object{&Integer{Value: 1}})
+	if !Identical(&Integer{Value: 1}, &Integer{Value: 1}) {
+		t.Errorf("integers with the same value aren't identical")
+	}
+	if !Identical(array, array) {
+		t.Errorf("array isn't identical to itself")
+	}
+	if Identical(array, NewArray([]Object{&Integer{Value: 1}})) {
+		t.Errorf("equal arrays are identical")
+	}
+}
@@ -0,0 +1,133 @@
+package object
+
+import "math/bits"
+
+const (
+	hamtBits = 5
+	hamtMask = 1<<hamtBits - 1
+)
+
+// A hamtNode is a node of a persistent hash array mapped trie. Each node
+// uses the next five bits of a key's hash to pick one of 32 slots, bitmap
+// marks the slots in use and children holds them in order. Setting a key
+// copies the path to it and leaves the old trie untouched. A nil node is
+// an empty trie.
+type hamtNode struct {
+	bitmap   uint32
+	children []hamtChild
+}
+
+// A hamtChild is either a node one level down or a leaf.
+type hamtChild struct {
+	node *hamtNode
+	leaf *hamtLeaf
+}
+
+// A hamtLeaf holds the entries of the keys with the same hash.
+type hamtLeaf struct {
+	hash    uint64
+	entries []HashPair
+}
+
+func (n *hamtNode) get(key Hashable, hash uint64) (HashPair, bool) {
+	for shift := uint(0); n != nil; shift += hamtBits {
+		bit, i := n.slot(hash, shift)
+		if n.bitmap&bit == 0 {
+			return HashPair{}, false
+		}
+
+		child := n.children[i]
+		if child.leaf == nil {
+			n = child.node
+			continue
+		}
+		if child.leaf.hash != hash {
+			return HashPair{}, false
+		}
+		for _, entry := range child.leaf.entries {
+			if key.KeyEquals(entry.Key.(Hashable)) {
+				return entry, true
+			}
+		}
+		return HashPair{}, false
+	}
+	return HashPair{}, false
+}
+
+// set returns a trie with pair set, and whether its key is new.
+func (n *hamtNode) set(pair HashPair, hash uint64, shift uint) (*hamtNode, bool) {
+	if n == nil {
+		n = &hamtNode{}
+	}
+
+	bit, i := n.slot(hash, shift)
+	if n.bitmap&bit == 0 {
+		return n.with(bit, i, hamtChild{leaf: &hamtLeaf{hash: hash, entries: []HashPair{pair}}}), true
+	}
+
+	child := n.children[i]
+	added := true
+	switch {
+	case child.node != nil:
+		child.node, added = child.node.set(pair, hash, shift+hamtBits)
+	case child.leaf.hash == hash:
+		child.leaf, added = child.leaf.set(pair)
+	default:
+		// two hashes share the slot, both move a level down
+		node := (*hamtNode)(nil).put(child.leaf, shift+hamtBits)
+		node, _ = node.set(pair, hash, shift+hamtBits)
+		child = hamtChild{node: node}
+	}
+	return n.replace(i, child), added
+}
+
+// put returns a trie with leaf added, the hash of which isn't in n yet.
+func (n *hamtNode) put(leaf *hamtLeaf, shift uint) *hamtNode {
+	if n == nil {
+		n = &hamtNode{}
+	}
+
+	bit, i := n.slot(leaf.hash, shift)
+	if n.bitmap&bit == 0 {
+		return n.with(bit, i, hamtChild{leaf: leaf})
+	}
+
+	child := n.children[i]
+	if child.node == nil {
+		child = hamtChild{node: (*hamtNode)(nil).put(child.leaf, shift+hamtBits)}
+	}
+	child.node = child.node.put(leaf, shift+hamtBits)
+	return n.replace(i, child)
+}
+
+// slot returns the bit for hash in the bitmap of n, and the index of its
+// child.
+func (n *hamtNode) slot(hash uint64, shift uint) (uint32, int) {
+	bit := uint32(1) << ((hash >> shift) & hamtMask)
+	return bit, bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (n *hamtNode) with(bit uint32, i int, child hamtChild) *hamtNode {
+	children := make([]hamtChild, len(n.children)+1)
+	copy(children, n.children[:i])
+	children[i] = child
+	copy(children[i+1:], n.children[i:])
+	return &hamtNode{bitmap: n.bitmap | bit, children: children}
+}
+
+func (n *hamtNode) replace(i int, child hamtChild) *hamtNode {
+	children := append([]hamtChild{}, n.children...)
+	children[i] = child
+	return &hamtNode{bitmap: n.bitmap, children: children}
+}
+
+func (l *hamtLeaf) set(pair HashPair) (*hamtLeaf, bool) {
+	entries := append([]HashPair{}, l.entries...)
+	for i, entry := range entries {
+		if pair.Key.(Hashable).KeyEquals(entry.Key.(Hashable)) {
+			entries[i] = pair
+			return &hamtLeaf{hash: l.hash, entries: entries}, false
+		}
+	}
+	return &hamtLeaf{hash: l.hash, entries: append(entries, pair)}, true
+}
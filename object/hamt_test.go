@@ -0,0 +1,64 @@
+package object
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestHamt(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	hash := NewHash()
+	model := map[string]int64{}
+	order := []string{}
+
+	var snapshot Hash
+	var snapshotModel map[string]int64
+
+	for step := 0; step < 20000; step++ {
+		key := fmt.Sprintf("k%d", rnd.Intn(5000))
+		if _, ok := model[key]; !ok {
+			order = append(order, key)
+		}
+		model[key] = int64(step)
+		hash.Set(&String{Value: key}, &Integer{Value: int64(step)})
+
+		if step == 10000 {
+			snapshot = hash
+			snapshotModel = map[string]int64{}
+			for k, v := range model {
+				snapshotModel[k] = v
+			}
+		}
+	}
+
+	testHash(t, hash, model)
+	testHash(t, snapshot, snapshotModel)
+
+	for i, pair := range hash.Pairs() {
+		if pair.Key.Inspect() != order[i] {
+			t.Fatalf("wrong key at %d. want=%s, got=%s", i, order[i], pair.Key.Inspect())
+		}
+	}
+}
+
+func testHash(t *testing.T, hash Hash, model map[string]int64) {
+	t.Helper()
+
+	if hash.Len() != len(model) {
+		t.Fatalf("hash has wrong number of pairs. want=%d, got=%d", len(model), hash.Len())
+	}
+	for key, want := range model {
+		got, ok := hash.Get(&String{Value: key})
+		if !ok {
+			t.Fatalf("no value for %s", key)
+		}
+		if got.(*Integer).Value != want {
+			t.Fatalf("wrong value for %s. want=%d, got=%d", key, want, got.(*Integer).Value)
+		}
+	}
+	if _, ok := hash.Get(&String{Value: "missing"}); ok {
+		t.Errorf("found a value for a missing key")
+	}
+}
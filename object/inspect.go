@@ -0,0 +1,151 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An Inspector prints objects for people to read. Unlike Inspect, it can
+// spread large collections over several lines, cut off deep or long ones
+// and quote the strings in them. A zero limit means there is no limit,
+// except for the depth, which is at most MaxInspectDepth, and the zero
+// Inspector prints like Inspect.
+type Inspector struct {
+	// Indent indents the elements of a collection that doesn't fit in
+	// Width columns, one per line. Without it everything stays on one
+	// line.
+	Indent string
+	Width  int
+	// MaxDepth is the number of collections nested in each other that
+	// are printed, deeper ones print as [...].
+	MaxDepth int
+	// MaxElements is the number of elements printed of each collection,
+	// the rest are counted.
+	MaxElements int
+	// QuoteStrings quotes the strings in collections, so "1" and 1 can be
+	// told apart.
+	QuoteStrings bool
+}
+
+// MaxInspectDepth is the number of nested collections any Inspector
+// prints. It keeps printing very deep collections from taking forever.
+const MaxInspectDepth = 1000
+
+var (
+	// OutputInspector prints the values of puts. Program output is never
+	// cut short, only cycles are marked.
+	OutputInspector = Inspector{Indent: "  ", Width: 80, QuoteStrings: true}
+	// PrettyInspector prints the values the REPL echoes.
+	PrettyInspector = Inspector{Indent: "  ", Width: 80, MaxDepth: 10, MaxElements: 100, QuoteStrings: true}
+	// ErrorInspector keeps the values in error messages short.
+	ErrorInspector = Inspector{MaxDepth: 3, MaxElements: 10, QuoteStrings: true}
+)
+
+// Inspect returns obj printed the way in says.
+func (in Inspector) Inspect(obj Object) string {
+	if in.MaxDepth <= 0 || in.MaxDepth > MaxInspectDepth {
+		in.MaxDepth = MaxInspectDepth
+	}
+	return in.inspect(obj, 0, map[Object]bool{})
+}
+
+// inspect prints obj nested in depth collections, the ones in path. A
+// collection in its own path is part of a cycle and printed as <cycle>.
+func (in Inspector) inspect(obj Object, depth int, path map[Object]bool) string {
+	var open, close string
+	var items func() []string
+
+	switch obj := obj.(type) {
+	case *String:
+		if depth > 0 && in.QuoteStrings {
+			return quoteString(obj.Value)
+		}
+		return obj.Value
+
+	case *Array:
+		open, close = "[", "]"
+		items = func() []string {
+			elements := obj.Elements()
+			return in.items(len(elements), func(i int) string {
+				return in.inspect(elements[i], depth+1, path)
+			})
+		}
+
+	case *Hash:
+		open, close = "{", "}"
+		items = func() []string {
+			pairs := obj.Pairs()
+			return in.items(len(pairs), func(i int) string {
+				key := in.inspect(pairs[i].Key, depth+1, path)
+				return key + " : " + in.inspect(pairs[i].Value, depth+1, path)
+			})
+		}
+
+	case *Set:
+		open, close = "#{", "}"
+		items = func() []string {
+			elements := obj.Elements()
+			return in.items(len(elements), func(i int) string {
+				return in.inspect(elements[i], depth+1, path)
+			})
+		}
+
+	default:
+		return obj.Inspect()
+	}
+
+	if path[obj] {
+		return "<cycle>"
+	}
+	if depth >= in.MaxDepth {
+		return open + "..." + close
+	}
+	path[obj] = true
+	defer delete(path, obj)
+	return in.list(open, items(), close, depth)
+}
+
+// items prints the n elements of a collection with inspect, up to
+// MaxElements of them.
+func (in Inspector) items(n int, inspect func(i int) string) []string {
+	items := []string{}
+	for i := 0; i < n; i++ {
+		if in.MaxElements > 0 && i == in.MaxElements {
+			items = append(items, fmt.Sprintf("... %d more", n-i))
+			break
+		}
+		items = append(items, inspect(i))
+	}
+	return items
+}
+
+// list puts the items on a single line if they fit, or one per line if
+// not.
+func (in Inspector) list(open string, items []string, close string, depth int) string {
+	inline := open + strings.Join(items, ", ") + close
+	if in.Indent == "" || len(items) == 0 {
+		return inline
+	}
+	if len(inline)+depth*len(in.Indent) <= in.Width && !strings.Contains(inline, "\n") {
+		return inline
+	}
+
+	var out strings.Builder
+	out.WriteString(open + "\n")
+	for i, item := range items {
+		out.WriteString(strings.Repeat(in.Indent, depth+1))
+		out.WriteString(item)
+		if i < len(items)-1 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString(strings.Repeat(in.Indent, depth) + close)
+	return out.String()
+}
+
+func quoteString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
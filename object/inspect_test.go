@@ -0,0 +1,95 @@
+package object
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInspector(t *testing.T) {
+	ints := func(values ...int64) *Array {
+		elements := []Object{}
+		for _, v := range values {
+			elements = append(elements, &Integer{Value: v})
+		}
+		return NewArray(elements)
+	}
+	hash := NewHash()
+	hash.Set(&String{Value: "a"}, NewArray([]Object{&String{Value: `x"y`}, ints(1, 2)}))
+	set := NewSet()
+	set.Add(&String{Value: "s"})
+
+	tests := []struct {
+		inspector Inspector
+		obj       Object
+		expected  string
+	}{
+		{Inspector{}, &String{Value: "a"}, `a`},
+		{Inspector{QuoteStrings: true}, &String{Value: "a"}, `a`},
+		{Inspector{}, &hash, `{a : [x"y, [1, 2]]}`},
+		{Inspector{QuoteStrings: true}, &hash, `{"a" : ["x\"y", [1, 2]]}`},
+		{Inspector{QuoteStrings: true}, &set, `#{"s"}`},
+		{Inspector{MaxDepth: 1}, NewArray([]Object{ints(1), &hash, &set}), `[[...], {...}, #{...}]`},
+		{Inspector{MaxDepth: 1}, ints(), `[]`},
+		{Inspector{MaxElements: 2}, ints(1, 2, 3, 4), `[1, 2, ... 2 more]`},
+		{Inspector{MaxElements: 2}, ints(1, 2), `[1, 2]`},
+		{Inspector{Indent: "  ", Width: 10}, ints(1, 2), `[1, 2]`},
+		{Inspector{Indent: "  ", Width: 12}, NewArray([]Object{ints(1, 2, 3), ints(4)}), "[\n  [1, 2, 3],\n  [4]\n]"},
+		{Inspector{Indent: "  ", Width: 8}, NewArray([]Object{ints(1, 2, 3), ints(4)}), "[\n  [\n    1,\n    2,\n    3\n  ],\n  [4]\n]"},
+	}
+
+	for i, tt := range tests {
+		if got := tt.inspector.Inspect(tt.obj); got != tt.expected {
+			t.Errorf("[%d] wrong output.\nwant=%q\ngot =%q", i, tt.expected, got)
+		}
+	}
+}
+
+func TestInspectorCycles(t *testing.T) {
+	hash := &Hash{}
+	*hash = NewHash()
+	hash.Set(&String{Value: "self"}, hash)
+	hash.Set(&String{Value: "list"}, NewArray([]Object{hash}))
+
+	expected := `{self : <cycle>, list : [<cycle>]}`
+	if got := hash.Inspect(); got != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot =%q", expected, got)
+	}
+}
+
+func TestInspectorDeepCollections(t *testing.T) {
+	deep := NewArray(nil)
+	for i := 0; i < 100000; i++ {
+		deep = NewArray([]Object{deep})
+	}
+
+	expected := strings.Repeat("[", MaxInspectDepth) + "[...]" + strings.Repeat("]", MaxInspectDepth)
+	if got := deep.Inspect(); got != expected {
+		t.Errorf("deep array not cut off at depth %d. got %d bytes", MaxInspectDepth, len(got))
+	}
+
+	// the same collection twice in a row isn't a cycle
+	inner := NewArray([]Object{&Integer{Value: 1}})
+	shared := NewArray([]Object{inner, inner})
+	if got := shared.Inspect(); got != "[[1], [1]]" {
+		t.Errorf("shared collection printed wrong. got=%q", got)
+	}
+}
+
+func TestOutputInspectorPrintsEverything(t *testing.T) {
+	elements := make([]Object, 5000)
+	for i := range elements {
+		elements[i] = &Integer{Value: int64(i)}
+	}
+	deep := NewArray(elements)
+	for i := 0; i < 20; i++ {
+		deep = NewArray([]Object{deep})
+	}
+
+	got := OutputInspector.Inspect(deep)
+	if strings.Contains(got, "...") {
+		t.Errorf("output was cut short")
+	}
+	if !strings.Contains(got, "4999") {
+		t.Errorf("last element missing from output")
+	}
+}
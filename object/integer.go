@@ -0,0 +1,161 @@
+package object
+
+import (
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// A BigInt is an integer outside the range of an int64. Arithmetic on
+// integers switches to BigInts when a result doesn't fit and back when it
+// does, so every integer has exactly one representation.
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+func (b *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	if b.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	h.Write(b.Value.Bytes())
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+func (b *BigInt) KeyEquals(other Hashable) bool {
+	o, ok := other.(*BigInt)
+	return ok && o.Value.Cmp(b.Value) == 0
+}
+
+// NewInteger returns n as an Integer if it fits into an int64, as a
+// BigInt if it doesn't.
+func NewInteger(n *big.Int) Object {
+	if n.IsInt64() {
+		return &Integer{Value: n.Int64()}
+	}
+	return &BigInt{Value: n}
+}
+
+// IsInteger reports whether obj is an Integer or a BigInt.
+func IsInteger(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInt:
+		return true
+	default:
+		return false
+	}
+}
+
+// IntegerArithmetic applies op, one of + - * and /, to the integers left
+// and right. Division truncates towards zero, dividing by zero returns an
+// Error. The size of a big result is checked against b before it's
+// computed.
+func IntegerArithmetic(b *Budget, op string, left, right Object) Object {
+	if op == "/" && CompareIntegers(right, &Integer{Value: 0}) == 0 {
+		return newError("division by zero")
+	}
+
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		if result, ok := checkedArithmetic(op, l.Value, r.Value); ok {
+			return &Integer{Value: result}
+		}
+	}
+
+	x, y := toBig(left), toBig(right)
+	if err := b.CheckBits(resultBits(op, x, y)); err != nil {
+		return newError("%s", err)
+	}
+
+	result := new(big.Int)
+	switch op {
+	case "+":
+		result.Add(x, y)
+	case "-":
+		result.Sub(x, y)
+	case "*":
+		result.Mul(x, y)
+	case "/":
+		result.Quo(x, y)
+	}
+	return NewInteger(result)
+}
+
+// resultBits returns an upper bound of the number of bits of x op y.
+func resultBits(op string, x, y *big.Int) int64 {
+	switch op {
+	case "*":
+		return int64(x.BitLen()) + int64(y.BitLen())
+	case "/":
+		return int64(x.BitLen())
+	default:
+		if x.BitLen() > y.BitLen() {
+			return int64(x.BitLen()) + 1
+		}
+		return int64(y.BitLen()) + 1
+	}
+}
+
+// checkedArithmetic works like IntegerArithmetic on int64s, ok is false if
+// the result overflows.
+func checkedArithmetic(op string, a, b int64) (int64, bool) {
+	switch op {
+	case "+":
+		sum := a + b
+		return sum, (a^sum)&(b^sum) >= 0
+	case "-":
+		diff := a - b
+		return diff, (a^b)&(a^diff) >= 0
+	case "*":
+		if a == 0 || b == 0 {
+			return 0, true
+		}
+		product := a * b
+		overflow := product/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64)
+		return product, !overflow
+	case "/":
+		if a == math.MinInt64 && b == -1 {
+			return 0, false
+		}
+		return a / b, true
+	default:
+		return 0, false
+	}
+}
+
+// CompareIntegers returns -1, 0 or +1 as the integer left is less than,
+// equal to or greater than the integer right.
+func CompareIntegers(left, right Object) int {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		switch {
+		case l.Value < r.Value:
+			return -1
+		case l.Value > r.Value:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return toBig(left).Cmp(toBig(right))
+}
+
+// NegateInteger returns the integer obj with the opposite sign.
+func NegateInteger(obj Object) Object {
+	if i, ok := obj.(*Integer); ok && i.Value != math.MinInt64 {
+		return &Integer{Value: -i.Value}
+	}
+	return NewInteger(new(big.Int).Neg(toBig(obj)))
+}
+
+func toBig(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *BigInt:
+		return obj.Value
+	default:
+		return big.NewInt(obj.(*Integer).Value)
+	}
+}
@@ -0,0 +1,583 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// FromGo converts a Go value to an object. Integers of any size, strings,
+// booleans and nil convert to their Monkey counterparts, byte slices to
+// bytes, slices and arrays to arrays, and maps to hashes with their keys
+// sorted. Structs become hashes from the names of their exported fields
+// to their values, a `monkey:"name"` tag renames a field and
+// `monkey:"-"` leaves it out. Pointers and interfaces convert what they
+// point to, functions are wrapped with WrapFunc and objects stay as they
+// are. A value that contains itself is an error.
+func FromGo(v interface{}) (Object, error) {
+	if obj, ok := v.(Object); ok {
+		return obj, nil
+	}
+	return fromGo(reflect.ValueOf(v))
+}
+
+func fromGo(v reflect.Value) (Object, error) {
+	c := conversion{}
+	return c.fromGo(v)
+}
+
+// conversion remembers the pointers, maps and slices it's in the middle
+// of converting. Meeting one of them again means the value is cyclic.
+type conversion struct {
+	path map[goReference]bool
+}
+
+// goReference identifies what a pointer, map or slice refers to. Slices
+// of different lengths or types can start at the same address.
+type goReference struct {
+	pointer uintptr
+	typ     reflect.Type
+	len     int
+}
+
+// enter adds v to the path, ok is false if it's already on it. leave has
+// to be called once v is converted.
+func (c *conversion) enter(v reflect.Value) (ref goReference, ok bool) {
+	ref = goReference{pointer: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		ref.len = v.Len()
+	}
+	if c.path == nil {
+		c.path = map[goReference]bool{}
+	}
+	if c.path[ref] {
+		return ref, false
+	}
+	c.path[ref] = true
+	return ref, true
+}
+
+func (c *conversion) leave(ref goReference) {
+	delete(c.path, ref)
+}
+
+func (c *conversion) fromGo(v reflect.Value) (Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+	if v.Type().Implements(objectType) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+	if v.Type() == bigIntType {
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return NewInteger(new(big.Int).Set(v.Interface().(*big.Int))), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return NativeBool(v.Bool()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NewInteger(new(big.Int).SetUint64(v.Uint())), nil
+
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		if v.Kind() == reflect.Interface {
+			return c.fromGo(v.Elem())
+		}
+		ref, ok := c.enter(v)
+		if !ok {
+			return nil, fmt.Errorf("can't convert cyclic Go %s", v.Type())
+		}
+		defer c.leave(ref)
+		return c.fromGo(v.Elem())
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NULL, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			value := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(value), v)
+			return &Bytes{Value: value}, nil
+		}
+		if v.Kind() == reflect.Slice {
+			ref, ok := c.enter(v)
+			if !ok {
+				return nil, fmt.Errorf("can't convert cyclic Go %s", v.Type())
+			}
+			defer c.leave(ref)
+		}
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			elem, err := c.fromGo(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = elem
+		}
+		return NewArray(elements), nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		ref, ok := c.enter(v)
+		if !ok {
+			return nil, fmt.Errorf("can't convert cyclic Go %s", v.Type())
+		}
+		defer c.leave(ref)
+		return c.mapFromGo(v)
+
+	case reflect.Struct:
+		return c.structFromGo(v)
+
+	case reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return WrapFunc(v.Interface())
+
+	default:
+		return nil, fmt.Errorf("can't convert Go %s to an object", v.Type())
+	}
+}
+
+func (c *conversion) mapFromGo(v reflect.Value) (Object, error) {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+
+	hash := NewHash()
+	for _, k := range keys {
+		key, err := c.fromGo(k)
+		if err != nil {
+			return nil, err
+		}
+		hashable, ok := AsHashable(key)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		value, err := c.fromGo(v.MapIndex(k))
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(hashable, value)
+	}
+	return &hash, nil
+}
+
+// lessKey orders map keys, numbers and strings by value and everything
+// else by how it prints.
+func lessKey(a, b reflect.Value) bool {
+	for a.Kind() == reflect.Interface && !a.IsNil() {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Interface && !b.IsNil() {
+		b = b.Elem()
+	}
+	if a.Kind() != b.Kind() {
+		return a.Kind() < b.Kind()
+	}
+
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	default:
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	}
+}
+
+func (c *conversion) structFromGo(v reflect.Value) (Object, error) {
+	hash := NewHash()
+	for i := 0; i < v.NumField(); i++ {
+		name, ok := fieldName(v.Type().Field(i))
+		if !ok {
+			continue
+		}
+		value, err := c.fromGo(v.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		hash.Set(&String{Value: name}, value)
+	}
+	return &hash, nil
+}
+
+// fieldName returns the key of field in a hash, ok is false for fields
+// that are left out.
+func fieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	tag := field.Tag.Get("monkey")
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return field.Name, true
+}
+
+// ToGo stores obj in the value target points to, converting it like
+// FromGo the other way round. Integers that don't fit the target are an
+// error. An empty interface gets int64, *big.Int, string, bool, []byte,
+// []interface{} for arrays and sets, map[string]interface{} for hashes
+// with only string keys and map[interface{}]interface{} for the others.
+// Targets that objects can be assigned to, like Object, get obj itself.
+func ToGo(obj Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("target of ToGo must be a non-nil pointer")
+	}
+	return toGo(obj, v.Elem())
+}
+
+func toGo(obj Object, v reflect.Value) error {
+	t := v.Type()
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		value, err := toNative(obj)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			v.Set(reflect.ValueOf(value))
+		} else {
+			v.Set(reflect.Zero(t))
+		}
+		return nil
+	}
+	if reflect.TypeOf(obj).AssignableTo(t) {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+	if _, ok := obj.(*Null); ok {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func:
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+	}
+	if t == bigIntType && IsInteger(obj) {
+		v.Set(reflect.ValueOf(new(big.Int).Set(toBig(obj))))
+		return nil
+	}
+
+	mismatch := fmt.Errorf("can't convert %s to Go %s", obj.Type(), t)
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			return mismatch
+		}
+		v.SetBool(b.Value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*Integer)
+		if !ok && !IsInteger(obj) {
+			return mismatch
+		}
+		if !ok || v.OverflowInt(i.Value) {
+			return fmt.Errorf("%s overflows Go %s", obj.Inspect(), t)
+		}
+		v.SetInt(i.Value)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !IsInteger(obj) {
+			return mismatch
+		}
+		n := toBig(obj)
+		if n.Sign() < 0 || !n.IsUint64() || v.OverflowUint(n.Uint64()) {
+			return fmt.Errorf("%s overflows Go %s", obj.Inspect(), t)
+		}
+		v.SetUint(n.Uint64())
+
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			return mismatch
+		}
+		v.SetString(s.Value)
+
+	case reflect.Ptr:
+		elem := reflect.New(t.Elem())
+		if err := toGo(obj, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+
+	case reflect.Slice:
+		if b, ok := obj.(*Bytes); ok && t.Elem().Kind() == reflect.Uint8 {
+			value := reflect.MakeSlice(t, len(b.Value), len(b.Value))
+			reflect.Copy(value, reflect.ValueOf(b.Value))
+			v.Set(value)
+			return nil
+		}
+		elements, ok := listElements(obj)
+		if !ok {
+			return mismatch
+		}
+		slice := reflect.MakeSlice(t, len(elements), len(elements))
+		for i, elem := range elements {
+			if err := toGo(elem, slice.Index(i)); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		v.Set(slice)
+
+	case reflect.Array:
+		elements, ok := listElements(obj)
+		if !ok {
+			return mismatch
+		}
+		if len(elements) != t.Len() {
+			return fmt.Errorf("can't convert %d elements to Go %s", len(elements), t)
+		}
+		for i, elem := range elements {
+			if err := toGo(elem, v.Index(i)); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+
+	case reflect.Map:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return mismatch
+		}
+		m := reflect.MakeMapWithSize(t, hash.Len())
+		for _, pair := range hash.Pairs() {
+			key := reflect.New(t.Key()).Elem()
+			if err := toGo(pair.Key, key); err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := toGo(pair.Value, value); err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+
+	case reflect.Struct:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return mismatch
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			value, ok := hash.Get(&String{Value: name})
+			if !ok {
+				continue
+			}
+			if err := toGo(value, v.Field(i)); err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+		}
+
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+// listElements returns the elements of an array or a set.
+func listElements(obj Object) ([]Object, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.Elements(), true
+	case *Set:
+		return obj.Elements(), true
+	default:
+		return nil, false
+	}
+}
+
+// toNative returns the Go value an empty interface gets for obj.
+func toNative(obj Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value, nil
+	case *BigInt:
+		return new(big.Int).Set(obj.Value), nil
+	case *String:
+		return obj.Value, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Null:
+		return nil, nil
+	case *Bytes:
+		return append([]byte{}, obj.Value...), nil
+
+	case *Array, *Set:
+		elements, _ := listElements(obj)
+		list := make([]interface{}, len(elements))
+		for i, elem := range elements {
+			value, err := toNative(elem)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			list[i] = value
+		}
+		return list, nil
+
+	case *Hash:
+		if stringKeys(obj) {
+			m := make(map[string]interface{}, obj.Len())
+			for _, pair := range obj.Pairs() {
+				value, err := toNative(pair.Value)
+				if err != nil {
+					return nil, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+				m[pair.Key.(*String).Value] = value
+			}
+			return m, nil
+		}
+		m := make(map[interface{}]interface{}, obj.Len())
+		for _, pair := range obj.Pairs() {
+			key, err := toNative(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			if key != nil && !reflect.TypeOf(key).Comparable() {
+				return nil, fmt.Errorf("can't use %s as a key of a Go map", pair.Key.Type())
+			}
+			value, err := toNative(pair.Value)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			m[key] = value
+		}
+		return m, nil
+
+	default:
+		return obj, nil
+	}
+}
+
+func stringKeys(hash *Hash) bool {
+	for _, key := range hash.Keys() {
+		if _, ok := key.(*String); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// WrapFunc turns the Go function fn into a builtin. The builtin converts
+// its arguments with ToGo and the results of fn with FromGo. A function
+// without results returns null and one with several returns an array of
+// them. If the last result is an error, a non-nil one turns into an
+// Error and isn't part of the results, and so does a panic in fn.
+func WrapFunc(fn interface{}) (*Builtin, error) {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func || f.IsNil() {
+		return nil, fmt.Errorf("can't wrap %T, it's not a function", fn)
+	}
+	t := f.Type()
+
+	return &Builtin{Fn: func(args ...Object) Object {
+		in, err := funcArgs(t, args)
+		if err != nil {
+			return err
+		}
+
+		out, err := call(f, in)
+		if err != nil {
+			return err
+		}
+		if n := len(out); n > 0 && t.Out(n-1) == errorType {
+			if err, _ := out[n-1].Interface().(error); err != nil {
+				return newError("%s", err)
+			}
+			out = out[:n-1]
+		}
+
+		results := make([]Object, len(out))
+		for i, v := range out {
+			result, err := fromGo(v)
+			if err != nil {
+				return newError("%s", err)
+			}
+			results[i] = result
+		}
+
+		switch len(results) {
+		case 0:
+			return NULL
+		case 1:
+			return results[0]
+		default:
+			return NewArray(results)
+		}
+	}}, nil
+}
+
+// call calls f with in and returns a panic in it as an Error, so a failing
+// Go function doesn't take the program embedding Monkey down with it.
+func call(f reflect.Value, in []reflect.Value) (out []reflect.Value, err *Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newError("Go function panicked: %v", r)
+		}
+	}()
+	return f.Call(in), nil
+}
+
+// funcArgs converts args to the parameters of the function type t.
+func funcArgs(t reflect.Type, args []Object) ([]reflect.Value, *Error) {
+	want := t.NumIn()
+	if t.IsVariadic() {
+		if len(args) < want-1 {
+			return nil, newError("wrong number of arguments. got=%d, want at least %d", len(args), want-1)
+		}
+	} else if len(args) != want {
+		return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var param reflect.Type
+		if t.IsVariadic() && i >= want-1 {
+			param = t.In(want - 1).Elem()
+		} else {
+			param = t.In(i)
+		}
+		in[i] = reflect.New(param).Elem()
+		if err := toGo(arg, in[i]); err != nil {
+			return nil, newError("argument %d: %s", i+1, err)
+		}
+	}
+	return in, nil
+}
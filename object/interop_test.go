@@ -0,0 +1,193 @@
+package object
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X      int
+	Y      int    `monkey:"y"`
+	Label  string `monkey:"-"`
+	hidden bool
+}
+
+type node struct {
+	Value int
+	Next  *node
+}
+
+func TestFromGo(t *testing.T) {
+	var nilSlice []int
+	var nilPointer *point
+
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{int8(-3), "-3"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{big.NewInt(7), "7"},
+		{"monkey", "monkey"},
+		{true, "true"},
+		{[]byte("hi"), `b"hi"`},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{nilSlice, "null"},
+		{map[string]int{"b": 2, "a": 1, "c": 3}, "{a : 1, b : 2, c : 3}"},
+		{map[int][]bool{2: {true}, 1: nil}, "{1 : null, 2 : [true]}"},
+		{point{X: 1, Y: 2, Label: "p"}, "{X : 1, y : 2}"},
+		{&point{X: 3}, "{X : 3, y : 0}"},
+		{nilPointer, "null"},
+		{[]interface{}{1, "a", nil}, "[1, a, null]"},
+		{&String{Value: "object"}, "object"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.value)
+		if err != nil {
+			t.Errorf("FromGo(%#v) failed: %s", tt.value, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v) wrong. want=%q, got=%q", tt.value, tt.expected, obj.Inspect())
+		}
+	}
+
+	if obj, _ := FromGo(false); obj != FALSE {
+		t.Errorf("false isn't converted to FALSE")
+	}
+	if _, err := FromGo(1.5); err == nil || err.Error() != "can't convert Go float64 to an object" {
+		t.Errorf("wrong error for a float. got=%v", err)
+	}
+}
+
+func TestFromGoCycles(t *testing.T) {
+	n := &node{Value: 1}
+	n.Next = n
+	if _, err := FromGo(n); err == nil || err.Error() != "field Next: can't convert cyclic Go *object.node" {
+		t.Errorf("wrong error for a cyclic pointer. got=%v", err)
+	}
+
+	m := map[string]interface{}{}
+	m["self"] = m
+	if _, err := FromGo(m); err == nil || err.Error() != "can't convert cyclic Go map[string]interface {}" {
+		t.Errorf("wrong error for a cyclic map. got=%v", err)
+	}
+
+	s := []interface{}{1, nil}
+	s[1] = s
+	if _, err := FromGo(s); err == nil || err.Error() != "can't convert cyclic Go []interface {}" {
+		t.Errorf("wrong error for a cyclic slice. got=%v", err)
+	}
+
+	shared := &node{Value: 2}
+	obj, err := FromGo([]*node{shared, shared, {Value: 3, Next: shared}})
+	if err != nil {
+		t.Fatalf("shared value failed: %s", err)
+	}
+	expected := "[{Value : 2, Next : null}, {Value : 2, Next : null}, {Value : 3, Next : {Value : 2, Next : null}}]"
+	if obj.Inspect() != expected {
+		t.Errorf("shared value wrong. want=%q, got=%q", expected, obj.Inspect())
+	}
+}
+
+func TestToGo(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "X"}, &Integer{Value: 1})
+	hash.Set(&String{Value: "y"}, &Integer{Value: 2})
+	hash.Set(&String{Value: "Label"}, &String{Value: "ignored"})
+
+	var p point
+	if err := ToGo(&hash, &p); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	if p != (point{X: 1, Y: 2}) {
+		t.Errorf("wrong struct. got=%+v", p)
+	}
+
+	var m map[string]int
+	if err := ToGo(&hash, &m); err == nil {
+		t.Errorf("expected an error converting a string to int")
+	}
+
+	var ints []int
+	if err := ToGo(NewArray([]Object{&Integer{Value: 1}, &Integer{Value: 2}}), &ints); err != nil || !reflect.DeepEqual(ints, []int{1, 2}) {
+		t.Errorf("wrong slice. got=%v (%v)", ints, err)
+	}
+
+	var small int8
+	if err := ToGo(&Integer{Value: 300}, &small); err == nil || err.Error() != "300 overflows Go int8" {
+		t.Errorf("wrong overflow error. got=%v", err)
+	}
+
+	var large *big.Int
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	if err := ToGo(NewInteger(huge), &large); err != nil || large.Cmp(huge) != 0 {
+		t.Errorf("wrong big integer. got=%v (%v)", large, err)
+	}
+
+	var value interface{}
+	nested := NewArray([]Object{&hash, &Bytes{Value: []byte("b")}, NULL})
+	if err := ToGo(nested, &value); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"X": int64(1), "y": int64(2), "Label": "ignored"},
+		[]byte("b"),
+		nil,
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("wrong value. want=%#v, got=%#v", expected, value)
+	}
+
+	var obj Object
+	if err := ToGo(nested, &obj); err != nil || obj != nested {
+		t.Errorf("object not stored as is. got=%v (%v)", obj, err)
+	}
+
+	if err := ToGo(nested, ints); err == nil {
+		t.Errorf("expected an error for a target that isn't a pointer")
+	}
+}
+
+func TestWrapFunc(t *testing.T) {
+	tests := []struct {
+		fn       interface{}
+		args     []Object
+		expected string
+	}{
+		{strings.Repeat, []Object{&String{Value: "ab"}, &Integer{Value: 2}}, "abab"},
+		{func(xs ...int) int { return len(xs) }, []Object{&Integer{Value: 1}, &Integer{Value: 2}}, "2"},
+		{func() {}, nil, "null"},
+		{func(a, b int) (int, int) { return b, a }, []Object{&Integer{Value: 1}, &Integer{Value: 2}}, "[2, 1]"},
+		{func(n int) (int, error) { return n, nil }, []Object{&Integer{Value: 1}}, "1"},
+		{func(n int) (int, error) { return 0, errors.New("failed") }, []Object{&Integer{Value: 1}}, "ERROR: failed"},
+		{strings.Repeat, []Object{&String{Value: "ab"}}, "ERROR: wrong number of arguments. got=1, want=2"},
+		{strings.Repeat, []Object{&Integer{Value: 1}, &Integer{Value: 2}}, "ERROR: argument 1: can't convert INTEGER to Go string"},
+		{func(xs ...int) int { return 0 }, []Object{&String{Value: "a"}}, "ERROR: argument 1: can't convert STRING to Go int"},
+		{func(m map[string]int) { m["a"] = 1 }, []Object{NULL}, "ERROR: Go function panicked: assignment to entry in nil map"},
+		{func(xs []int) int { return xs[2] }, []Object{NewArray(nil)},
+			"ERROR: Go function panicked: runtime error: index out of range [2] with length 0"},
+	}
+
+	for i, tt := range tests {
+		builtin, err := WrapFunc(tt.fn)
+		if err != nil {
+			t.Fatalf("[%d] WrapFunc failed: %s", i, err)
+		}
+		if got := builtin.Fn(tt.args...).Inspect(); got != tt.expected {
+			t.Errorf("[%d] wrong result. want=%q, got=%q", i, tt.expected, got)
+		}
+	}
+
+	if _, err := WrapFunc(42); err == nil {
+		t.Errorf("expected an error wrapping an integer")
+	}
+}
@@ -2,6 +2,7 @@ package object
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"hash/fnv"
 	"monkey/ast"
@@ -26,21 +27,34 @@ const (
 	QUOTE_OBJ             = "QUOTE"
 	MACRO_OBJ             = "MACRO"
 	CLOSURE_OBJ           = "CLOSURE"
+	BIGINT_OBJ            = "BIGINT"
+	BYTES_OBJ             = "BYTES"
+	SET_OBJ               = "SET"
 )
 
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	// root is the outermost environment, the one holding the budget and
+	// the runtime.
+	root    *Environment
+	budget  *Budget
+	runtime *Runtime
+	// builtins are the builtins of runtime as bound by the evaluator.
+	builtins []*Builtin
 }
 
 func NewEnvironment() *Environment {
 	store := make(map[string]Object)
-	return &Environment{store: store, outer: nil}
+	env := &Environment{store: store, outer: nil}
+	env.root = env
+	return env
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.root = outer.root
 	return env
 }
 
@@ -57,6 +71,45 @@ func (e *Environment) Set(name string, val Object) Object {
 	return val
 }
 
+// Budget returns the budget evaluation in e is charged to. It belongs to
+// the outermost environment, so functions share it with their callers.
+func (e *Environment) Budget() *Budget {
+	return e.root.budget
+}
+
+// SetBudget sets the budget of the outermost environment of e, nil turns
+// budgeting off.
+func (e *Environment) SetBudget(b *Budget) {
+	e.root.budget = b
+}
+
+// Runtime returns the runtime builtins in e are looked up in. It belongs
+// to the outermost environment, DefaultRuntime if it has none.
+func (e *Environment) Runtime() *Runtime {
+	if e.root.runtime == nil {
+		return DefaultRuntime
+	}
+	return e.root.runtime
+}
+
+// SetRuntime sets the runtime of the outermost environment of e.
+func (e *Environment) SetRuntime(rt *Runtime) {
+	e.root.runtime = rt
+	e.root.builtins = nil
+}
+
+// Builtins returns the builtins SetBuiltins bound for the runtime of e.
+// Like the runtime, they belong to the outermost environment.
+func (e *Environment) Builtins() []*Builtin {
+	return e.root.builtins
+}
+
+// SetBuiltins sets the builtins of the outermost environment of e, the
+// ones of its runtime bound by the engine running in it.
+func (e *Environment) SetBuiltins(builtins []*Builtin) {
+	e.root.builtins = builtins
+}
+
 func (e *Environment) All() map[string]Object {
 	var env map[string]Object
 	if e.outer == nil {
@@ -84,31 +137,106 @@ func (q *Quote) Inspect() string {
 	return "QUOTE(" + q.Node.String() + ")"
 }
 
+// An Array is an immutable list of objects. Push, Pop and Rest return a
+// new array sharing most of its structure with the old one, in O(log n)
+// time.
 type Array struct {
-	Elements []Object
+	elements vector
+}
+
+func NewArray(elements []Object) *Array {
+	return &Array{elements: newVector(elements)}
+}
+
+func (ao *Array) Len() int {
+	return ao.elements.len()
+}
+
+// At returns the element at index i, which must be in range.
+func (ao *Array) At(i int) Object {
+	return ao.elements.get(i)
+}
+
+// Elements returns a copy of the elements of ao.
+func (ao *Array) Elements() []Object {
+	return ao.elements.elements()
+}
+
+// Push returns ao with obj added at the end.
+func (ao *Array) Push(obj Object) *Array {
+	return &Array{elements: ao.elements.push(obj)}
+}
+
+// Pop returns ao without its last element. ao must not be empty.
+func (ao *Array) Pop() *Array {
+	return &Array{elements: ao.elements.pop()}
+}
+
+// Rest returns ao without its first element. ao must not be empty.
+func (ao *Array) Rest() *Array {
+	return &Array{elements: ao.elements.rest()}
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
-func (ao *Array) Inspect() string {
-	var out bytes.Buffer
-	elements := []string{}
-	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+
+// HashKey combines the hash keys of the elements, all of which have to be
+// Hashable, see AsHashable.
+func (ao *Array) HashKey() HashKey {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, e := range ao.Elements() {
+		key := e.(Hashable).HashKey()
+		h.Write([]byte(key.Type))
+		binary.LittleEndian.PutUint64(buf[:], key.Value)
+		h.Write(buf[:])
 	}
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-	return out.String()
+	return HashKey{Type: ao.Type(), Value: h.Sum64()}
+}
+
+func (ao *Array) KeyEquals(other Hashable) bool {
+	o, ok := other.(*Array)
+	if !ok || o.Len() != ao.Len() {
+		return false
+	}
+	for i, e := range ao.Elements() {
+		oe, ok := o.At(i).(Hashable)
+		if !ok || !e.(Hashable).KeyEquals(oe) {
+			return false
+		}
+	}
+	return true
 }
+func (ao *Array) Inspect() string { return Inspector{}.Inspect(ao) }
 
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
 }
 
+// A Hashable can be used as a hash key. Different keys may have the same
+// HashKey, KeyEquals tells them apart.
 type Hashable interface {
 	Object
 	HashKey() HashKey
+	KeyEquals(other Hashable) bool
+}
+
+// AsHashable returns obj as a hash key. Arrays are keys if all their
+// elements are.
+func AsHashable(obj Object) (Hashable, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		for _, e := range obj.Elements() {
+			if _, ok := AsHashable(e); !ok {
+				return nil, false
+			}
+		}
+		return obj, true
+	case Hashable:
+		return obj, true
+	default:
+		return nil, false
+	}
 }
 
 type HashPair struct {
@@ -116,48 +244,86 @@ type HashPair struct {
 	Value Object
 }
 
+// A Hash keeps its pairs in the order their keys were first set, so
+// Inspect, Pairs, Keys and Values are the same on every run. The pairs
+// are kept in a persistent trie, copying a Hash takes constant time and
+// setting a key in the copy leaves the original untouched.
 type Hash struct {
-	data map[HashKey]HashPair
+	root *hamtNode
+	// keys are the keys in insertion order
+	keys vector
 }
 
 func NewHash() Hash {
-	return Hash{data: make(map[HashKey]HashPair)}
+	return Hash{}
 }
 
 func (h *Hash) Get(key Hashable) (Object, bool) {
-	pair, ok := h.data[key.HashKey()]
+	pair, ok := h.root.get(key, key.HashKey().Value)
 	if !ok {
 		return nil, false
 	}
 	return pair.Value, true
 }
 
+// Set sets the value for key. A key that is set again keeps its place.
 func (h *Hash) Set(key Hashable, val Object) {
-	h.data[key.HashKey()] = HashPair{Key: key, Value: val}
+	root, added := h.root.set(HashPair{Key: key, Value: val}, key.HashKey().Value, 0)
+	h.root = root
+	if added {
+		h.keys = h.keys.push(key)
+	}
 }
 
 func (h *Hash) Len() int {
-	return len(h.data)
+	return h.keys.len()
 }
 
-func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
-	elements := []string{}
-	for _, pair := range h.data {
-		elements = append(elements, pair.Key.Inspect()+" : "+pair.Value.Inspect())
+// Pairs returns the pairs of h in insertion order.
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, h.Len())
+	for _, key := range h.keys.elements() {
+		pair, _ := h.root.get(key.(Hashable), key.(Hashable).HashKey().Value)
+		pairs = append(pairs, pair)
 	}
+	return pairs
+}
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("}")
-	return out.String()
+// Keys returns the keys of h in insertion order.
+func (h *Hash) Keys() []Object {
+	keys := make([]Object, 0, h.Len())
+	for _, pair := range h.Pairs() {
+		keys = append(keys, pair.Key)
+	}
+	return keys
+}
+
+// Values returns the values of h in the order of their keys.
+func (h *Hash) Values() []Object {
+	values := make([]Object, 0, h.Len())
+	for _, pair := range h.Pairs() {
+		values = append(values, pair.Value)
+	}
+	return values
 }
 
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string  { return Inspector{}.Inspect(h) }
+
 type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// BudgetFn, if set, is called by Call instead of Fn.
+	BudgetFn func(b *Budget, args ...Object) Object
+}
+
+// Call calls b with the budget of the run calling it, which may be nil.
+func (b *Builtin) Call(budget *Budget, args ...Object) Object {
+	if b.BudgetFn != nil {
+		return b.BudgetFn(budget, args...)
+	}
+	return b.Fn(args...)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -189,6 +355,10 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	// Constants is the constant pool of a function compiled on its own,
+	// like the ones eval_quote returns. Functions without one use the
+	// pool of the VM running them.
+	Constants []Object
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -237,6 +407,10 @@ func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
+func (i *Integer) KeyEquals(other Hashable) bool {
+	o, ok := other.(*Integer)
+	return ok && o.Value == i.Value
+}
 
 type String struct {
 	Value string
@@ -249,6 +423,27 @@ func (s *String) HashKey() HashKey {
 	h.Write([]byte(s.Value))
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
+func (s *String) KeyEquals(other Hashable) bool {
+	o, ok := other.(*String)
+	return ok && o.Value == s.Value
+}
+
+// Bytes is an immutable byte string, for binary data that isn't text.
+type Bytes struct {
+	Value []byte
+}
+
+func (b *Bytes) Type() ObjectType { return BYTES_OBJ }
+func (b *Bytes) Inspect() string  { return ast.QuoteBytes(b.Value) }
+func (b *Bytes) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write(b.Value)
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+func (b *Bytes) KeyEquals(other Hashable) bool {
+	o, ok := other.(*Bytes)
+	return ok && bytes.Equal(o.Value, b.Value)
+}
 
 type Boolean struct {
 	Value bool
@@ -263,6 +458,26 @@ func (b *Boolean) HashKey() HashKey {
 	}
 	return HashKey{Type: b.Type(), Value: val}
 }
+func (b *Boolean) KeyEquals(other Hashable) bool {
+	o, ok := other.(*Boolean)
+	return ok && o.Value == b.Value
+}
+
+// TRUE, FALSE and NULL are the only booleans and null the engines create,
+// they tell them apart by identity.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+// NativeBool returns TRUE or FALSE for b.
+func NativeBool(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
 
 type Null struct{}
 
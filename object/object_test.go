@@ -0,0 +1,97 @@
+package object
+
+import (
+	"context"
+	"testing"
+)
+
+// collidingKey has the same HashKey as every other collidingKey.
+type collidingKey struct {
+	String
+}
+
+func (k *collidingKey) HashKey() HashKey {
+	return HashKey{Type: STRING_OBJ, Value: 42}
+}
+
+func (k *collidingKey) KeyEquals(other Hashable) bool {
+	o, ok := other.(*collidingKey)
+	return ok && o.Value == k.Value
+}
+
+func TestHashCollisions(t *testing.T) {
+	hash := NewHash()
+	a := &collidingKey{String{Value: "a"}}
+	b := &collidingKey{String{Value: "b"}}
+
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(b, &Integer{Value: 2})
+	hash.Set(&collidingKey{String{Value: "a"}}, &Integer{Value: 3})
+
+	if hash.Len() != 2 {
+		t.Fatalf("hash has wrong number of pairs. want=2, got=%d", hash.Len())
+	}
+	if hash.Inspect() != "{a : 3, b : 2}" {
+		t.Errorf("wrong hash. got=%q", hash.Inspect())
+	}
+	if val, ok := hash.Get(b); !ok || val.Inspect() != "2" {
+		t.Errorf("wrong value for b. got=%v", val)
+	}
+	if _, ok := hash.Get(&collidingKey{String{Value: "c"}}); ok {
+		t.Errorf("found a value for a missing key")
+	}
+}
+
+func TestArrayHashKeys(t *testing.T) {
+	one := NewArray([]Object{&Integer{Value: 1}, &String{Value: "x"}})
+	two := NewArray([]Object{&Integer{Value: 1}, &String{Value: "x"}})
+	other := NewArray([]Object{&String{Value: "x"}, &Integer{Value: 1}})
+
+	if one.HashKey() != two.HashKey() || !one.KeyEquals(two) {
+		t.Errorf("arrays with the same elements are different keys")
+	}
+	if one.KeyEquals(other) {
+		t.Errorf("arrays with different elements are the same key")
+	}
+
+	unhashable := NewArray([]Object{NewArray([]Object{&Hash{}})})
+	if _, ok := AsHashable(unhashable); ok {
+		t.Errorf("array of a hash is hashable")
+	}
+}
+
+func TestEnvironmentBudget(t *testing.T) {
+	outer := NewEnvironment()
+	inner := NewEnclosedEnvironment(NewEnclosedEnvironment(outer))
+
+	budget, cancel := NewBudget(context.Background(), Limits{MaxCollectionSize: 3})
+	defer cancel()
+	inner.SetBudget(budget)
+	if outer.Budget() != budget || inner.Budget() != budget {
+		t.Errorf("environments don't share the budget of the outermost one")
+	}
+
+	rt := NewRuntime()
+	outer.SetRuntime(rt)
+	if inner.Runtime() != rt {
+		t.Errorf("enclosed environment doesn't use the runtime of the outermost one")
+	}
+
+	builtin := &Builtin{BudgetFn: func(b *Budget, args ...Object) Object {
+		if err := b.CheckLength(int64(len(args))); err != nil {
+			return newError("%s", err)
+		}
+		return NewArray(args)
+	}}
+	one := &Integer{Value: 1}
+	if result := builtin.Call(budget, one, one, one); result.Type() != ARRAY_OBJ {
+		t.Errorf("builtin within the limit failed: %s", result.Inspect())
+	}
+	result := builtin.Call(budget, one, one, one, one)
+	if result.Inspect() != "ERROR: collection size limit exceeded: more than 3 elements" {
+		t.Errorf("builtin wasn't given the budget. got=%s", result.Inspect())
+	}
+	if budget.Err() == nil {
+		t.Errorf("failed check didn't fail the budget")
+	}
+}
@@ -0,0 +1,239 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"monkey/ast"
+	"monkey/token"
+)
+
+// ToAstNode returns the code that evaluates to obj. Quotes turn into a copy
+// of the code they hold. Objects without a literal, like functions and
+// null, return nil.
+func ToAstNode(obj Object) ast.Node {
+	switch obj := obj.(type) {
+	case *Integer:
+		t := token.Token{
+			Type:    token.INT,
+			Literal: fmt.Sprintf("%d", obj.Value),
+		}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+
+	case *BigInt:
+		t := token.Token{Type: token.INT, Literal: obj.Value.String()}
+		return &ast.BigIntegerLiteral{Token: t, Value: new(big.Int).Set(obj.Value)}
+
+	case *Bytes:
+		value := append([]byte{}, obj.Value...)
+		return &ast.BytesLiteral{Token: token.Token{Type: token.BYTES, Literal: string(value)}, Value: value}
+
+	case *Boolean:
+		if obj.Value {
+			return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}
+		} else {
+			return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}
+		}
+
+	case *String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: obj.Value}, Value: obj.Value}
+
+	case *Array:
+		elements, ok := ToExpressions(obj.Elements())
+		if !ok {
+			return nil
+		}
+		return &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Elements: elements}
+
+	case *Hash:
+		hash := &ast.HashLiteral{Token: token.Token{Type: token.LBRACE, Literal: "{"}}
+		for _, pair := range obj.Pairs() {
+			pair, ok := ToExpressions([]Object{pair.Key, pair.Value})
+			if !ok {
+				return nil
+			}
+			hash.Data = append(hash.Data, ast.HashPair{Key: pair[0], Value: pair[1]})
+		}
+		return hash
+
+	case *Set:
+		elements, ok := ToExpressions(obj.Elements())
+		if !ok {
+			return nil
+		}
+		return &ast.SetLiteral{Token: token.Token{Type: token.SET_LBRACE, Literal: "#{"}, Elements: elements}
+
+	case *Quote:
+		return ast.Clone(obj.Node)
+
+	default:
+		return nil
+	}
+}
+
+// ToExpressions converts objs with ToAstNode and reports whether all of
+// them turned into expressions.
+func ToExpressions(objs []Object) ([]ast.Expression, bool) {
+	exps := make([]ast.Expression, 0, len(objs))
+	for _, obj := range objs {
+		exp, ok := ToAstNode(obj).(ast.Expression)
+		if !ok {
+			return nil, false
+		}
+		exps = append(exps, exp)
+	}
+	return exps, true
+}
+
+// ToStatements converts objs with ToAstNode and reports whether all of
+// them turned into statements or expressions. Expressions are wrapped in
+// expression statements.
+func ToStatements(objs []Object) ([]ast.Statement, bool) {
+	stmts := make([]ast.Statement, 0, len(objs))
+	for _, obj := range objs {
+		switch node := ToAstNode(obj).(type) {
+		case ast.Statement:
+			stmts = append(stmts, node)
+		case ast.Expression:
+			stmts = append(stmts, &ast.ExpressionStatement{Token: token.Token{Literal: node.TokenLiteral()}, Expression: node})
+		default:
+			return nil, false
+		}
+	}
+	return stmts, true
+}
+
+// IsUnquoteCall reports whether node is a call of unquote with one argument.
+func IsUnquoteCall(node ast.Node) bool {
+	return isCallOf(node, "unquote")
+}
+
+// IsSpliceCall reports whether node is a call of unquote_splice with one
+// argument.
+func IsSpliceCall(node ast.Node) bool {
+	return isCallOf(node, "unquote_splice")
+}
+
+func isCallOf(node ast.Node, name string) bool {
+	call, ok := node.(*ast.CallExpression)
+	return ok && call.Function != nil && call.Function.TokenLiteral() == name && len(call.Arguments) == 1
+}
+
+// UnquoteCalls returns the unquote and unquote_splice calls in template in
+// source order. Calls in the arguments of other ones are left out, they
+// belong to quotes evaluated later.
+func UnquoteCalls(template ast.Node) []*ast.CallExpression {
+	calls := []*ast.CallExpression{}
+	ast.Inspect(template, func(n ast.Node) bool {
+		if IsUnquoteCall(n) || IsSpliceCall(n) {
+			calls = append(calls, n.(*ast.CallExpression))
+			return false
+		}
+		return true
+	})
+	return calls
+}
+
+// Unquote returns a copy of template with the calls UnquoteCalls finds
+// replaced by the code for values, the values of their arguments. An
+// unquote_splice call in a list of arguments, elements or statements is
+// replaced by the elements of its value. It fails for values that have no
+// code, like functions.
+func Unquote(template ast.Node, values []Object) (ast.Node, error) {
+	template = ast.Clone(template)
+
+	index := map[ast.Node]int{}
+	for i, call := range UnquoteCalls(template) {
+		index[call] = i
+	}
+	if len(index) != len(values) {
+		return nil, fmt.Errorf("quote needs %d values, got %d", len(index), len(values))
+	}
+
+	var err error
+	convert := func(n ast.Node) ast.Node {
+		node := ToAstNode(values[index[n]])
+		if node == nil && err == nil {
+			err = fmt.Errorf("can't unquote %s, it has no literal", values[index[n]].Type())
+		}
+		return node
+	}
+	splice := func(n ast.Node) ([]Object, bool) {
+		if _, ok := index[n]; !ok || !IsSpliceCall(n) {
+			return nil, false
+		}
+		list, ok := values[index[n]].(*Array)
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("can't splice %s, it's not an array", values[index[n]].Type())
+			}
+			return nil, true
+		}
+		return list.Elements(), true
+	}
+
+	spliceExpressions := func(exps []ast.Expression) []ast.Expression {
+		out := make([]ast.Expression, 0, len(exps))
+		for _, exp := range exps {
+			elements, ok := splice(exp)
+			if !ok {
+				out = append(out, exp)
+				continue
+			}
+			converted, ok := ToExpressions(elements)
+			if !ok && err == nil {
+				err = fmt.Errorf("can't splice %s, not all elements are expressions", ErrorInspector.Inspect(NewArray(elements)))
+			}
+			out = append(out, converted...)
+		}
+		return out
+	}
+	spliceStatements := func(stmts []ast.Statement) []ast.Statement {
+		out := make([]ast.Statement, 0, len(stmts))
+		for _, stmt := range stmts {
+			exp, ok := stmt.(*ast.ExpressionStatement)
+			if !ok {
+				out = append(out, stmt)
+				continue
+			}
+			elements, ok := splice(exp.Expression)
+			if !ok {
+				out = append(out, stmt)
+				continue
+			}
+			converted, ok := ToStatements(elements)
+			if !ok && err == nil {
+				err = fmt.Errorf("can't splice %s, not all elements are code", ErrorInspector.Inspect(NewArray(elements)))
+			}
+			out = append(out, converted...)
+		}
+		return out
+	}
+
+	unquoted := ast.Modify(template, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.CallExpression:
+			if _, ok := index[n]; ok && IsUnquoteCall(n) {
+				return convert(n)
+			}
+			n.Arguments = spliceExpressions(n.Arguments)
+
+		case *ast.ArrayLiteral:
+			n.Elements = spliceExpressions(n.Elements)
+
+		case *ast.SetLiteral:
+			n.Elements = spliceExpressions(n.Elements)
+
+		case *ast.BlockStatement:
+			n.Statements = spliceStatements(n.Statements)
+
+		case *ast.Program:
+			n.Statements = spliceStatements(n.Statements)
+		}
+
+		return n
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unquoted, nil
+}
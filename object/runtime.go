@@ -0,0 +1,139 @@
+package object
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MaxBuiltins is the number of builtins a runtime can hold, compiled code
+// refers to them by a one byte index.
+const MaxBuiltins = 256
+
+// A Runtime is the table of builtin functions of an interpreter. Every
+// runtime starts with the builtins in Builtins, at the same indexes, so
+// code compiled with one runs with any other runtime that has the
+// builtins it uses. The compiler, the VM and the evaluator look builtins
+// up in the runtime they're given, or DefaultRuntime. A runtime can be
+// used by several goroutines at once.
+type Runtime struct {
+	mu       sync.RWMutex
+	builtins []*BuiltinDefinition
+	index    map[string]int
+}
+
+// DefaultRuntime is the runtime of interpreters that aren't given one.
+// Builtins registered with it are seen by all of them.
+var DefaultRuntime = NewRuntime()
+
+func NewRuntime() *Runtime {
+	rt := &Runtime{index: map[string]int{}}
+	for _, def := range Builtins {
+		rt.add(def)
+	}
+	return rt
+}
+
+// Register adds the builtin fn under name. It has to be registered before
+// the compiler for rt is made, the compiler resolves names up front. fn
+// is a BuiltinFunction, which gets its arguments as they are, a *Builtin,
+// or any other Go function, which is wrapped with WrapFunc.
+func (rt *Runtime) Register(name string, fn interface{}) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("can't register builtin %q, it's not an identifier", name)
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if _, ok := rt.index[name]; ok {
+		return fmt.Errorf("builtin %s is already registered", name)
+	}
+	if len(rt.builtins) >= MaxBuiltins {
+		return fmt.Errorf("can't register builtin %s, there are %d already", name, MaxBuiltins)
+	}
+
+	def := &BuiltinDefinition{Name: name, Params: []ArgSpec{Any}, Variadic: true}
+	switch fn := fn.(type) {
+	case BuiltinFunction:
+		def.Fn = fn
+		def.Builtin = &Builtin{Fn: fn}
+	case func(args ...Object) Object:
+		def.Fn = fn
+		def.Builtin = &Builtin{Fn: fn}
+	case *Builtin:
+		def.Fn = fn.Fn
+		def.Builtin = fn
+	default:
+		builtin, err := WrapFunc(fn)
+		if err != nil {
+			return fmt.Errorf("can't register builtin %s: %w", name, err)
+		}
+		def.Fn = builtin.Fn
+		def.Builtin = builtin
+	}
+
+	rt.add(def)
+	return nil
+}
+
+func (rt *Runtime) add(def *BuiltinDefinition) {
+	rt.index[def.Name] = len(rt.builtins)
+	rt.builtins = append(rt.builtins, def)
+}
+
+// Builtins returns the builtins of rt, the index of each is the one
+// compiled code refers to it by.
+func (rt *Runtime) Builtins() []*BuiltinDefinition {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return rt.builtins[:len(rt.builtins):len(rt.builtins)]
+}
+
+// Bind returns the builtins of rt for code run by run, at the same
+// indexes, with the ones that need the engine bound to it.
+func (rt *Runtime) Bind(run Engine) []*Builtin {
+	builtins := rt.Builtins()
+	bound := make([]*Builtin, len(builtins))
+	for i, def := range builtins {
+		bound[i] = def.BindEngine(run)
+	}
+	return bound
+}
+
+// Index returns the index of the builtin called name.
+func (rt *Runtime) Index(name string) (int, bool) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	i, ok := rt.index[name]
+	return i, ok
+}
+
+// Lookup returns the builtin called name.
+func (rt *Runtime) Lookup(name string) (*BuiltinDefinition, bool) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	i, ok := rt.index[name]
+	if !ok {
+		return nil, false
+	}
+	return rt.builtins[i], true
+}
+
+// Check returns an error if rt doesn't have the registered builtins
+// compiled code refers to. names holds the name of every builtin after the
+// ones in Builtins, in order, or "" for those the code doesn't use.
+func (rt *Runtime) Check(names []string) error {
+	builtins := rt.Builtins()
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		index := len(Builtins) + i
+		if index >= len(builtins) {
+			return fmt.Errorf("builtin %s isn't registered", name)
+		}
+		if builtins[index].Name != name {
+			return fmt.Errorf("builtin %s isn't registered at index %d, %s is", name, index, builtins[index].Name)
+		}
+	}
+	return nil
+}
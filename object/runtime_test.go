@@ -0,0 +1,116 @@
+package object
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRuntimeRegister(t *testing.T) {
+	rt := NewRuntime()
+	if len(rt.Builtins()) != len(Builtins) {
+		t.Fatalf("new runtime has %d builtins, want %d", len(rt.Builtins()), len(Builtins))
+	}
+
+	if err := rt.Register("shout", strings.ToUpper); err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+	def, ok := rt.Lookup("shout")
+	if !ok {
+		t.Fatalf("registered builtin not found")
+	}
+	if rt.Builtins()[len(Builtins)] != def {
+		t.Errorf("registered builtin isn't after the standard ones")
+	}
+	if got := def.Builtin.Fn(&String{Value: "abc"}).Inspect(); got != "ABC" {
+		t.Errorf("wrong result. got=%q", got)
+	}
+
+	count := func(args ...Object) Object { return &Integer{Value: int64(len(args))} }
+	if err := rt.Register("count", count); err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+	if def, _ := rt.Lookup("count"); def.Builtin.Fn(NULL, NULL).Inspect() != "2" {
+		t.Errorf("builtin function doesn't get its arguments as they are")
+	}
+
+	if _, ok := NewRuntime().Lookup("shout"); ok {
+		t.Errorf("builtin registered with one runtime is in another")
+	}
+	if _, ok := DefaultRuntime.Lookup("shout"); ok {
+		t.Errorf("builtin registered with a runtime is in the default one")
+	}
+
+	errors := []struct {
+		name     string
+		fn       interface{}
+		expected string
+	}{
+		{"shout", strings.ToLower, "builtin shout is already registered"},
+		{"len", strings.ToLower, "builtin len is already registered"},
+		{"to_lower", 42, "can't register builtin to_lower: can't wrap int, it's not a function"},
+		{"lower2", strings.ToLower, `can't register builtin "lower2", it's not an identifier`},
+		{"let", strings.ToLower, `can't register builtin "let", it's not an identifier`},
+	}
+	for _, tt := range errors {
+		err := rt.Register(tt.name, tt.fn)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error registering %s. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestRuntimeFull(t *testing.T) {
+	rt := NewRuntime()
+	names := "abcdefghijklmnopqrstuvwxyz"
+	var err error
+	for i := len(rt.Builtins()); i < MaxBuiltins+1 && err == nil; i++ {
+		err = rt.Register("f_"+string(names[i/26%26])+string(names[i%26]), func() {})
+	}
+	if err == nil || len(rt.Builtins()) != MaxBuiltins {
+		t.Errorf("runtime took more than %d builtins. got=%d (%v)", MaxBuiltins, len(rt.Builtins()), err)
+	}
+}
+
+func TestRuntimeConcurrentUse(t *testing.T) {
+	rt := NewRuntime()
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 26; i++ {
+			rt.Register("f_"+string(rune('a'+i)), strings.ToUpper)
+		}
+		done <- true
+	}()
+	for i := 0; i < 100; i++ {
+		rt.Lookup("f_a")
+		_ = rt.Builtins()
+	}
+	<-done
+
+	if _, ok := rt.Lookup("f_z"); !ok {
+		t.Errorf("builtin registered concurrently is missing")
+	}
+}
+
+func TestRuntimeCheck(t *testing.T) {
+	rt := NewRuntime()
+	rt.Register("shout", strings.ToUpper)
+	rt.Register("whisper", strings.ToLower)
+
+	tests := []struct {
+		names    []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"shout", "whisper"}, ""},
+		{[]string{"", "whisper"}, ""},
+		{[]string{"whisper"}, "builtin whisper isn't registered at index " + strconv.Itoa(len(Builtins)) + ", shout is"},
+		{[]string{"", "", "count"}, "builtin count isn't registered"},
+	}
+	for _, tt := range tests {
+		err := rt.Check(tt.names)
+		if tt.expected == "" && err != nil || tt.expected != "" && (err == nil || err.Error() != tt.expected) {
+			t.Errorf("wrong result checking %q. want=%q, got=%v", tt.names, tt.expected, err)
+		}
+	}
+}
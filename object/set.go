@@ -0,0 +1,93 @@
+package object
+
+import "fmt"
+
+// A Set holds each of its elements once, in the order they were first
+// added. Like a Hash, copying a Set takes constant time and adding to the
+// copy leaves the original untouched.
+type Set struct {
+	elements Hash
+}
+
+func NewSet() Set {
+	return Set{elements: NewHash()}
+}
+
+// Add adds elem to s, unless it's already in it.
+func (s *Set) Add(elem Hashable) {
+	if !s.Has(elem) {
+		s.elements.Set(elem, elem)
+	}
+}
+
+func (s *Set) Has(elem Hashable) bool {
+	_, ok := s.elements.Get(elem)
+	return ok
+}
+
+func (s *Set) Len() int {
+	return s.elements.Len()
+}
+
+// Elements returns the elements of s in insertion order.
+func (s *Set) Elements() []Object {
+	return s.elements.Keys()
+}
+
+// Union returns a set with the elements of s followed by those of other.
+func (s *Set) Union(other *Set) *Set {
+	union := *s
+	for _, elem := range other.Elements() {
+		union.Add(elem.(Hashable))
+	}
+	return &union
+}
+
+// Intersect returns a set with the elements of s that are in other.
+func (s *Set) Intersect(other *Set) *Set {
+	intersection := NewSet()
+	for _, elem := range s.Elements() {
+		if other.Has(elem.(Hashable)) {
+			intersection.Add(elem.(Hashable))
+		}
+	}
+	return &intersection
+}
+
+// Difference returns a set with the elements of s that aren't in other.
+func (s *Set) Difference(other *Set) *Set {
+	difference := NewSet()
+	for _, elem := range s.Elements() {
+		if !other.Has(elem.(Hashable)) {
+			difference.Add(elem.(Hashable))
+		}
+	}
+	return &difference
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string  { return Inspector{}.Inspect(s) }
+
+// Contains reports whether elem is an element of container, which is a set
+// or a hash. Elements of a hash are its keys.
+func Contains(container, elem Object) (bool, error) {
+	switch container := container.(type) {
+	case *Set:
+		key, ok := AsHashable(elem)
+		if !ok {
+			return false, fmt.Errorf("unusable as set element: %s", elem.Type())
+		}
+		return container.Has(key), nil
+
+	case *Hash:
+		key, ok := AsHashable(elem)
+		if !ok {
+			return false, fmt.Errorf("unusable as hash key: %s", elem.Type())
+		}
+		_, found := container.Get(key)
+		return found, nil
+
+	default:
+		return false, fmt.Errorf("unknown operator: %s in %s", elem.Type(), container.Type())
+	}
+}
@@ -0,0 +1,176 @@
+package object
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// A vector is a persistent list of objects, a trie of 32-wide nodes with
+// the last leaf kept apart as the tail. Pushing and popping copy one path
+// of the trie and dropping the first element only moves start, so all of
+// them leave the vector they're called on untouched. The zero value is an
+// empty vector.
+type vector struct {
+	// start is the index of the first element, the ones before it were
+	// dropped by rest but stay in the trie
+	start int
+	count int
+	shift uint
+	root  *vectorNode
+	tail  []Object
+}
+
+type vectorNode struct {
+	children []*vectorNode
+	values   []Object
+}
+
+func newVector(elements []Object) vector {
+	v := vector{}
+	for _, e := range elements {
+		v = v.push(e)
+	}
+	return v
+}
+
+func (v vector) len() int {
+	return v.count - v.start
+}
+
+func (v vector) get(i int) Object {
+	i += v.start
+	return v.leaf(i)[i&vectorMask]
+}
+
+// leaf returns the leaf holding the element at index i of the trie.
+func (v vector) leaf(i int) []Object {
+	if i >= v.tailOffset() {
+		return v.tail
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= vectorBits {
+		node = node.children[(i>>level)&vectorMask]
+	}
+	return node.values
+}
+
+// tailOffset is the index of the first element in the tail.
+func (v vector) tailOffset() int {
+	if v.count < vectorWidth {
+		return 0
+	}
+	return ((v.count - 1) >> vectorBits) << vectorBits
+}
+
+func (v vector) elements() []Object {
+	elements := make([]Object, 0, v.len())
+	for i := v.start; i < v.count; {
+		leaf := v.leaf(i)
+		elements = append(elements, leaf[i&vectorMask:]...)
+		i += len(leaf) - i&vectorMask
+	}
+	return elements
+}
+
+func (v vector) push(obj Object) vector {
+	if v.count-v.tailOffset() < vectorWidth {
+		v.tail = append(v.tail[:len(v.tail):len(v.tail)], obj)
+		v.count++
+		return v
+	}
+
+	tail := &vectorNode{values: v.tail}
+	switch {
+	case v.root == nil:
+		v.root = &vectorNode{children: []*vectorNode{tail}}
+		v.shift = vectorBits
+	case v.count>>vectorBits > 1<<v.shift:
+		// the trie is full, it gets a new level
+		v.root = &vectorNode{children: []*vectorNode{v.root, newVectorPath(v.shift, tail)}}
+		v.shift += vectorBits
+	default:
+		v.root = v.pushTail(v.shift, v.root, tail)
+	}
+	v.tail = []Object{obj}
+	v.count++
+	return v
+}
+
+func (v vector) pushTail(level uint, parent *vectorNode, tail *vectorNode) *vectorNode {
+	i := ((v.count - 1) >> level) & vectorMask
+	node := &vectorNode{children: append([]*vectorNode{}, parent.children...)}
+
+	child := tail
+	if level > vectorBits {
+		if i < len(parent.children) {
+			child = v.pushTail(level-vectorBits, parent.children[i], tail)
+		} else {
+			child = newVectorPath(level-vectorBits, tail)
+		}
+	}
+
+	if i < len(node.children) {
+		node.children[i] = child
+	} else {
+		node.children = append(node.children, child)
+	}
+	return node
+}
+
+func newVectorPath(level uint, node *vectorNode) *vectorNode {
+	if level == 0 {
+		return node
+	}
+	return &vectorNode{children: []*vectorNode{newVectorPath(level-vectorBits, node)}}
+}
+
+// pop returns v without its last element. v must not be empty.
+func (v vector) pop() vector {
+	if v.len() == 1 {
+		return vector{}
+	}
+	if len(v.tail) > 1 {
+		v.tail = v.tail[: len(v.tail)-1 : len(v.tail)-1]
+		v.count--
+		return v
+	}
+
+	v.tail = v.leaf(v.count - 2)
+	v.root = v.popTail(v.shift, v.root)
+	v.count--
+	if v.root != nil && v.shift > vectorBits && len(v.root.children) == 1 {
+		v.root = v.root.children[0]
+		v.shift -= vectorBits
+	}
+	return v
+}
+
+// popTail returns node without its last leaf, nil if that leaves it empty.
+func (v vector) popTail(level uint, node *vectorNode) *vectorNode {
+	i := ((v.count - 2) >> level) & vectorMask
+	if level > vectorBits {
+		child := v.popTail(level-vectorBits, node.children[i])
+		if child == nil && i == 0 {
+			return nil
+		}
+		children := append([]*vectorNode{}, node.children[:i]...)
+		if child != nil {
+			children = append(children, child)
+		}
+		return &vectorNode{children: children}
+	}
+	if i == 0 {
+		return nil
+	}
+	return &vectorNode{children: append([]*vectorNode{}, node.children[:i]...)}
+}
+
+// rest returns v without its first element. v must not be empty.
+func (v vector) rest() vector {
+	if v.len() == 1 {
+		return vector{}
+	}
+	v.start++
+	return v
+}
@@ -0,0 +1,86 @@
+package object
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestVector(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	v := vector{}
+	model := []Object{}
+	// older versions have to keep their elements
+	versions := []vector{}
+	models := [][]Object{}
+
+	for step := 0; step < 20000; step++ {
+		switch op := rnd.Intn(10); {
+		case op < 6 || len(model) == 0:
+			obj := &Integer{Value: int64(step)}
+			v = v.push(obj)
+			model = append(model[:len(model):len(model)], obj)
+		case op < 8:
+			v = v.pop()
+			model = model[: len(model)-1 : len(model)-1]
+		default:
+			v = v.rest()
+			model = model[1:len(model):len(model)]
+		}
+
+		if step%97 == 0 {
+			versions = append(versions, v)
+			models = append(models, model)
+		}
+	}
+
+	for i, v := range append(versions, v) {
+		model := model
+		if i < len(models) {
+			model = models[i]
+		}
+		testVector(t, v, model)
+	}
+}
+
+func TestVectorSizes(t *testing.T) {
+	for _, size := range []int{0, 1, 31, 32, 33, 64, 1024, 1056, 32*32*32 + 1} {
+		model := make([]Object, size)
+		for i := range model {
+			model[i] = &Integer{Value: int64(i)}
+		}
+		v := newVector(model)
+		testVector(t, v, model)
+
+		// popping everything shrinks the trie level by level
+		for len(model) > 0 {
+			v = v.pop()
+			model = model[:len(model)-1]
+			if len(model)%32 == 0 {
+				testVector(t, v, model)
+			}
+		}
+	}
+}
+
+func testVector(t *testing.T, v vector, model []Object) {
+	t.Helper()
+
+	if v.len() != len(model) {
+		t.Fatalf("vector has wrong length. want=%d, got=%d", len(model), v.len())
+	}
+	for i, obj := range model {
+		if v.get(i) != obj {
+			t.Fatalf("wrong element %d. want=%s, got=%s", i, obj.Inspect(), v.get(i).Inspect())
+		}
+	}
+	elements := v.elements()
+	if len(elements) != len(model) {
+		t.Fatalf("elements has wrong length. want=%d, got=%d", len(model), len(elements))
+	}
+	for i, obj := range model {
+		if elements[i] != obj {
+			t.Fatalf("wrong element %d in elements. want=%s, got=%s", i, obj.Inspect(), elements[i].Inspect())
+		}
+	}
+}
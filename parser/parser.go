@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
@@ -25,6 +26,8 @@ var precedences = map[token.TokenType]int{
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.IN:       LESSGREATER,
+	token.IS:       EQUALS,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
@@ -33,6 +36,15 @@ var precedences = map[token.TokenType]int{
 	token.LBRACKET: INDEX,
 }
 
+// Precedence returns how strongly an infix operator token binds, LOWEST for
+// anything that isn't one.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 type Parser struct {
 	l      *lexer.Lexer
 	errors []string
@@ -66,6 +78,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.BYTES, p.parseBytesLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
@@ -76,6 +89,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.SET_LBRACE, p.parseSetLiteral)
 	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -87,6 +101,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
+	p.registerInfix(token.IS, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
@@ -100,10 +116,20 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.curToken
 
 	return array
 }
 
+func (p *Parser) parseSetLiteral() ast.Expression {
+	set := &ast.SetLiteral{Token: p.curToken}
+
+	set.Elements = p.parseExpressionList(token.RBRACE)
+	set.Rbrace = p.curToken
+
+	return set
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken, Data: []ast.HashPair{}}
 
@@ -134,6 +160,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	}
 
 	p.nextToken()
+	hash.Rbrace = p.curToken
 
 	return hash
 }
@@ -167,14 +194,22 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
-	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+	if err == nil {
+		lit.Value = value
+		return lit
 	}
 
-	lit.Value = value
-	return lit
+	if n, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+		return &ast.BigIntegerLiteral{Token: p.curToken, Value: n}
+	}
+
+	msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
+	p.errors = append(p.errors, msg)
+	return nil
+}
+
+func (p *Parser) parseBytesLiteral() ast.Expression {
+	return &ast.BytesLiteral{Token: p.curToken, Value: []byte(p.curToken.Literal)}
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
@@ -384,6 +419,13 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.USE:
+		return p.parseUseStatement()
+	case token.FUNCTION:
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -417,6 +459,34 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	stmt := &ast.FunctionStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	fn := &ast.FunctionLiteral{Token: stmt.Token, Name: stmt.Name.Value}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	fn.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	fn.Body = p.parseBlockStatement()
+	stmt.Function = fn
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -431,6 +501,22 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseUseStatement() *ast.UseStatement {
+	stmt := &ast.UseStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -457,6 +543,8 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	block.Rbrace = p.curToken
+
 	return block
 }
 
@@ -171,6 +171,35 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775808", "9223372036854775808"},
+		{"123456789012345678901234567890", "123456789012345678901234567890"},
+		{"18446744073709551616", "18446744073709551616"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.BigIntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.BigIntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value.String() != tt.expected {
+			t.Errorf("literal.Value not %s. got=%s", tt.expected, literal.Value)
+		}
+		if literal.TokenLiteral() != tt.input {
+			t.Errorf("literal.TokenLiteral not %s. got=%s", tt.input, literal.TokenLiteral())
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -448,6 +477,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"3 > 5 == false",
 			"((3 > 5) == false)",
 		},
+		{
+			"a + 1 in s == true",
+			"(((a + 1) in s) == true)",
+		},
+		{
+			"a is b == c is d",
+			"(((a is b) == c) is d)",
+		},
 		{
 			"3 < 5 == true",
 			"((3 < 5) == true)",
@@ -818,6 +855,28 @@ func TestParsingArrayLiterals(t *testing.T) {
 	testInfixExpression(t, array.Elements[2], 3, "+", 3)
 }
 
+func TestParsingSetLiterals(t *testing.T) {
+	input := "#{1, 2 * 2, 3 + 3}"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	set, ok := stmt.Expression.(*ast.SetLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.SetLiteral. got=%T", stmt.Expression)
+	}
+	if len(set.Elements) != 3 {
+		t.Fatalf("len(set.Elements) not 3. got=%d", len(set.Elements))
+	}
+	testIntegerLiteral(t, set.Elements[0], 1)
+	testInfixExpression(t, set.Elements[1], 2, "*", 2)
+	testInfixExpression(t, set.Elements[2], 3, "+", 3)
+	if set.String() != "#{1, (2 * 2), (3 + 3)}" {
+		t.Errorf("set.String() wrong. got=%q", set.String())
+	}
+}
+
 func TestParsingIndexExpressions(t *testing.T) {
 	input := "myArray[1 + 1]"
 	l := lexer.New(input)
@@ -953,3 +1012,60 @@ func TestFunctionLiteralWithName(t *testing.T) {
 			function.Name)
 	}
 }
+
+func TestFunctionStatementParsing(t *testing.T) {
+	input := `fn add(x, y) { x + y; }`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T",
+			program.Statements[0])
+	}
+	if stmt.Name.Value != "add" {
+		t.Fatalf("function statement name wrong. want 'add', got=%q", stmt.Name.Value)
+	}
+	if stmt.Function.Name != "add" {
+		t.Fatalf("function literal name wrong. want 'add', got=%q", stmt.Function.Name)
+	}
+	if len(stmt.Function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n",
+			len(stmt.Function.Parameters))
+	}
+	testLiteralExpression(t, stmt.Function.Parameters[0], "x")
+	testLiteralExpression(t, stmt.Function.Parameters[1], "y")
+}
+
+func TestUseStatementParsing(t *testing.T) {
+	input := `use "macros.monkey"; use "lib/more.mky"`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
+			2, len(program.Statements))
+	}
+	for i, path := range []string{"macros.monkey", "lib/more.mky"} {
+		stmt, ok := program.Statements[i].(*ast.UseStatement)
+		if !ok {
+			t.Fatalf("program.Statements[%d] is not ast.UseStatement. got=%T",
+				i, program.Statements[i])
+		}
+		if stmt.Path.Value != path {
+			t.Fatalf("use statement path wrong. want %q, got=%q", path, stmt.Path.Value)
+		}
+	}
+
+	p = New(lexer.New(`use macros`))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected an error for a use statement without a string")
+	}
+}
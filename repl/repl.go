@@ -73,11 +73,21 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		evaluator.DefineMacros(program, macroEnv)
-		expanded := evaluator.ExpandMacros(program, macroEnv)
+		// libraries are read again on every line, so changes to them show
+		expander := &evaluator.Expander{Env: macroEnv}
+		program, err := expander.Define(program)
+		if err != nil {
+			fmt.Fprintf(out, "Woops! Macro expansion failed:\n %s\n", err)
+			continue
+		}
+		expanded, err := expander.Expand(program)
+		if err != nil {
+			fmt.Fprintf(out, "Woops! Macro expansion failed:\n %s\n", err)
+			continue
+		}
 
 		comp.Reset()
-		err := comp.Compile(expanded)
+		err = comp.Compile(expanded)
 		if err != nil {
 			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
 			continue
@@ -92,7 +102,7 @@ func Start(in io.Reader, out io.Writer) {
 		stackTop := machine.LastPoppedStackElem()
 
 		if stackTop != nil {
-			io.WriteString(out, stackTop.Inspect())
+			io.WriteString(out, object.PrettyInspector.Inspect(stackTop))
 			io.WriteString(out, "\n")
 		}
 
@@ -1,9 +1,13 @@
 package serializer
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"monkey/compiler"
 	"monkey/lexer"
+	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -38,3 +42,184 @@ func TestSerialzeAndLoad(t *testing.T) {
 		t.Fatalf("Instructions don't match, got=%s, expected=%s", actual, expected)
 	}
 }
+
+func TestSerializeAndLoadMacros(t *testing.T) {
+	bytecode := &compiler.Bytecode{
+		Macros: `let unless = macro(c, a) { quote(if (!(unquote(c))) { unquote(a) }) };`,
+	}
+
+	s := New()
+	s.Write(bytecode)
+
+	loaded, err := NewLoader(s.Output).Load()
+	if err != nil {
+		t.Fatalf("Loader had an error: %s", err.Error())
+	}
+	if loaded.Macros != bytecode.Macros {
+		t.Fatalf("Macros don't match, got=%q, expected=%q", loaded.Macros, bytecode.Macros)
+	}
+
+	// files written before macros were stored end after the instructions
+	old := s.Output[:len(s.Output)-2-4-len(bytecode.Macros)]
+	hash := sha256.Sum256(old[HEADER_LEN+sha256.Size:])
+	copy(old[HEADER_LEN:], hash[:])
+
+	loaded, err = NewLoader(old).Load()
+	if err != nil {
+		t.Fatalf("Loader had an error on a file without macros: %s", err.Error())
+	}
+	if loaded.Macros != "" {
+		t.Fatalf("Expected no macros, got=%q", loaded.Macros)
+	}
+}
+
+func TestSerializeAndLoadBuiltins(t *testing.T) {
+	rt := object.NewRuntime()
+	rt.Register("shout", strings.ToUpper)
+	rt.Register("whisper", strings.ToLower)
+
+	c := compiler.NewWithRuntime(rt)
+	c.Compile(parser.New(lexer.New(`whisper("A")`)).ParseProgram())
+	if got := strings.Join(c.Bytecode().Builtins, ","); got != ",whisper" {
+		t.Fatalf("wrong builtins recorded. got=%q, expected=%q", got, ",whisper")
+	}
+
+	s := New()
+	s.Write(c.Bytecode())
+
+	l := NewLoader(s.Output)
+	l.SetRuntime(rt)
+	if _, err := l.Load(); err != nil {
+		t.Fatalf("Loader had an error: %s", err.Error())
+	}
+
+	other := object.NewRuntime()
+	other.Register("whisper", strings.ToLower)
+	other.Register("shout", strings.ToUpper)
+	tests := []struct {
+		rt       *object.Runtime
+		expected string
+	}{
+		{object.DefaultRuntime, "Can't run the code with this runtime: builtin whisper isn't registered"},
+		{other, fmt.Sprintf("Can't run the code with this runtime: builtin whisper isn't registered at index %d, shout is", len(object.Builtins)+1)},
+	}
+	for _, tt := range tests {
+		l := NewLoader(s.Output)
+		l.SetRuntime(tt.rt)
+		_, err := l.Load()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+
+	// files written before builtins were stored end after the macros
+	old := s.Output[:len(s.Output)-2-4-4-len("whisper")]
+	hash := sha256.Sum256(old[HEADER_LEN+sha256.Size:])
+	copy(old[HEADER_LEN:], hash[:])
+	if loaded, err := NewLoader(old).Load(); err != nil || loaded.Builtins != nil {
+		t.Fatalf("Loader didn't read a file without builtins. got=%v, %v", loaded, err)
+	}
+}
+
+func TestSerializeAndLoadAllBuiltins(t *testing.T) {
+	rt := object.NewRuntime()
+	var names []string
+	for i := len(object.Builtins); i < object.MaxBuiltins; i++ {
+		// identifiers can't have digits
+		name := fmt.Sprintf("b%c%c", 'a'+i/26, 'a'+i%26)
+		if err := rt.Register(name, strings.ToUpper); err != nil {
+			t.Fatalf("Register had an error: %s", err)
+		}
+		names = append(names, name)
+	}
+
+	c := compiler.NewWithRuntime(rt)
+	c.Compile(parser.New(lexer.New("[" + strings.Join(names, ", ") + "]")).ParseProgram())
+
+	s := New()
+	if err := s.Write(c.Bytecode()); err != nil {
+		t.Fatalf("Serializer had an error: %s", err)
+	}
+
+	l := NewLoader(s.Output)
+	l.SetRuntime(rt)
+	loaded, err := l.Load()
+	if err != nil {
+		t.Fatalf("Loader had an error: %s", err)
+	}
+	if got, want := strings.Join(loaded.Builtins, ","), strings.Join(names, ","); got != want {
+		t.Fatalf("wrong builtins loaded. got=%q, expected=%q", got, want)
+	}
+}
+
+func TestSerializeAndLoadBigIntegers(t *testing.T) {
+	input := `[123456789012345678901234567890, -98765432109876543210, 9223372036854775808]`
+
+	c := compiler.New()
+	c.Compile(parser.New(lexer.New(input)).ParseProgram())
+
+	s := New()
+	if err := s.Write(c.Bytecode()); err != nil {
+		t.Fatalf("Serializer had an error: %s", err.Error())
+	}
+
+	bytecode, err := NewLoader(s.Output).Load()
+	if err != nil {
+		t.Fatalf("Loader had an error: %s", err.Error())
+	}
+
+	if len(bytecode.Constants) != len(c.Bytecode().Constants) {
+		t.Fatalf("wrong number of constants. got=%d, expected=%d", len(bytecode.Constants), len(c.Bytecode().Constants))
+	}
+	for i, expected := range c.Bytecode().Constants {
+		if bytecode.Constants[i].Type() != object.BIGINT_OBJ || bytecode.Constants[i].Inspect() != expected.Inspect() {
+			t.Errorf("constant %d doesn't match, got=%s, expected=%s", i, bytecode.Constants[i].Inspect(), expected.Inspect())
+		}
+	}
+}
+
+func TestSerializeAndLoadBytes(t *testing.T) {
+	input := `[b"", b"\x00\x01\xff", b"monkey"]`
+
+	c := compiler.New()
+	c.Compile(parser.New(lexer.New(input)).ParseProgram())
+
+	s := New()
+	if err := s.Write(c.Bytecode()); err != nil {
+		t.Fatalf("Serializer had an error: %s", err.Error())
+	}
+
+	bytecode, err := NewLoader(s.Output).Load()
+	if err != nil {
+		t.Fatalf("Loader had an error: %s", err.Error())
+	}
+
+	for i, expected := range c.Bytecode().Constants {
+		if bytecode.Constants[i].Type() != object.BYTES_OBJ || bytecode.Constants[i].Inspect() != expected.Inspect() {
+			t.Errorf("constant %d doesn't match, got=%s, expected=%s", i, bytecode.Constants[i].Inspect(), expected.Inspect())
+		}
+	}
+}
+
+func TestSerializeAndLoadQuotes(t *testing.T) {
+	input := `let x = 2; quote(f(unquote(x), [y, "z"]))`
+
+	c := compiler.New()
+	c.Compile(parser.New(lexer.New(input)).ParseProgram())
+
+	s := New()
+	if err := s.Write(c.Bytecode()); err != nil {
+		t.Fatalf("Serializer had an error: %s", err.Error())
+	}
+
+	bytecode, err := NewLoader(s.Output).Load()
+	if err != nil {
+		t.Fatalf("Loader had an error: %s", err.Error())
+	}
+
+	for i, expected := range c.Bytecode().Constants {
+		if bytecode.Constants[i].Inspect() != expected.Inspect() {
+			t.Errorf("constant %d doesn't match, got=%s, expected=%s", i, bytecode.Constants[i].Inspect(), expected.Inspect())
+		}
+	}
+}
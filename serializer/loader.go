@@ -4,6 +4,8 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"math/big"
+	"monkey/ast"
 	"monkey/compiler"
 	"monkey/object"
 )
@@ -14,6 +16,7 @@ type Loader struct {
 	pos       int
 	constants []object.Object
 	used      bool
+	runtime   *object.Runtime
 }
 
 func NewLoader(buf []byte) *Loader {
@@ -23,9 +26,17 @@ func NewLoader(buf []byte) *Loader {
 		pos:       0,
 		constants: make([]object.Object, 255),
 		used:      false,
+		runtime:   object.DefaultRuntime,
 	}
 }
 
+// SetRuntime sets the runtime the loaded code will run with. Load fails if
+// it lacks builtins the code was compiled with. With a nil runtime, for
+// code that isn't run, the builtins aren't checked.
+func (l *Loader) SetRuntime(rt *object.Runtime) {
+	l.runtime = rt
+}
+
 func (l *Loader) Load() (*compiler.Bytecode, error) {
 	if l.used {
 		return nil, fmt.Errorf("This loader has already been used, create a new one")
@@ -50,15 +61,88 @@ func (l *Loader) Load() (*compiler.Bytecode, error) {
 	instrLen := binary.BigEndian.Uint32(l.input[l.pos : l.pos+4])
 	l.pos += 4
 
+	if l.pos+int(instrLen) > l.len {
+		return nil, fmt.Errorf("Can't read instructions. Not %d bytes left in buffer", instrLen)
+	}
 	instr := make([]byte, instrLen)
 	copy(instr, l.input[l.pos:l.pos+int(instrLen)])
+	l.pos += int(instrLen)
+
+	macros, err := l.readMacros()
+	if err != nil {
+		return nil, err
+	}
+
+	builtins, err := l.readBuiltins()
+	if err != nil {
+		return nil, err
+	}
+	if l.runtime != nil {
+		if err := l.runtime.Check(builtins); err != nil {
+			return nil, fmt.Errorf("Can't run the code with this runtime: %s", err)
+		}
+	}
 
 	return &compiler.Bytecode{
 		Constants:    l.constants[:amConsts],
 		Instructions: instr,
+		Macros:       macros,
+		Builtins:     builtins,
 	}, nil
 }
 
+// readMacros reads the source of the exported macros. Files written before
+// macros were stored end after the instructions.
+func (l *Loader) readMacros() (string, error) {
+	if l.pos == l.len {
+		return "", nil
+	}
+	if l.pos+4 > l.len {
+		return "", fmt.Errorf("Can't read macros size, not enough data in buffer")
+	}
+
+	size := binary.BigEndian.Uint32(l.input[l.pos:])
+	l.pos += 4
+
+	if l.pos+int(size) > l.len {
+		return "", fmt.Errorf("Can't read macros. Not %d bytes left in buffer", size)
+	}
+	macros := string(l.input[l.pos : l.pos+int(size)])
+	l.pos += int(size)
+
+	return macros, nil
+}
+
+// readBuiltins reads the names of the registered builtins the code uses.
+// Files written before they were stored end after the macros.
+func (l *Loader) readBuiltins() ([]string, error) {
+	if l.pos == l.len {
+		return nil, nil
+	}
+	if l.pos+2 > l.len {
+		return nil, fmt.Errorf("Can't read number of builtins, not enough data in buffer")
+	}
+	count := int(binary.BigEndian.Uint16(l.input[l.pos:]))
+	l.pos += 2
+
+	var names []string
+	for i := 0; i < count; i++ {
+		if l.pos+4 > l.len {
+			return nil, fmt.Errorf("Can't read builtin name size, not enough data in buffer")
+		}
+		size := binary.BigEndian.Uint32(l.input[l.pos:])
+		l.pos += 4
+
+		if l.pos+int(size) > l.len {
+			return nil, fmt.Errorf("Can't read builtin name. Not %d bytes left in buffer", size)
+		}
+		names = append(names, string(l.input[l.pos:l.pos+int(size)]))
+		l.pos += int(size)
+	}
+
+	return names, nil
+}
+
 func (l *Loader) readConstant() (object.Object, error) {
 	if l.pos >= l.len {
 		return nil, fmt.Errorf("Can't read type byte, no more data in buffer")
@@ -76,6 +160,15 @@ func (l *Loader) readConstant() (object.Object, error) {
 	case COMPILED_FUNCTION:
 		return l.readFunction()
 
+	case QUOTE:
+		return l.readQuote()
+
+	case BIGINT:
+		return l.readBigInt()
+
+	case BYTES:
+		return l.readBytes()
+
 	default:
 		return nil, fmt.Errorf("Can't load constant type value %d.", cType)
 	}
@@ -103,6 +196,43 @@ func (l *Loader) readInteger() (*object.Integer, error) {
 	return &object.Integer{Value: int64(val)}, nil
 }
 
+func (l *Loader) readBigInt() (*object.BigInt, error) {
+	if l.pos+5 > l.len {
+		return nil, fmt.Errorf("not enough data in buffer to read BIGINT header")
+	}
+	negative := l.input[l.pos] == 1
+	size := binary.BigEndian.Uint32(l.input[l.pos+1:])
+	l.pos += 5
+
+	if l.pos+int(size) > l.len {
+		return nil, fmt.Errorf("Can't read BIGINT. Not %d bytes left in buffer", size)
+	}
+	val := new(big.Int).SetBytes(l.input[l.pos : l.pos+int(size)])
+	if negative {
+		val.Neg(val)
+	}
+	l.pos += int(size)
+
+	return &object.BigInt{Value: val}, nil
+}
+
+func (l *Loader) readBytes() (*object.Bytes, error) {
+	if l.pos+4 > l.len {
+		return nil, fmt.Errorf("Can't read bytes size, not enough data in buffer")
+	}
+	size := binary.BigEndian.Uint32(l.input[l.pos:])
+	l.pos += 4
+
+	if l.pos+int(size) > l.len {
+		return nil, fmt.Errorf("Can't read bytes. Not %d bytes left in buffer", size)
+	}
+	value := make([]byte, size)
+	copy(value, l.input[l.pos:l.pos+int(size)])
+	l.pos += int(size)
+
+	return &object.Bytes{Value: value}, nil
+}
+
 func (l *Loader) readFunction() (*object.CompiledFunction, error) {
 	if l.pos+6 > l.len {
 		return nil, fmt.Errorf("Can't read function header, not enough data in buffer")
@@ -128,6 +258,25 @@ func (l *Loader) readFunction() (*object.CompiledFunction, error) {
 	return cf, nil
 }
 
+func (l *Loader) readQuote() (*object.Quote, error) {
+	if l.pos+4 > l.len {
+		return nil, fmt.Errorf("Can't read quote size, not enough data in buffer")
+	}
+	size := binary.BigEndian.Uint32(l.input[l.pos:])
+	l.pos += 4
+
+	if l.pos+int(size) > l.len {
+		return nil, fmt.Errorf("Can't read quote. Not %d bytes left in buffer", size)
+	}
+	node, err := ast.FromJSON(l.input[l.pos : l.pos+int(size)])
+	if err != nil {
+		return nil, fmt.Errorf("Can't read quote: %s", err)
+	}
+	l.pos += int(size)
+
+	return &object.Quote{Node: node}, nil
+}
+
 func (l *Loader) checkHeader() error {
 	for i, b := range HEADER {
 		if l.input[l.pos+i] != b {
@@ -4,6 +4,8 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"math"
+	"monkey/ast"
 	"monkey/compiler"
 	"monkey/object"
 )
@@ -17,6 +19,9 @@ const (
 	NULL
 	STRING
 	COMPILED_FUNCTION
+	QUOTE
+	BIGINT
+	BYTES
 
 	InitialBufferSize = 10240
 
@@ -56,6 +61,21 @@ func (s *Serializer) Write(code *compiler.Bytecode) error {
 	s.Output = binary.BigEndian.AppendUint32(s.Output, uint32(len(code.Instructions)))
 	s.Output = append(s.Output, code.Instructions...)
 
+	// Format: MACROS_SIZE(4) MACROS(SIZE), missing in older files
+	s.Output = binary.BigEndian.AppendUint32(s.Output, uint32(len(code.Macros)))
+	s.Output = append(s.Output, code.Macros...)
+
+	// Format: BUILTINS(2) ..NAME_SIZE(4) NAME(SIZE), missing in older files
+	amBuiltins := len(code.Builtins)
+	if amBuiltins > math.MaxUint16 {
+		return fmt.Errorf("Too many builtins (%d), can only serialize %d tops!", amBuiltins, math.MaxUint16)
+	}
+	s.Output = binary.BigEndian.AppendUint16(s.Output, uint16(amBuiltins))
+	for _, name := range code.Builtins {
+		s.Output = binary.BigEndian.AppendUint32(s.Output, uint32(len(name)))
+		s.Output = append(s.Output, name...)
+	}
+
 	hash := sha256.Sum256(s.Output[HEADER_LEN+sha256.Size : len(s.Output)])
 	copy(s.Output[HEADER_LEN:HEADER_LEN+sha256.Size], hash[:])
 
@@ -67,9 +87,9 @@ func (s *Serializer) writeObj(obj object.Object) error {
 	case *object.Array:
 		// Format: ARRAY(1) SIZE(4) ..Elements
 		s.Output = append(s.Output, ARRAY)
-		size := uint32(len(obj.Elements))
+		size := uint32(obj.Len())
 		s.Output = binary.BigEndian.AppendUint32(s.Output, size)
-		for _, el := range obj.Elements {
+		for _, el := range obj.Elements() {
 			err := s.writeObj(el)
 			if err != nil {
 				return err
@@ -83,6 +103,19 @@ func (s *Serializer) writeObj(obj object.Object) error {
 		s.Output = binary.BigEndian.AppendUint64(s.Output, uint64(obj.Value))
 		return nil
 
+	case *object.BigInt:
+		// Format: BIGINT(1) SIGN(1) SIZE(4) MAGNITUDE(SIZE), big-endian
+		s.Output = append(s.Output, BIGINT)
+		if obj.Value.Sign() < 0 {
+			s.Output = append(s.Output, 1)
+		} else {
+			s.Output = append(s.Output, 0)
+		}
+		magnitude := obj.Value.Bytes()
+		s.Output = binary.BigEndian.AppendUint32(s.Output, uint32(len(magnitude)))
+		s.Output = append(s.Output, magnitude...)
+		return nil
+
 	case *object.String:
 		// Format: STRING(1) CHARS(*) ZERO_BYTE(1)
 		s.Output = append(s.Output, STRING)
@@ -90,6 +123,13 @@ func (s *Serializer) writeObj(obj object.Object) error {
 		s.Output = append(s.Output, 0)
 		return nil
 
+	case *object.Bytes:
+		// Format: BYTES(1) SIZE(4) DATA(SIZE)
+		s.Output = append(s.Output, BYTES)
+		s.Output = binary.BigEndian.AppendUint32(s.Output, uint32(len(obj.Value)))
+		s.Output = append(s.Output, obj.Value...)
+		return nil
+
 	case *object.Boolean:
 		// Format: BOOL_TRUE(1) | BOOL_FALSE(1)
 		if obj.Value {
@@ -113,6 +153,17 @@ func (s *Serializer) writeObj(obj object.Object) error {
 		s.Output = append(s.Output, obj.Instructions...)
 		return nil
 
+	case *object.Quote:
+		// Format: QUOTE(1) SIZE(4) AST_JSON(SIZE)
+		data, err := ast.ToJSON(obj.Node)
+		if err != nil {
+			return err
+		}
+		s.Output = append(s.Output, QUOTE)
+		s.Output = binary.BigEndian.AppendUint32(s.Output, uint32(len(data)))
+		s.Output = append(s.Output, data...)
+		return nil
+
 	default:
 		return fmt.Errorf("Object of type [%T] can't be serialized", obj)
 	}
@@ -19,11 +19,11 @@ func TestSerializingArray(t *testing.T) {
 		expected []byte
 	}{
 		{
-			input:    &object.Array{Elements: []object.Object{}},
+			input:    object.NewArray([]object.Object{}),
 			expected: []byte{1, 0, 0, 0, 0},
 		},
 		{
-			input: &object.Array{Elements: []object.Object{
+			input: object.NewArray([]object.Object{
 				&object.Integer{Value: 69420},
 				&object.Boolean{Value: true},
 				&object.Boolean{Value: false},
@@ -34,7 +34,7 @@ func TestSerializingArray(t *testing.T) {
 					NumLocals:     42,
 					NumParameters: 69,
 				},
-			}},
+			}),
 			expected: flatten([][]byte{{1, 0, 0, 0, 6},
 				binary.BigEndian.AppendUint64([]byte{2}, 69420),
 				{3},
@@ -81,10 +81,17 @@ func TestSerializingProgram(t *testing.T) {
 	s := New()
 	s.Write(c.Bytecode())
 
-	// The last bytes of the output should be the instructions
+	// The instructions should be followed only by the size of the (empty)
+	// macros and the number of (no) registered builtins
 	amInstr := len(c.Bytecode().Instructions)
-	instrStart := len(s.Output) - amInstr
-	testInstr(t, c.Bytecode().Instructions, s.Output[instrStart:])
+	instrStart := len(s.Output) - amInstr - 4 - 2
+	testInstr(t, c.Bytecode().Instructions, s.Output[instrStart:instrStart+amInstr])
+	if macrosLen := binary.BigEndian.Uint32(s.Output[instrStart+amInstr:]); macrosLen != 0 {
+		t.Fatalf("Length of macros not rendered right. got=%d, expected=0", macrosLen)
+	}
+	if amBuiltins := binary.BigEndian.Uint16(s.Output[len(s.Output)-2:]); amBuiltins != 0 {
+		t.Fatalf("Number of builtins not rendered right. got=%d, expected=0", amBuiltins)
+	}
 
 	checkLen := binary.BigEndian.Uint32(s.Output[instrStart-4:])
 	if int(checkLen) != len(c.Bytecode().Instructions) {
@@ -5,6 +5,8 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int
+	Column  int
 }
 
 const (
@@ -15,6 +17,9 @@ const (
 	IDENT  = "IDENT" // add, foo, bar, x, y...
 	INT    = "INT"   // 1231241
 	STRING = "STRING"
+	BYTES  = "BYTES" // b"\x00\xff"
+
+	COMMENT = "COMMENT" // only collected by the lexer, never returned
 
 	// Operators
 	ASSIGN   = "="
@@ -35,12 +40,14 @@ const (
 	SEMICOLON = ";"
 	COLON     = ":"
 
-	LPAREN   = "("
-	RPAREN   = ")"
-	LBRACE   = "{"
-	RBRACE   = "}"
-	LBRACKET = "["
-	RBRACKET = "]"
+	LPAREN = "("
+	RPAREN = ")"
+	LBRACE = "{"
+	// SET_LBRACE opens a set literal
+	SET_LBRACE = "#{"
+	RBRACE     = "}"
+	LBRACKET   = "["
+	RBRACKET   = "]"
 
 	// Keywords
 	FUNCTION = "FUNCTION"
@@ -51,6 +58,9 @@ const (
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
 	MACRO    = "MACRO"
+	USE      = "USE"
+	IN       = "IN"
+	IS       = "IS"
 )
 
 var keywords = map[string]TokenType{
@@ -62,6 +72,9 @@ var keywords = map[string]TokenType{
 	"true":   TRUE,
 	"false":  FALSE,
 	"macro":  MACRO,
+	"use":    USE,
+	"in":     IN,
+	"is":     IS,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -2,8 +2,12 @@ package vm
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"monkey/ast"
 	"monkey/code"
+	"monkey/compiler"
 	"monkey/object"
 )
 
@@ -13,9 +17,9 @@ const (
 	MaxFrames   = 1024 * 1024 / 16
 )
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
 
 type Frame struct {
 	cl          *object.Closure
@@ -40,6 +44,13 @@ type VM struct {
 	stack   []object.Object
 	globals []object.Object
 	sp      int // Will point to the next value. top of the stack is stack[sp-1]
+
+	limits  object.Limits
+	budget  *object.Budget
+	runtime *object.Runtime
+	// builtins are the builtins of runtime bound to vm, made when code
+	// first gets one.
+	builtins []*object.Builtin
 }
 
 func New(instructions code.Instructions, constants []object.Object) *VM {
@@ -57,6 +68,7 @@ func New(instructions code.Instructions, constants []object.Object) *VM {
 
 		frames:   frames,
 		frameIdx: 0,
+		runtime:  object.DefaultRuntime,
 	}
 }
 
@@ -95,9 +107,42 @@ func (vm *VM) LastPoppedStackElem() object.Object {
 	return vm.stack[vm.sp]
 }
 
+// SetRuntime sets the runtime builtins are looked up in, the one the code
+// was compiled with.
+func (vm *VM) SetRuntime(rt *object.Runtime) {
+	vm.runtime = rt
+	vm.builtins = nil
+}
+
+// SetLimits sets the limits for the following runs.
+func (vm *VM) SetLimits(limits object.Limits) {
+	vm.limits = limits
+}
+
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the program until it finishes, ctx is done or it exceeds
+// the limits of the VM. Exceeding a limit returns a *object.LimitError, a
+// cancelled run the error of ctx.
+func (vm *VM) RunContext(ctx context.Context) error {
+	budget, cancel := object.NewBudget(ctx, vm.limits)
+	defer cancel()
+
+	vm.budget = budget
+	defer func() { vm.budget = nil }()
+
+	return vm.run()
+}
+
+func (vm *VM) run() error {
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 
+		if err := vm.budget.Step(); err != nil {
+			return err
+		}
+
 		vm.currentFrame().ip++
 
 		lip := vm.currentFrame().ip
@@ -109,7 +154,7 @@ func (vm *VM) Run() error {
 		case code.OpConstant:
 			constIndex := code.ReadUint16(ins[lip+1:])
 			vm.currentFrame().ip += 2
-			err := vm.push(vm.constants[constIndex])
+			err := vm.push(vm.constant(int(constIndex)))
 			if err != nil {
 				return err
 			}
@@ -172,6 +217,23 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpIs:
+			right := vm.pop()
+			left := vm.pop()
+
+			err := vm.push(nativeBoolToBooleanObject(object.Identical(left, right)))
+			if err != nil {
+				return err
+			}
+
+		case code.OpBound:
+			nameIndex := code.ReadUint16(ins[lip+1:])
+			vm.currentFrame().ip += 2
+
+			if vm.stack[vm.sp-1] == nil {
+				return fmt.Errorf("identifier not found: %s", vm.constant(int(nameIndex)).Inspect())
+			}
+
 		case code.OpJump:
 			pos := int(code.ReadUint16(ins[lip+1:]))
 			vm.currentFrame().ip = pos - 1
@@ -190,8 +252,12 @@ func (vm *VM) Run() error {
 			amElems := int(code.ReadUint16(ins[lip+1:]))
 			vm.currentFrame().ip += 2
 
-			elements := vm.buildArrayFromStack(amElems)
-			err := vm.push(&object.Array{Elements: elements})
+			array := object.NewArray(vm.buildArrayFromStack(amElems))
+			if err := vm.budget.CheckSize(array); err != nil {
+				return err
+			}
+
+			err := vm.push(array)
 			if err != nil {
 				return err
 			}
@@ -204,12 +270,70 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+			if err := vm.budget.CheckSize(hash); err != nil {
+				return err
+			}
 
 			err = vm.push(hash)
 			if err != nil {
 				return err
 			}
 
+		case code.OpSet:
+			amElems := int(code.ReadUint16(ins[lip+1:]))
+			vm.currentFrame().ip += 2
+
+			set, err := vm.buildSetFromStack(amElems)
+			if err != nil {
+				return err
+			}
+			if err := vm.budget.CheckSize(set); err != nil {
+				return err
+			}
+
+			err = vm.push(set)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIn:
+			container := vm.pop()
+			elem := vm.pop()
+
+			found, err := object.Contains(container, elem)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(nativeBoolToBooleanObject(found))
+			if err != nil {
+				return err
+			}
+
+		case code.OpQuote:
+			constIndex := code.ReadUint16(ins[lip+1:])
+			numValues := int(code.ReadUint8(ins[lip+3:]))
+			vm.currentFrame().ip += 3
+
+			template, ok := vm.constant(int(constIndex)).(*object.Quote)
+			if !ok {
+				return fmt.Errorf("not a quote: %+v", vm.constant(int(constIndex)))
+			}
+
+			values := make([]object.Object, numValues)
+			copy(values, vm.stack[vm.sp-numValues:vm.sp])
+			vm.sp = vm.sp - numValues
+
+			unquoted, err := object.Unquote(template.Node, values)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(&object.Quote{Node: unquoted})
+			if err != nil {
+				return err
+			}
+
 		case code.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
@@ -228,6 +352,15 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[lip+1:]))
+			vm.currentFrame().ip += 1
+
+			err := vm.executeTailCall(numArgs)
+			if err != nil {
+				return err
+			}
+
 		case code.OpClosure:
 			constIndex := code.ReadUint16(ins[lip+1:])
 			numFree := code.ReadUint8(ins[lip+3:])
@@ -262,13 +395,23 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpPatchFree:
+			frame := vm.currentFrame()
+			localIndex := code.ReadUint8(ins[lip+1:])
+			freeIdx := code.ReadUint8(ins[lip+2:])
+			frame.ip += 2
+
+			cl, ok := vm.stack[frame.basePointer+int(localIndex)].(*object.Closure)
+			if !ok {
+				return fmt.Errorf("can't patch free variable of non-closure local %d", localIndex)
+			}
+			cl.Free[freeIdx] = vm.pop()
+
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUint8(ins[lip+1:])
 			vm.currentFrame().ip++
 
-			fn := object.Builtins[builtinIndex]
-
-			err := vm.push(fn.Builtin)
+			err := vm.push(vm.builtin(int(builtinIndex)))
 			if err != nil {
 				return err
 			}
@@ -286,6 +429,7 @@ func (vm *VM) Run() error {
 		case code.OpReturnValue:
 			retVal := vm.pop()
 
+			vm.budget.Leave()
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
@@ -295,6 +439,7 @@ func (vm *VM) Run() error {
 			}
 
 		case code.OpReturn:
+			vm.budget.Leave()
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
@@ -310,8 +455,17 @@ func (vm *VM) Run() error {
 	return nil
 }
 
+// constant returns constant i of the running function, from its own pool
+// if it was compiled on its own.
+func (vm *VM) constant(i int) object.Object {
+	if constants := vm.currentFrame().cl.Fn.Constants; constants != nil {
+		return constants[i]
+	}
+	return vm.constants[i]
+}
+
 func (vm *VM) pushClosure(constIndex int, amFree int) error {
-	constant := vm.constants[constIndex]
+	constant := vm.constant(constIndex)
 	fn, ok := constant.(*object.CompiledFunction)
 	if !ok {
 		return fmt.Errorf("not a function: %+v", constant)
@@ -342,25 +496,73 @@ func (vm *VM) executeCall(numArgs int) error {
 	}
 }
 
+// executeTailCall calls a closure by reusing the current frame, its result
+// goes straight back to the caller of the current function.
+func (vm *VM) executeTailCall(numArgs int) error {
+	cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok {
+		return vm.executeCall(numArgs)
+	}
+
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	frame := vm.currentFrame()
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+
+	frame.cl = cl
+	frame.ip = -1
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+
+	return nil
+}
+
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 	if numArgs != cl.Fn.NumParameters {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
 			cl.Fn.NumParameters, numArgs)
 	}
 
+	if vm.frameIdx+1 >= len(vm.frames) {
+		return fmt.Errorf("stack overflow: more than %d nested calls", MaxFrames)
+	}
+
+	if err := vm.budget.Enter(); err != nil {
+		return err
+	}
+
 	frame := NewFrame(cl, vm.sp-numArgs)
 	vm.pushFrame(frame)
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 
+	// Locals can be captured before they are bound, don't leak stale values.
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+
 	return nil
 }
 
 func (vm *VM) callBuiltin(fn *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
 
-	result := fn.Fn(args...)
+	result := fn.Call(vm.budget, args...)
 	vm.sp = vm.sp - numArgs - 1
 
+	if err := vm.budget.CheckSize(result); err != nil {
+		return err
+	}
+	// A builtin failing stops the program, like it does in the evaluator.
+	if errObj, ok := result.(*object.Error); ok {
+		return errors.New(errObj.Message)
+	}
+
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -376,12 +578,18 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 		return vm.executeArrayIndexExpression(left, index)
 	case *object.Hash:
 		return vm.executeHashIndexExpression(left, index)
+	case *object.Bytes:
+		return vm.executeBytesIndexExpression(left, index)
 	default:
 		return fmt.Errorf("index operator not supported: %s", left.Type())
 	}
 }
 
 func (vm *VM) executeArrayIndexExpression(left *object.Array, index object.Object) error {
+	if _, ok := index.(*object.BigInt); ok {
+		// big integers are out of range
+		return vm.push(Null)
+	}
 	idx, ok := index.(*object.Integer)
 	if !ok {
 		return fmt.Errorf("Arrays can only be indexed by Integers, got=%T", index)
@@ -389,15 +597,28 @@ func (vm *VM) executeArrayIndexExpression(left *object.Array, index object.Objec
 
 	idxVal := idx.Value
 
-	if idxVal < 0 || idxVal >= int64(len(left.Elements)) {
+	if idxVal < 0 || idxVal >= int64(left.Len()) {
 		return vm.push(Null)
 	}
 
-	return vm.push(left.Elements[idxVal])
+	return vm.push(left.At(int(idxVal)))
+}
+
+func (vm *VM) executeBytesIndexExpression(left *object.Bytes, index object.Object) error {
+	if !object.IsInteger(index) {
+		return fmt.Errorf("Bytes can only be indexed by Integers, got=%T", index)
+	}
+
+	idx, ok := index.(*object.Integer)
+	if !ok || idx.Value < 0 || idx.Value >= int64(len(left.Value)) {
+		return vm.push(Null)
+	}
+
+	return vm.push(&object.Integer{Value: int64(left.Value[idx.Value])})
 }
 
 func (vm *VM) executeHashIndexExpression(left *object.Hash, index object.Object) error {
-	idx, ok := index.(object.Hashable)
+	idx, ok := object.AsHashable(index)
 	if !ok {
 		return fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
@@ -413,9 +634,9 @@ func (vm *VM) buildHashFromStack(amElems int) (object.Object, error) {
 	hash := object.NewHash()
 
 	for i := vm.sp - amElems; i < vm.sp; i += 2 {
-		key, ok := vm.stack[i].(object.Hashable)
+		key, ok := object.AsHashable(vm.stack[i])
 		if !ok {
-			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			return nil, fmt.Errorf("unusable as hash key: %s", vm.stack[i].Type())
 		}
 
 		hash.Set(key, vm.stack[i+1])
@@ -426,6 +647,23 @@ func (vm *VM) buildHashFromStack(amElems int) (object.Object, error) {
 	return &hash, nil
 }
 
+func (vm *VM) buildSetFromStack(amElems int) (object.Object, error) {
+	set := object.NewSet()
+
+	for i := vm.sp - amElems; i < vm.sp; i++ {
+		elem, ok := object.AsHashable(vm.stack[i])
+		if !ok {
+			return nil, fmt.Errorf("unusable as set element: %s", vm.stack[i].Type())
+		}
+
+		set.Add(elem)
+	}
+
+	vm.sp -= amElems
+
+	return &set, nil
+}
+
 func (vm *VM) buildArrayFromStack(amElems int) []object.Object {
 	elements := make([]object.Object, amElems)
 	for i, o := range vm.stack[vm.sp-amElems : vm.sp] {
@@ -444,12 +682,11 @@ func isTruthy(obj object.Object) bool {
 func (vm *VM) executeMinusOperator() error {
 	right := vm.pop()
 
-	int, ok := right.(*object.Integer)
-	if !ok {
+	if !object.IsInteger(right) {
 		return fmt.Errorf("Minus operator only works on Integers, found %T", right)
 	}
 
-	return vm.push(&object.Integer{Value: -int.Value})
+	return vm.push(object.NegateInteger(right))
 }
 
 func (vm *VM) executeBangOperator() error {
@@ -466,16 +703,24 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
 
-	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
+	if object.IsInteger(left) && object.IsInteger(right) {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
+
+	if left.Type() == object.BYTES_OBJ && right.Type() == object.BYTES_OBJ {
+		return vm.executeBytesComparison(op, left, right)
+	}
+
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
 
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
 
 	default:
 		return fmt.Errorf("uknown operator: %d (%s %s)", op, left.Type(), right.Type())
@@ -483,20 +728,45 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 }
 
 func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	cmp := object.CompareIntegers(left, right)
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+		return vm.push(nativeBoolToBooleanObject(cmp == 0))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+		return vm.push(nativeBoolToBooleanObject(cmp != 0))
 	case code.OpGreaterThan:
-		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+		return vm.push(nativeBoolToBooleanObject(cmp > 0))
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
 }
 
+func (vm *VM) executeStringComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
+func (vm *VM) executeBytesComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Bytes).Value
+	rightValue := right.(*object.Bytes).Value
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(bytes.Equal(leftValue, rightValue)))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(!bytes.Equal(leftValue, rightValue)))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return True
@@ -512,10 +782,12 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	rightType := right.Type()
 
 	switch {
-	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+	case object.IsInteger(left) && object.IsInteger(right):
 		return vm.executeBinaryIntegerOpration(op, left, right)
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
+	case leftType == object.BYTES_OBJ && rightType == object.BYTES_OBJ:
+		return vm.executeBinaryBytesOperation(op, left, right)
 	default:
 		return fmt.Errorf("unsupported type for binary operation: %s %s", leftType, rightType)
 	}
@@ -529,32 +801,58 @@ func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Ob
 		return fmt.Errorf("Unknown string operation: %d", op)
 	}
 
-	return vm.push(&object.String{Value: leftValue + rightValue})
+	str := &object.String{Value: leftValue + rightValue}
+	if err := vm.budget.CheckSize(str); err != nil {
+		return err
+	}
+
+	return vm.push(str)
 }
 
-func (vm *VM) executeBinaryIntegerOpration(op code.Opcode, left, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+func (vm *VM) executeBinaryBytesOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Bytes).Value
+	rightValue := right.(*object.Bytes).Value
+
+	if op != code.OpAdd {
+		return fmt.Errorf("Unknown bytes operation: %d", op)
+	}
+
+	value := make([]byte, 0, len(leftValue)+len(rightValue))
+	result := &object.Bytes{Value: append(append(value, leftValue...), rightValue...)}
+	if err := vm.budget.CheckSize(result); err != nil {
+		return err
+	}
 
-	var result int64
+	return vm.push(result)
+}
+
+func (vm *VM) executeBinaryIntegerOpration(op code.Opcode, left, right object.Object) error {
+	var operator string
 	switch op {
 	case code.OpAdd:
-		result = leftValue + rightValue
+		operator = "+"
 	case code.OpSub:
-		result = leftValue - rightValue
+		operator = "-"
 	case code.OpMul:
-		result = leftValue * rightValue
+		operator = "*"
 	case code.OpDiv:
-		result = leftValue / rightValue
+		operator = "/"
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
 
-	return vm.push(&object.Integer{Value: result})
+	result := object.IntegerArithmetic(vm.budget, operator, left, right)
+	if err := vm.budget.Err(); err != nil {
+		return err
+	}
+	if err, ok := result.(*object.Error); ok {
+		return errors.New(err.Message)
+	}
+	return vm.push(result)
 }
 
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
+	if vm.sp >= len(vm.stack) {
 		return fmt.Errorf("stack overflow")
 	}
 
@@ -586,3 +884,78 @@ func (vm *VM) PrintStack() string {
 
 	return out.String()
 }
+
+// builtin returns the builtin at index in the runtime of vm. The
+// builtins are bound to vm once, and again only if the code refers to one
+// registered since.
+func (vm *VM) builtin(index int) *object.Builtin {
+	if index >= len(vm.builtins) {
+		vm.builtins = vm.runtime.Bind(vm.evalQuote)
+	}
+	return vm.builtins[index]
+}
+
+// evalQuote is eval_quote for the VM. The quoted code is compiled and run
+// with globals of its own, on the part of the stack and frames vm doesn't
+// use. It counts against the budget of vm. The functions it compiles keep
+// its constant pool, so the ones it returns can be called by vm.
+func (vm *VM) evalQuote(node ast.Node) object.Object {
+	program := quotedProgram(node)
+	comp := compiler.NewWithRuntime(vm.runtime)
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	bytecode := comp.Bytecode()
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			fn.Constants = bytecode.Constants
+		}
+	}
+
+	if vm.frameIdx+1 >= len(vm.frames) {
+		return &object.Error{Message: fmt.Sprintf("stack overflow: more than %d nested calls", MaxFrames)}
+	}
+	frames := vm.frames[vm.frameIdx+1:]
+	main := &object.CompiledFunction{Instructions: bytecode.Instructions, Constants: bytecode.Constants}
+	frames[0] = NewFrame(&object.Closure{Fn: main}, 0)
+
+	machine := &VM{
+		constants: bytecode.Constants,
+		stack:     vm.stack[vm.sp:],
+		globals:   make([]object.Object, GlobalsSize),
+		frames:    frames,
+		budget:    vm.budget,
+		runtime:   vm.runtime,
+	}
+	if err := machine.run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	// Only a program ending in an expression leaves a value behind, like
+	// in the evaluator.
+	stmts := program.Hoisted()
+	if len(stmts) == 0 {
+		return Null
+	}
+	if _, ok := stmts[len(stmts)-1].(*ast.ExpressionStatement); !ok {
+		return Null
+	}
+	return machine.LastPoppedStackElem()
+}
+
+// quotedProgram turns quoted code into a program whose value is the value
+// of the code.
+func quotedProgram(node ast.Node) *ast.Program {
+	switch node := node.(type) {
+	case *ast.Program:
+		return node
+	case *ast.BlockStatement:
+		return &ast.Program{Statements: node.Statements}
+	case ast.Statement:
+		return &ast.Program{Statements: []ast.Statement{node}}
+	case ast.Expression:
+		return &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: node}}}
+	default:
+		return &ast.Program{}
+	}
+}
@@ -1,13 +1,17 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"monkey/ast"
 	"monkey/compiler"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
+	"time"
 )
 
 func parse(input string) *ast.Program {
@@ -55,6 +59,12 @@ func testStringObject(expected string, actual object.Object) error {
 	return nil
 }
 
+// quoted is an expected quote, the String() of its code.
+type quoted string
+
+// inspected is an expected object given by its Inspect().
+type inspected string
+
 type vmTestCase struct {
 	input    string
 	expected interface{}
@@ -78,6 +88,10 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		}
 		t.Logf(vm.PrintStack())
 		if err != nil {
+			// a failing builtin stops the VM with its error
+			if expected, ok := tt.expected.(*object.Error); ok && err.Error() == expected.Message {
+				continue
+			}
 			t.Fatalf("[%d]: vm error: %s", i, err)
 		}
 		stackElem := vm.LastPoppedStackElem()
@@ -112,19 +126,32 @@ func testExpectedObject(
 		if err != nil {
 			t.Errorf("[%d] testStringObject failed: %s", i, err)
 		}
+	case quoted:
+		quote, ok := actual.(*object.Quote)
+		if !ok {
+			t.Errorf("[%d] object not Quote: %T (%+v)", i, actual, actual)
+			return
+		}
+		if quote.Node.String() != string(expected) {
+			t.Errorf("[%d] wrong quote. want=%q, got=%q", i, expected, quote.Node.String())
+		}
+	case inspected:
+		if actual.Inspect() != string(expected) {
+			t.Errorf("[%d] wrong object. want=%q, got=%q", i, expected, actual.Inspect())
+		}
 	case []int:
 		array, ok := actual.(*object.Array)
 		if !ok {
 			t.Errorf("[%d] object not Array: %T (%+v)", i, actual, actual)
 			return
 		}
-		if len(array.Elements) != len(expected) {
+		if array.Len() != len(expected) {
 			t.Errorf("[%d] wrong num of elements. want=%d, got=%d",
-				i, len(expected), len(array.Elements))
+				i, len(expected), array.Len())
 			return
 		}
 		for i, expectedElem := range expected {
-			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			err := testIntegerObject(int64(expectedElem), array.At(i))
 			if err != nil {
 				t.Errorf("[%d] testIntegerObject failed: %s", i, err)
 			}
@@ -185,6 +212,56 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestBigIntegers(t *testing.T) {
+	tests := []vmTestCase{
+		{"9223372036854775807 + 1", inspected("9223372036854775808")},
+		{"-9223372036854775807 - 2", inspected("-9223372036854775809")},
+		{"-9223372036854775808", -9223372036854775808},
+		{"-(-9223372036854775807 - 1)", inspected("9223372036854775808")},
+		{"4294967296 * 4294967296", inspected("18446744073709551616")},
+		{"(-9223372036854775807 - 1) / -1", inspected("9223372036854775808")},
+		{"(9223372036854775807 + 1) - 1", 9223372036854775807},
+		{"123456789012345678901234567890 / 10", inspected("12345678901234567890123456789")},
+		{"-123456789012345678901234567890 / 1234567890123456789012345678", -100},
+		{"9223372036854775808 > 9223372036854775807", true},
+		{"1 < 9223372036854775808", true},
+		{"9223372036854775808 == 9223372036854775807 + 1", true},
+		{"9223372036854775808 != 1", true},
+		{"{9223372036854775808: 1}[9223372036854775807 + 1]", 1},
+		{"[1, 2][9223372036854775808]", Null},
+		{`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(25)`,
+			inspected("15511210043330985984000000")},
+		{`quote(unquote(9223372036854775807 + 1))`, quoted("9223372036854775808")},
+		{"1 / 0", &object.Error{Message: "division by zero"}},
+		{"(9223372036854775807 * 2) / 0", &object.Error{Message: "division by zero"}},
+		{"(9223372036854775807 * 2) / (9223372036854775808 - 9223372036854775808)", &object.Error{Message: "division by zero"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBytes(t *testing.T) {
+	tests := []vmTestCase{
+		{`b"a\x00\xff"`, inspected(`b"a\x00\xff"`)},
+		{`b"ab" + b"\x01"`, inspected(`b"ab\x01"`)},
+		{`b"ab" == b"ab"`, true},
+		{`b"ab" != b"ab"`, false},
+		{`b"ab" == "ab"`, false},
+		{`b"a\xff"[1]`, 255},
+		{`b"a"[1]`, Null},
+		{`len(b"\x00\x01")`, 2},
+		{`bytes("ü")`, inspected(`b"\xc3\xbc"`)},
+		{`string(b"\xc3\xbc")`, "ü"},
+		{`slice(b"abcdef", 1, 3)`, inspected(`b"bc"`)},
+		{`encode(b"\x00\xff", "hex")`, "00ff"},
+		{`decode("aGk=", "base64")`, inspected(`b"hi"`)},
+		{`{b"k": 1}[b"k"]`, 1},
+		{`quote(unquote(b"\x00"))`, quoted(`b"\x00"`)},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"true", true},
@@ -230,6 +307,9 @@ func TestConditionals(t *testing.T) {
 		{"if (1 > 2) { 10 }", Null},
 		{"if (false) { 10 }", Null},
 		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { }", Null},
+		{"if (false) { 10 } else { let a = 1; }", Null},
+		{"let a = if (true) { let b = 1; }; a", Null},
 	}
 	runVmTests(t, tests)
 }
@@ -248,6 +328,9 @@ func TestStringExpressions(t *testing.T) {
 		{`"monkey"`, "monkey"},
 		{`"mon" + "key"`, "monkey"},
 		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"mon" + "key" == "monkey"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
 	}
 	runVmTests(t, tests)
 }
@@ -284,6 +367,159 @@ func TestHashLiterals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestHashOrder(t *testing.T) {
+	tests := []vmTestCase{
+		{`{"b": 1, "a": 2, 3: 3, true: 4}`, inspected(`{b : 1, a : 2, 3 : 3, true : 4}`)},
+		{`{"a": 1, "b": 2, "a": 3}`, inspected(`{a : 3, b : 2}`)},
+		{`keys({"z": 1, "y": 2, "x": 3})`, inspected(`[z, y, x]`)},
+		{`values({"z": 1, "y": 2, "x": 3})`, []int{1, 2, 3}},
+		{`keys({})`, []int{}},
+		{`keys([])`, &object.Error{Message: "argument to `keys` must be HASH, got ARRAY"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`split("a,b,,c", ",")`, inspected(`[a, b, , c]`)},
+		{`split("héllo", "")`, inspected(`[h, é, l, l, o]`)},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([], "-")`, ""},
+		{`join(["a", 1], "-")`, &object.Error{Message: "elements joined by `join` must be STRING, got INTEGER"}},
+		{`trim("  a b  ")`, "a b"},
+		{`trim_left("  a ")`, "a "},
+		{`trim_right("  a ")`, "  a"},
+		{`upper("héllo")`, "HÉLLO"},
+		{`lower("ÄB")`, "äb"},
+		{`contains("monkey", "key")`, true},
+		{`starts_with("monkey", "mon")`, true},
+		{`ends_with("monkey", "mon")`, false},
+		{`index_of("héllo", "l")`, 2},
+		{`index_of("hello", "z")`, -1},
+		{`replace("a.b.c", ".", "::")`, "a::b::c"},
+		{`replace("abc", "", "x")`, &object.Error{Message: "can't replace an empty string"}},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", -1)`, &object.Error{Message: "can't repeat a string -1 times"}},
+		{`pad_left("7", 3, "0")`, "007"},
+		{`pad_left("é", 4, "ab")`, "abaé"},
+		{`pad_right("abc", 2, " ")`, "abc"},
+		{`pad_right("a", 3, "")`, &object.Error{Message: "can't pad with an empty string"}},
+		{`chars("añb")`, inspected(`[a, ñ, b]`)},
+		{`chars("")`, inspected(`[]`)},
+		// len counts bytes, the text builtins count characters
+		{`len("é")`, 2},
+		{`len(chars("é"))`, 1},
+		{`index_of("éa", "a")`, 1},
+		{`len(pad_left("é", 2, "-"))`, 3},
+		{`upper(1)`, &object.Error{Message: "argument to `upper` must be STRING, got INTEGER"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeBuiltins(t *testing.T) {
+	rt := object.NewRuntime()
+	if err := rt.Register("duplicate", strings.Repeat); err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+
+	comp := compiler.NewWithRuntime(rt)
+	program := parse(`let twice = fn(s) { duplicate(s, 2) }; twice("ab") + eval_quote(quote(duplicate("c", 3)))`)
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode().Instructions, comp.Bytecode().Constants)
+	vm.SetRuntime(rt)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if result := vm.LastPoppedStackElem(); result.Inspect() != "ababccc" {
+		t.Errorf("wrong result. got=%q", result.Inspect())
+	}
+
+	err := compiler.New().Compile(parse(`duplicate("a", 2)`))
+	if err == nil || err.Error() != "can't get global 'duplicate', it's not defined." {
+		t.Errorf("builtin of another runtime found. got=%v", err)
+	}
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, [2, "a"]] == [1, [2, "a"]]`, true},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, 2] != [1, 2, 3]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`#{1, 2} == #{2, 1}`, true},
+		{`b"ab" == b"ab"`, true},
+		{`[1] == "1"`, false},
+		{`let mk = fn(x) { fn() { x } }; mk(1) == mk(1)`, true},
+		{`let mk = fn(x) { fn() { x } }; mk(1) == mk(2)`, false},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f == f`, true},
+		{`let a = [1]; a is a`, true},
+		{`[1] is [1]`, false},
+		{`let a = [1]; let b = push(a, 2); a is b`, false},
+		{`1 is 1`, true},
+		{`"a" is "a"`, true},
+		{`[1] is [1] == false`, true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSets(t *testing.T) {
+	tests := []vmTestCase{
+		{`#{3, 1, 2, 1, 3}`, inspected(`#{3, 1, 2}`)},
+		{`#{}`, inspected(`#{}`)},
+		{`#{[1, 2], "a", true}`, inspected(`#{[1, 2], a, true}`)},
+		{`len(#{1, 2, 2})`, 2},
+		{`2 in #{1, 2}`, true},
+		{`3 in #{1, 2}`, false},
+		{`[2, 1] in #{[1, 2]}`, false},
+		{`"a" in {"a": 1}`, true},
+		{`1 + 1 in #{2} == true`, true},
+		{`union(#{1, 2}, #{3, 2})`, inspected(`#{1, 2, 3}`)},
+		{`intersect(#{1, 2, 3}, #{3, 2})`, inspected(`#{2, 3}`)},
+		{`difference(#{1, 2, 3}, #{2})`, inspected(`#{1, 3}`)},
+		{`elements(#{"b", "a"})`, inspected(`[b, a]`)},
+		{`set([1, 2, 1])`, inspected(`#{1, 2}`)},
+		{`let s = #{1}; union(s, #{2}); s`, inspected(`#{1}`)},
+		{`set([{}])`, &object.Error{Message: "unusable as set element: HASH"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSetErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`#{fn(x) { x }}`, "unusable as set element: CLOSURE"},
+		{`fn(x) { x } in #{1}`, "unusable as set element: CLOSURE"},
+		{`1 in [1]`, "unknown operator: INTEGER in ARRAY"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode().Instructions, comp.Bytecode().Constants)
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"[1, 2, 3][1]", 2},
@@ -296,10 +532,44 @@ func TestIndexExpressions(t *testing.T) {
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
 		{"{}[0]", Null},
+		{"{[1, 2]: 1, [2, 1]: 2}[[2, 1]]", 2},
+		{"let x = 1; {[x, x + 1]: 3}[[1, 2]]", 3},
+		{`{[1, ["a", true]]: 4}[[1, ["a", true]]]`, 4},
+		{`{[1]: 1}[["1"]]`, Null},
+		{`{[1]: 1}[1]`, Null},
+		{"{[]: 5}[[]]", 5},
+		{"{[1]: 1, [1]: 2}", inspected("{[1] : 2}")},
 	}
 	runVmTests(t, tests)
 }
 
+func TestUnusableHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{fn() {}: 1}`, "unusable as hash key: CLOSURE"},
+		{`{[1, fn() {}]: 1}`, "unusable as hash key: ARRAY"},
+		{`{1: 1}[[{}]]`, "unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode().Instructions, comp.Bytecode().Constants)
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
 func TestCallingFunctionsWithoutArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -554,7 +824,7 @@ func TestBuiltinFunctions(t *testing.T) {
 		{
 			`len(1)`,
 			&object.Error{
-				Message: "argument to `len` not supported, got INTEGER",
+				Message: "argument to `len` must be ARRAY, STRING, BYTES or SET, got INTEGER",
 			},
 		},
 		{
@@ -583,9 +853,12 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`rest([1,2,3])`, []int{2, 3}},
 		{`rest([])`, Null},
 		{`push([], 1)`, []int{1}},
+		{`pop([1, 2])`, []int{1}},
+		{`pop([])`, Null},
+		{`puts()`, Null},
 		{`push(1, 1)`,
 			&object.Error{
-				Message: "argument to `push` must be ARRAY, got INTEGER",
+				Message: "argument 1 to `push` must be ARRAY, got INTEGER",
 			},
 		},
 	}
@@ -722,3 +995,248 @@ func TestRecursiveFunctions(t *testing.T) {
 	}
 	runVmTests(t, tests)
 }
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+            let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } };
+            loop(1000000, 0);
+            `,
+			expected: 1000000,
+		},
+		{
+			input: `
+            let wrapper = fn() {
+                let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+                let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+                isEven(100001);
+            };
+            wrapper();
+            `,
+			expected: false,
+		},
+		{
+			input: `
+            let countDown = fn(n, f) { if (n == 0) { f(n) } else { countDown(n - 1, f) } };
+            countDown(1000000, fn(x) { let y = x + 5; y });
+            `,
+			expected: 5,
+		},
+		{
+			input:    `let last = fn(arr) { len(arr) }; let f = fn() { last([1, 2]) }; f() + 1`,
+			expected: 3,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForwardReferences(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+            main();
+            fn main() { helper() + 1 }
+            fn helper() { 41 }
+            `,
+			expected: 42,
+		},
+		{
+			input: `
+            let a = fn() { b() };
+            let b = fn() { 3 };
+            a();
+            `,
+			expected: 3,
+		},
+		{
+			input: `
+            let wrapper = fn() {
+                let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+                let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+                isEven(10);
+            };
+            wrapper();
+            `,
+			expected: true,
+		},
+		{
+			input: `
+            let wrapper = fn(x) {
+                fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+                fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+                let nested = fn() { fn() { isOdd(x) } };
+                nested()();
+            };
+            wrapper(7);
+            `,
+			expected: true,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+// TestUnboundLocals checks that reading a name before it's bound fails
+// like it does in the evaluator, and that closures capturing it see it
+// once it is.
+func TestUnboundLocals(t *testing.T) {
+	tests := []vmTestCase{
+		{`fn() { let fs = [fn() { b() }]; let b = fn() { 1 }; fs[0]() }()`, 1},
+		{`fn() { let h = {"f": fn() { b() }}; let b = fn() { 2 }; h["f"]() }()`, 2},
+		{`let f = fn() { x }; let x = 5; f()`, 5},
+		{`fn() { let a = fn() { b() }; a(); let b = fn() { 1 }; }()`, &object.Error{Message: "identifier not found: b"}},
+		{`fn() { let fs = [fn() { b() }]; fs[0](); let b = fn() { 1 }; }()`, &object.Error{Message: "identifier not found: b"}},
+		{`let f = fn() { x }; f(); let x = 5;`, &object.Error{Message: "identifier not found: x"}},
+		{`if (false) { let y = 1 }; y`, &object.Error{Message: "identifier not found: y"}},
+		{`fn() { if (false) { let y = 1 }; y }()`, &object.Error{Message: "identifier not found: y"}},
+		{`if (true) { let y = 1 }; y`, 1},
+		// the value of a let sees the variable it shadows
+		{`let x = 1; let f = fn() { let x = x + 1; x }; f()`, 2},
+		{`fn(x) { fn() { let x = x * 2; let g = fn() { x }; g() }() }(21)`, 42},
+		{`fn() { let y = 3; fn() { let y = [y, fn() { y }]; y[1]()[0] }() }()`, 3},
+		{`fn() { let x = x; x }()`, &object.Error{Message: "identifier not found: x"}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestQuote(t *testing.T) {
+	tests := []vmTestCase{
+		{`quote(5)`, quoted("5")},
+		{`quote(foobar + barfoo)`, quoted("(foobar + barfoo)")},
+		{`quote(unquote(4 + 4) + 8)`, quoted("(8 + 8)")},
+		{`let f = fn(x) { quote(unquote(x) * y) }; f(3)`, quoted("(3 * y)")},
+		{`let q = quote(4 + 4); quote(unquote(q) + unquote(true))`, quoted("((4 + 4) + true)")},
+		{`quote(unquote([1, "two"]))`, quoted("[1, two]")},
+		{`let xs = [1, 2]; quote(f(0, unquote_splice(xs), 3))`, quoted("f(0, 1, 2, 3)")},
+		{`let wrap = fn(x) { quote(g(unquote(x))) }; quote(f(unquote_splice([wrap(1), wrap(2)])))`, quoted("f(g(1), g(2))")},
+		{`node_kind(quote(f(x)))`, "CallExpression"},
+		{`make_call("f", [1, quote(x)])`, quoted("f(1, x)")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestEvalQuote(t *testing.T) {
+	tests := []vmTestCase{
+		{`eval_quote(quote(1 + 2))`, 3},
+		{`let x = 20; eval_quote(quote(unquote(x) + 22))`, 42},
+		{`eval_quote(make_call("len", [[1, 2, 3]]))`, 3},
+		{`eval_quote(make_block([quote(1), quote(2)]))`, 2},
+		{`let f = fn(n) { if (n == 0) { 0 } else { eval_quote(quote(unquote(n) + f(unquote(n - 1)))) } }; f(3)`,
+			&object.Error{Message: "can't get global 'f', it's not defined."}},
+		{`eval_quote(quote(fn(n) { n * 2 }(21)))`, 42},
+		{`eval_quote(quote(nope))`, &object.Error{Message: "can't get global 'nope', it's not defined."}},
+		{`eval_quote(1)`, &object.Error{Message: "argument to `eval_quote` must be QUOTE, got INTEGER"}},
+		{`eval_quote == eval_quote`, true},
+		{`let f = eval_quote(quote(fn() { [1, 2, 3, 4, 5, 6, 7, 8, 9] })); f()`, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{`eval_quote(quote(fn(x) { x * 2 }))(4)`, 8},
+		{`let f = eval_quote(quote(fn() { "hi" })); f()`, "hi"},
+		{`let f = eval_quote(quote(fn() { fn() { "inner" } })); f()()`, "inner"},
+		{`let f = eval_quote(quote(fn() { eval_quote(quote(fn() { 10 + 1 })) })); f()()`, 11},
+		{`1; eval_quote(make_block([]))`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(n) { n }; quote(unquote(f)(1))`, "can't unquote CLOSURE, it has no literal"},
+		{`quote(f(unquote_splice(1)))`, "can't splice INTEGER, it's not an array"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode().Instructions, comp.Bytecode().Constants)
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits object.Limits
+		kind   object.LimitKind
+	}{
+		{`let loop = fn() { loop() }; loop();`, object.Limits{MaxSteps: 10000}, object.StepLimit},
+		{`let f = fn(n) { 1 + f(n + 1) }; f(0);`, object.Limits{MaxCallDepth: 100}, object.CallDepthLimit},
+		{`let grow = fn(arr) { grow(push(arr, 1)) }; grow([]);`, object.Limits{MaxCollectionSize: 100}, object.CollectionSizeLimit},
+		{`let grow = fn(s) { grow(s + s) }; grow("ab");`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`[1, 2, 3, 4]`, object.Limits{MaxCollectionSize: 3}, object.CollectionSizeLimit},
+		{`repeat("abcdefgh", 100000000)`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`pad_left("", 50000000, "é")`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`pad_right("abc", 600, "é")`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`replace(repeat("a", 1000), "a", repeat("b", 1000))`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`split(repeat(",", 1000), ",")`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`let s = repeat("a", 1000); join([s, s, s], "")`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`let loop = fn() { loop() }; loop();`, object.Limits{Timeout: 10 * time.Millisecond}, object.TimeLimit},
+		// squaring doubles the size of an integer in a single step
+		{`let f = fn(x, n) { if (n == 0) { x } else { f(x * x, n - 1) } }; f(3, 32);`, object.Limits{MaxCollectionSize: 1000}, object.CollectionSizeLimit},
+		{`let f = fn(x, n) { if (n == 0) { x } else { f(x * x, n - 1) } }; f(3, 32);`, object.Limits{MaxSteps: 10000, Timeout: 10 * time.Millisecond}, object.TimeLimit},
+	}
+
+	for i, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("[%d]: compiler error: %s", i, err)
+		}
+
+		vm := New(comp.Bytecode().Instructions, comp.Bytecode().Constants)
+		vm.SetLimits(tt.limits)
+		err = vm.Run()
+
+		var limitErr *object.LimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("[%d]: expected *object.LimitError, got=%v", i, err)
+		}
+		if limitErr.Kind != tt.kind {
+			t.Errorf("[%d]: wrong limit exceeded. want=%d, got=%d (%s)", i, tt.kind, limitErr.Kind, limitErr)
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let loop = fn(n) { if (n == 0) { 1 } else { loop(n - 1) } }; loop(100);`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode().Instructions, comp.Bytecode().Constants)
+	vm.SetLimits(object.Limits{MaxSteps: 10000, MaxCallDepth: 10, MaxCollectionSize: 10, Timeout: time.Minute})
+	err = vm.RunContext(context.Background())
+	if err != nil {
+		t.Fatalf("program within limits failed: %s", err)
+	}
+	testExpectedObject(t, 0, 1, vm.LastPoppedStackElem())
+
+	comp = compiler.New()
+	err = comp.Compile(parse(`let loop = fn() { loop() }; loop();`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	vm = New(comp.Bytecode().Instructions, comp.Bytecode().Constants)
+	err = vm.RunContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got=%v", err)
+	}
+}